@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// splitHosts parses a comma-separated list of APIC hosts.
+func splitHosts(s string) []string {
+	var hosts []string
+	for _, host := range strings.Split(s, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// hostname strips the scheme and port from an APIC URL.
+func hostname(url string) string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	if host, _, err := net.SplitHostPort(url); err == nil {
+		return host
+	}
+	return url
+}
+
+// nodeFor returns the node record with an address or name, from the given
+// attributes, matching the host, if any.
+func nodeFor(nodes goaci.Res, host string, attrs ...string) (goaci.Res, bool) {
+	host = hostname(host)
+	for _, node := range nodes.Array() {
+		for _, attr := range attrs {
+			if v := node.Get(attr).Str; v != "" && v == host {
+				return node, true
+			}
+		}
+	}
+	return goaci.Res{}, false
+}
+
+// standbyController checks whether the host is a standby controller, and
+// returns its name. Active controllers are in topSystem; a host that isn't,
+// e.g. a DNS name, is checked against the standby controllers.
+func standbyController(client collector.Getter, host string, log Logger) (string, bool) {
+	res, err := client.Get("/api/class/topSystem",
+		goaci.Query("query-target-filter", `eq(topSystem.role,"controller")`))
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot query controllers")
+	} else if node, ok := nodeFor(res.Get("imdata.#.topSystem.attributes"), host,
+		"oobMgmtAddr", "inbMgmtAddr", "address", "name"); ok {
+		log.Debug().Str("name", node.Get("name").Str).Msg("active controller")
+		return "", false
+	}
+	res, err = client.Get("/api/class/infraSnNode")
+	if err != nil {
+		// Don't fail the collection if standby state can't be determined
+		log.Warn().Err(err).Msg("cannot query standby controllers")
+		return "", false
+	}
+	standby := res.Get("imdata.#.infraSnNode.attributes")
+	log.Debug().Int("count", len(standby.Array())).Msg("standby controllers")
+	if node, ok := nodeFor(standby, host, "oobIpAddr", "addr", "name"); ok {
+		return node.Get("name").Str, true
+	}
+	return "", false
+}
+
+// verifyActive ensures the collection target is an active controller,
+// moving past standby controllers to the next controller in the list.
+// Standby controllers only serve a subset of the API, so collections against
+// a standby would otherwise fail or return incomplete data.
+func verifyActive(pool *collector.Pool, log Logger) error {
+	for tried := 1; ; tried++ {
+		host := pool.Host()
+		name, ok := standbyController(pool, host, log)
+		if !ok {
+			return nil
+		}
+		err := fmt.Errorf("%s is standby controller %s; please run the collection against an active controller",
+			host, name)
+		if tried >= pool.Len() {
+			return err
+		}
+		log.Warn().Err(err).Msg("skipping standby controller")
+		if err := pool.Skip(); err != nil {
+			return err
+		}
+		log.Info().Str("host", pool.Host()).Msg("Authenticated to the APIC")
+	}
+}
+
+// check verifies connectivity and credentials for the APIC without
+// collecting any data.
+func check(conn Connection, log Logger) error {
+	hosts := splitHosts(conn.APIC)
+	runID := newRunID()
+	pool := collector.NewPool(hosts, conn.Username, conn.Password, log, conn.clientMods(runID)...)
+	log.Info().Str("run_id", runID).Str("user_agent", userAgent()).Msg("Connectivity check")
+	log.Info().Msg("Authenticating to the APIC...")
+	if err := pool.Login(); err != nil {
+		return fmt.Errorf("cannot authenticate to the APIC at %s: %v", conn.APIC, err)
+	}
+	log.Info().Str("host", pool.Host()).Str("user", conn.Username).Msg("Authenticated to the APIC")
+	if err := verifyActive(pool, log); err != nil {
+		return err
+	}
+	res, err := pool.Get("/api/class/firmwareCtrlrRunning")
+	if err != nil {
+		return fmt.Errorf("cannot query controller firmware: %v", err)
+	}
+	for _, ctrlr := range res.Get("imdata.#.firmwareCtrlrRunning.attributes").Array() {
+		log.Info().
+			Str("dn", ctrlr.Get("dn").Str).
+			Str("version", ctrlr.Get("version").Str).
+			Msg("Controller firmware")
+	}
+	log.Info().Msg("Check complete. The APIC is ready for collection.")
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gopkg.in/h2non/gock.v1"
+
+	"aci-vetr-c/collector"
+)
+
+func TestSplitHosts(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{"apic1", "apic2", "apic3"}, splitHosts("apic1, apic2,,apic3 "))
+	a.Nil(splitHosts(""))
+}
+
+func TestVerifyActive(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	for _, host := range []string{"10.0.0.1", "10.0.0.4"} {
+		gock.New("https://" + host).
+			Post("/api/aaaLogin.json").
+			Persist().
+			Reply(200).
+			BodyString(`{"imdata":[]}`)
+		gock.New("https://" + host).
+			Get("/api/class/topSystem.json").
+			Persist().
+			Reply(200).
+			BodyString(goaci.Body{}.
+				Set("imdata.0.topSystem.attributes.name", "apic1").
+				Set("imdata.0.topSystem.attributes.oobMgmtAddr", "10.0.0.1").
+				Str)
+		gock.New("https://" + host).
+			Get("/api/class/infraSnNode.json").
+			Persist().
+			Reply(200).
+			BodyString(goaci.Body{}.
+				Set("imdata.0.infraSnNode.attributes.name", "apic4").
+				Set("imdata.0.infraSnNode.attributes.oobIpAddr", "10.0.0.4").
+				Str)
+	}
+	log := zerolog.New(&bytes.Buffer{})
+	intercept := func(c *goaci.Client) { gock.InterceptClient(c.HttpClient) }
+
+	// The standby controller is skipped
+	pool := collector.NewPool([]string{"10.0.0.4", "10.0.0.1"}, "usr", "pwd", log, intercept)
+	a.NoError(pool.Login())
+	a.NoError(verifyActive(pool, log))
+	a.Equal("10.0.0.1", pool.Host())
+
+	pool = collector.NewPool([]string{"10.0.0.4"}, "usr", "pwd", log, intercept)
+	a.NoError(pool.Login())
+	err := verifyActive(pool, log)
+	if a.Error(err) {
+		a.Contains(err.Error(), "standby controller apic4")
+	}
+}
+
+func TestNodeFor(t *testing.T) {
+	a := assert.New(t)
+	nodes := gjson.Parse(`[{"name":"apic4","oobIpAddr":"10.0.0.4"}]`)
+	node, ok := nodeFor(nodes, "https://10.0.0.4:443", "oobIpAddr", "name")
+	a.True(ok)
+	a.Equal("apic4", node.Get("name").Str)
+	_, ok = nodeFor(nodes, "10.0.0.1", "oobIpAddr", "name")
+	a.False(ok)
+}
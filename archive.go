@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// Supported collection archive formats.
+var archiveFormats = []string{"zip", "tar.gz", "tar.zst"}
+
+// archiveOptions are the optional contents and encoding of an archive.
+type archiveOptions struct {
+	files       []string  // Additional files, e.g. the log
+	payloads    []payload // Additional formats of the records
+	compression string    // Compression level: store, fast or best
+	inMemory    bool      // Build the db in memory rather than in data.db
+	keepDB      bool      // Keep the db next to the archive rather than wiping it
+
+	// The db the records were written to as they were fetched, if any, with
+	// the records per class; it's closed once archived
+	db     *buntdb.DB
+	counts map[string]int
+}
+
+// archiveExt returns the archive extension of a path, e.g. .tar.gz, or an
+// empty string if it isn't a supported archive.
+func archiveExt(path string) string {
+	lower := strings.ToLower(path)
+	for _, format := range archiveFormats {
+		if strings.HasSuffix(lower, "."+format) {
+			return path[len(path)-len(format)-1:]
+		}
+	}
+	return ""
+}
+
+// isArchive reports whether a path is a supported archive.
+func isArchive(path string) bool {
+	return archiveExt(path) != ""
+}
+
+// splitExt splits a path into base and extension, keeping compound archive
+// extensions, e.g. .tar.gz, together.
+func splitExt(path string) (string, string) {
+	ext := archiveExt(path)
+	if ext == "" {
+		ext = filepath.Ext(path)
+	}
+	return strings.TrimSuffix(path, ext), ext
+}
+
+// withArchiveFormat replaces the extension of a path with that of an archive
+// format, e.g. aci-vetr-data.zip -> aci-vetr-data.tar.gz
+func withArchiveFormat(path, format string) (string, error) {
+	for _, f := range archiveFormats {
+		if format == f {
+			base, _ := splitExt(path)
+			return base + "." + format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown archive format %q, expected one of %s",
+		format, strings.Join(archiveFormats, ", "))
+}
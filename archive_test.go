@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestSplitExt(t *testing.T) {
+	a := assert.New(t)
+	base, ext := splitExt("out/aci-vetr-data.tar.gz")
+	a.Equal("out/aci-vetr-data", base)
+	a.Equal(".tar.gz", ext)
+	base, ext = splitExt("data.db")
+	a.Equal("data", base)
+	a.Equal(".db", ext)
+	a.True(isArchive("DATA.ZIP"))
+	a.False(isArchive("data.db"))
+}
+
+func TestWithArchiveFormat(t *testing.T) {
+	a := assert.New(t)
+	out, err := withArchiveFormat("aci-vetr-data.zip", "tar.zst")
+	a.NoError(err)
+	a.Equal("aci-vetr-data.tar.zst", out)
+	out, err = withArchiveFormat("aci-vetr-data.tar.gz", "zip")
+	a.NoError(err)
+	a.Equal("aci-vetr-data.zip", out)
+	_, err = withArchiveFormat("aci-vetr-data.zip", "rar")
+	a.Error(err)
+}
+
+func TestArchiveFormats(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for _, format := range archiveFormats {
+		out := filepath.Join(dir, "data."+format)
+		if !a.NoError(readRawFixture(dir, out, log), format) {
+			continue
+		}
+		db, closeDB, err := openDB(out)
+		if !a.NoError(err, format) {
+			continue
+		}
+		counts, err := countRecords(db)
+		a.NoError(err)
+		a.Equal(2, counts["fvTenant"], format)
+		closeDB()
+	}
+}
+
+func TestWriteArchiveInMemory(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	os.Remove(dbName)
+	for _, format := range archiveFormats {
+		out := filepath.Join(dir, "data."+format)
+		responses := map[string]goaci.Res{
+			"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}, {"dn": "uni/tn-b"}]`),
+		}
+		if !a.NoError(writeArchive(out, responses, goaci.Body{}, archiveOptions{inMemory: true}, log), format) {
+			continue
+		}
+		_, err := os.Stat(dbName)
+		a.True(os.IsNotExist(err), format)
+
+		n, err := verifyManifest(out)
+		a.NoError(err, format)
+		a.Equal(1, n, format)
+		db, closeDB, err := openDB(out)
+		if !a.NoError(err, format) {
+			continue
+		}
+		counts, err := countRecords(db)
+		a.NoError(err)
+		a.Equal(2, counts["fvTenant"], format)
+		closeDB()
+	}
+}
+
+func TestWriteArchiveKeepDB(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "aci-vetr-data.zip")
+	responses := map[string]goaci.Res{"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}]`)}
+	if !a.NoError(writeArchive(out, responses, goaci.Body{}, archiveOptions{keepDB: true}, log)) {
+		return
+	}
+	a.Equal(filepath.Join(dir, "aci-vetr-data.db"), keptDBPath(out))
+	_, err = os.Stat(dbName)
+	a.True(os.IsNotExist(err))
+	db, closeDB, err := openDB(keptDBPath(out))
+	if !a.NoError(err) {
+		return
+	}
+	defer closeDB()
+	counts, err := countRecords(db)
+	a.NoError(err)
+	a.Equal(1, counts["fvTenant"])
+}
@@ -2,13 +2,22 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"golang.org/x/crypto/ssh/terminal"
+
+	"aci-vetr-c/collector"
 )
 
 // input collects CLI input.
@@ -19,14 +28,293 @@ func input(prompt string) string {
 	return strings.Trim(input, "\r\n")
 }
 
+// Connection are the parameters for connecting to the APIC.
+type Connection struct {
+	APIC     string `arg:"-a" help:"APIC hostname or IP address (comma-separated list for failover)"`
+	Username string `arg:"-u" help:"APIC username"`
+	Password string `arg:"-p" help:"APIC password"`
+
+	MaxIdleConns int           `arg:"--max-idle-conns" help:"Idle connections kept open to the APIC for reuse [default: 32]" placeholder:"N"`
+	NoReuse      bool          `arg:"--no-reuse" help:"Open a new connection for every request"`
+	TCPKeepAlive time.Duration `arg:"--tcp-keepalive" help:"TCP keepalive interval, or -1s to disable [default: 15s]" placeholder:"DURATION"`
+	HTTP2        bool          `arg:"--http2" help:"Use HTTP/2 if the APIC supports it"`
+
+	NDSite      string `arg:"--nd-site" help:"Connect through the Nexus Dashboard API gateway at --apic to the APIC of this site" placeholder:"SITE"`
+	NDDomain    string `arg:"--nd-domain" help:"Nexus Dashboard login domain [default: DefaultAuth]" placeholder:"DOMAIN"`
+	NDProxyPath string `arg:"--nd-proxy-path" help:"Path of the site's APIC API on Nexus Dashboard [default: /proxy/site/{site}]" placeholder:"PATH"`
+}
+
+// prompt collects any missing connection parameters.
+func (c *Connection) prompt() {
+	if c.APIC == "" {
+		c.APIC = input("APIC IP:")
+	}
+	if c.Username == "" {
+		c.Username = input("Username:")
+	}
+	if c.Password == "" {
+		fmt.Print("Password: ")
+		pwd, _ := terminal.ReadPassword(int(syscall.Stdin))
+		c.Password = string(pwd)
+	}
+}
+
+// require checks that no connection parameters are missing, for runs that
+// cannot prompt.
+func (c Connection) require() error {
+	var missing []string
+	if c.APIC == "" {
+		missing = append(missing, "--apic")
+	}
+	if c.Username == "" {
+		missing = append(missing, "--username")
+	}
+	if c.Password == "" {
+		missing = append(missing, "--password")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s; cannot prompt when running non-interactively", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CollectCmd collects data from the APIC via the API.
+type CollectCmd struct {
+	Connection
+	Output         string       `arg:"-o" help:"Output file; may contain {fabric}, {apic}, {date} and {time} [default: aci-vetr-data.zip]"`
+	SplitSensitive bool         `arg:"--split-sensitive" help:"Write sensitive operational data (endpoints, events, usernames) to a separate archive"`
+	Preset         string       `help:"Collect additional data for a purpose: upgrade-readiness"`
+	NDJSON         bool         `arg:"--ndjson" help:"Include the records as newline-delimited JSON for bulk loading"`
+	CSV            []string     `arg:"--csv" help:"Include the attributes of these classes as CSV files, e.g. fabricNode,faultInst" placeholder:"CLASS"`
+	Parquet        bool         `help:"Include a Parquet file per class for loading into a data lake"`
+	ArchiveFormat  string       `arg:"--archive-format" help:"Archive format: zip, tar.gz or tar.zst [default: zip]" placeholder:"FORMAT"`
+	Compression    string       `help:"Compression level: store, fast or best [default: balanced]" placeholder:"LEVEL"`
+	InMemory       bool         `arg:"--in-memory" help:"Build the database in memory and write it only into the archive, never to data.db"`
+	KeepDB         bool         `arg:"--keep-db" help:"Keep the raw database next to the archive as {name}.db rather than wiping it"`
+	Cleanup        bool         `help:"Remove the log file after a successful run, even if kept with --log-file"`
+	MaxArchiveSize string       `arg:"--max-archive-size" help:"Split archives larger than this into numbered parts, e.g. 25MB" placeholder:"SIZE"`
+	Upload         string       `help:"Upload archives to remote storage and remove the local copies, e.g. s3://bucket/prefix or sftp://user@host/path" placeholder:"URL"`
+	UploadURL      string       `arg:"--upload-url" help:"POST archives to an HTTPS ingestion endpoint and remove the local copies" placeholder:"URL"`
+	UploadToken    string       `arg:"--upload-token" help:"Bearer token for --upload-url" placeholder:"TOKEN"`
+	S3Endpoint     string       `arg:"--s3-endpoint" help:"S3-compatible endpoint, e.g. https://minio.local:9000 [default: AWS]" placeholder:"URL"`
+	S3SSE          string       `arg:"--s3-sse" help:"S3 server-side encryption: AES256 or aws:kms" placeholder:"SSE"`
+	S3KMSKey       string       `arg:"--s3-kms-key" help:"KMS key ID for aws:kms encryption" placeholder:"KEY"`
+	SSHKey         string       `arg:"--ssh-key" help:"SSH private key for SFTP upload [default: ~/.ssh/id_ed25519, id_ecdsa or id_rsa] and --ssh [default: password login]" placeholder:"FILE"`
+	KnownHosts     string       `arg:"--known-hosts" help:"Known hosts file for SFTP upload and --ssh host key verification [default: ~/.ssh/known_hosts]" placeholder:"FILE"`
+	NotifyWebhook  string       `arg:"--notify-webhook" help:"Slack or Microsoft Teams webhook to post a summary to when the collection finishes or fails" placeholder:"URL"`
+	MaxRequests    int          `arg:"--max-requests" help:"Concurrent requests to the APIC [default: 16]" placeholder:"N"`
+	MemoryBudget   string       `arg:"--memory-budget" help:"Memory for the records on their way from the requests to the database, e.g. 64MB" placeholder:"SIZE"`
+	TenantSubtree  bool         `arg:"--tenant-subtree" help:"Fetch tenant objects with a subtree query per tenant rather than a query per class, for policy-heavy fabrics"`
+	SkipStats      bool         `arg:"--skip-stats" help:"Leave out the health and capacity stats for a quick, config-only collection"`
+	FaultSeverity  string       `arg:"--fault-min-severity" help:"Collect the faults of this severity or more severe only: info, warning, minor, major or critical" placeholder:"SEVERITY"`
+	SkipAcked      bool         `arg:"--skip-acked-faults" help:"Leave out the acknowledged and delegated faults"`
+	History        string       `help:"Also collect the fault records of this window, e.g. 7d or 12h, including faults that have already cleared; also the window of --events, --audit-log and the rogue and moved endpoint events" placeholder:"WINDOW"`
+	Events         bool         `help:"Also collect the event records, e.g. port flaps and policy deployments, of the --history window [default: 7d]"`
+	AuditLog       bool         `arg:"--audit-log" help:"Also collect the configuration audit log of the --history window [default: 7d], to see who changed what"`
+	Endpoints      bool         `help:"Also collect the endpoint and IP tables rather than only their counts; off by default due to size"`
+	Coop           bool         `help:"Also collect the spines' COOP endpoint database, to compare with the leaves' endpoint learning"`
+	Adjacencies    bool         `help:"Also collect the ARP and IPv6 neighbor adjacencies of the nodes"`
+	Pod            int          `help:"Collect the switches, stats and faults of this pod only; policy is collected whole" placeholder:"ID"`
+	Tenant         []string     `help:"Collect the tenant policy of these tenants only, e.g. prod,dev; fabric-wide classes are collected whole" placeholder:"NAME"`
+	Record         string       `help:"Record every APIC request and response to this file, for reproducing problems" placeholder:"FILE"`
+	Replay         string       `help:"Re-run the collection from a recording rather than the APIC" placeholder:"FILE"`
+	SSH            bool         `arg:"--ssh" help:"Collect by running the icurl commands on the APIC over SSH, for when the API can't be reached"`
+	DryRun         bool         `arg:"--dry-run" help:"Report requests and estimated APIC load without collecting data"`
+	OnlyFailed     bool         `arg:"--only-failed" help:"Re-collect only the classes that failed in the collection given by --db, merging them into its data"`
+	DB             string       `arg:"--db" help:"Previous collection archive or db file for --only-failed" placeholder:"FILE"`
+	Schedule       string       `help:"Run continuously, collecting on an interval (e.g. 24h) or cron schedule (e.g. \"0 2 * * *\")"`
+	ControlAddr    string       `arg:"--control-addr" help:"Local address for pause/resume/status commands, e.g. 127.0.0.1:7777" placeholder:"ADDR"`
+	NDO            string       `arg:"--ndo" help:"Also collect sites, schemas, templates and deployment status from this Nexus Dashboard Orchestrator" placeholder:"HOST"`
+	NDOUsername    string       `arg:"--ndo-username" help:"NDO username [default: the APIC username]" placeholder:"USER"`
+	NDOPassword    string       `arg:"--ndo-password" help:"NDO password [default: the APIC password]" placeholder:"PASSWORD"`
+	NDODomain      string       `arg:"--ndo-domain" help:"Nexus Dashboard login domain [default: DefaultAuth]" placeholder:"DOMAIN"`
+	FollowUp       []FollowUp   `arg:"-" json:"followUp"` // Config file only
+	Email          *EmailConfig `arg:"-" json:"email"`    // Config file only
+	runID          string       `arg:"-"`                 // Set by the API server
+	logPath        string       `arg:"-"`                 // Log of the API run, instead of the shared log
+}
+
+// archiveLog returns the log file included in the archive.
+func (args CollectCmd) archiveLog() string {
+	if args.logPath != "" {
+		return args.logPath
+	}
+	return logPath
+}
+
+// ICurlCmd writes requests to a script to be run on the APIC, from a
+// workstation with curl or PowerShell, or as an Ansible playbook, or exports
+// them as a Postman collection.
+type ICurlCmd struct {
+	Format   string `help:"Script to write: icurl, to run on the APIC, curl or powershell, to run from a workstation, an ansible playbook, or a postman collection of the requests [default: icurl]"`
+	PageSize int    `arg:"--page-size" help:"Objects per request; larger classes are fetched in pages [default: 10000]" placeholder:"N"`
+}
+
+// CheckCmd verifies connectivity to the APIC without collecting data.
+type CheckCmd struct {
+	Connection
+}
+
+// IngestCmd converts the output of the icurl script, or an APIC
+// configuration export, to a standard archive.
+type IngestCmd struct {
+	Input        string `arg:"positional" help:"Raw data from the icurl script, e.g. aci-vetr-raw.zip"`
+	ConfigExport string `arg:"--config-export" help:"Read an APIC configuration export or snapshot, e.g. config.tar.gz, instead" placeholder:"FILE"`
+	Output       string `arg:"-o" help:"Output file [default: aci-vetr-data.zip]"`
+}
+
+// ExportCmd writes the records of a collection to per-class JSON files.
+type ExportCmd struct {
+	Input string `arg:"positional,required" help:"Collection archive or db file, e.g. data.db"`
+	Out   string `arg:"required" help:"Output directory"`
+}
+
+// JoinCmd reassembles a split archive.
+type JoinCmd struct {
+	Manifest string `arg:"positional,required" help:"Parts manifest, e.g. aci-vetr-data.zip.parts.json"`
+	Output   string `arg:"-o" help:"Output file [default: the original archive name]"`
+}
+
+// MergeCmd combines collections into a new archive.
+type MergeCmd struct {
+	Inputs []string `arg:"positional,required" help:"Collection archives or db files" placeholder:"FILE"`
+	Output string   `arg:"-o,required" help:"Output file"`
+}
+
+// QueryCmd prints records from a collection.
+type QueryCmd struct {
+	Class    string   `arg:"positional,required" help:"Class (DB prefix) to query, e.g. fvBD"`
+	DB       string   `arg:"--db" help:"Collection archive or db file [default: aci-vetr-data.zip]"`
+	DnFilter string   `arg:"--dn-filter" help:"Only records with a DN containing this string, or matching a wildcard pattern, e.g. uni/tn-prod/*"`
+	Attr     []string `help:"Attributes to print (comma-separated or repeated) [default: all]"`
+	Format   string   `help:"Output format, json or table [default: json]"`
+}
+
+// DiffCmd compares two collections.
+type DiffCmd struct {
+	Old  string `arg:"positional,required" help:"Earlier collection archive or db file"`
+	New  string `arg:"positional,required" help:"Later collection archive or db file"`
+	Keys bool   `help:"List the individual added (+), removed (-) and changed (~) records"`
+}
+
+// InspectCmd prints a summary of a collection.
+type InspectCmd struct {
+	Path string `arg:"positional,required" help:"Collection archive or db file, e.g. aci-vetr-data.zip"`
+}
+
+// ControlCmd sends a command to a running collection.
+type ControlCmd struct {
+	Command string `arg:"positional,required" help:"pause, resume or status"`
+	Addr    string `arg:"required" help:"Control address of the running collector, i.e. its --control-addr"`
+}
+
+// InstallServiceCmd installs the collector as a system service.
+type InstallServiceCmd struct {
+	Schedule string `arg:"required" help:"Collection interval (e.g. 24h) or cron schedule (e.g. \"0 2 * * *\")"`
+}
+
+// SubscribeCmd streams changes from the APIC between full collections.
+type SubscribeCmd struct {
+	Connection
+	Classes []string `help:"Classes to subscribe to (comma-separated or repeated) [default: faultInst,aaaModLR]" placeholder:"CLASS"`
+	DB      string   `arg:"--db" help:"Collection db file, kept with collect --keep-db, to merge the changes into [default: aci-vetr-data.db]"`
+}
+
+// MockAPICCmd serves canned APIC responses for demos and testing.
+type MockAPICCmd struct {
+	Data     string `arg:"positional,required" help:"Directory of {class}.json APIC responses, or a collection archive or db file"`
+	Addr     string `help:"Address to listen on [default: 127.0.0.1:8443]" placeholder:"ADDR"`
+	Username string `arg:"-u" help:"Username required to log in [default: any]"`
+	Password string `arg:"-p" help:"Password required to log in"`
+	TLSCert  string `arg:"--tls-cert" help:"TLS certificate [default: self-signed]" placeholder:"FILE"`
+	TLSKey   string `arg:"--tls-key" help:"TLS private key for --tls-cert" placeholder:"FILE"`
+}
+
+// GenerateCmd writes a synthetic collection for development and testing.
+type GenerateCmd struct {
+	Leaves  int    `help:"Number of leaf switches" default:"4" placeholder:"N"`
+	Spines  int    `help:"Number of spine switches" default:"2" placeholder:"N"`
+	Tenants int    `help:"Number of tenants, in addition to common, infra and mgmt" default:"3" placeholder:"N"`
+	EPGs    int    `arg:"--epgs" help:"Number of EPGs, spread across the tenants" default:"10" placeholder:"N"`
+	Seed    int64  `help:"Random seed; the same seed generates the same fabric" default:"1"`
+	Output  string `arg:"-o" help:"Output file [default: aci-vetr-synthetic.zip]"`
+	KeepDB  bool   `arg:"--keep-db" help:"Keep the raw database next to the archive as {name}.db"`
+}
+
+// ServeCmd runs an HTTP API for triggering collections.
+type ServeCmd struct {
+	Addr    string `help:"Address to listen on [default: 127.0.0.1:8080]" placeholder:"ADDR"`
+	Dir     string `help:"Directory for the archives and run summaries [default: runs]" placeholder:"DIR"`
+	Token   string `help:"Bearer token required on all requests [default: generated and logged]" placeholder:"TOKEN"`
+	TLSCert string `arg:"--tls-cert" help:"TLS certificate; without it credentials are sent unencrypted" placeholder:"FILE"`
+	TLSKey  string `arg:"--tls-key" help:"TLS private key for --tls-cert" placeholder:"FILE"`
+}
+
+// GUICmd runs a local web UI for collection.
+type GUICmd struct {
+	Port   int    `help:"Local port for the web UI [default: random]"`
+	Output string `arg:"-o" help:"Output file [default: aci-vetr-data.zip]"`
+}
+
+// VersionCmd prints the collector version.
+type VersionCmd struct{}
+
 // Args are command line parameters.
 type Args struct {
-	APIC        string `arg:"-a" help:"APIC hostname or IP address"`
-	Username    string `arg:"-u" help:"APIC username"`
-	Password    string `arg:"-p" help:"APIC password"`
-	Output      string `arg:"-o" help:"Output file"`
-	WriteScript bool   `help:"Write requests to icurl script"`
-	ReadRaw     string `help:"Read raw data from manually collection" placeholder:"FILE"`
+	Collect        *CollectCmd        `arg:"subcommand:collect" help:"Collect data from the APIC (default)"`
+	ICurl          *ICurlCmd          `arg:"subcommand:icurl" help:"Write requests to an icurl script to run on the APIC, or a curl, PowerShell or Ansible script or Postman collection"`
+	Check          *CheckCmd          `arg:"subcommand:check" help:"Verify connectivity and credentials without collecting data"`
+	Ingest         *IngestCmd         `arg:"subcommand:ingest" help:"Convert icurl script output or a config export to a collection archive"`
+	Inspect        *InspectCmd        `arg:"subcommand:inspect" help:"Print a summary of a collection archive"`
+	Join           *JoinCmd           `arg:"subcommand:join" help:"Reassemble a split archive"`
+	Merge          *MergeCmd          `arg:"subcommand:merge" help:"Combine collections into one archive; the newest record wins"`
+	Query          *QueryCmd          `arg:"subcommand:query" help:"Print records of a class from a collection"`
+	Export         *ExportCmd         `arg:"subcommand:export" help:"Write a collection to one JSON file per class"`
+	Diff           *DiffCmd           `arg:"subcommand:diff" help:"Compare two collections"`
+	Control        *ControlCmd        `arg:"subcommand:control" help:"Pause, resume or query a running collection"`
+	InstallService *InstallServiceCmd `arg:"subcommand:install-service" help:"Install the collector as a scheduled system service"`
+	GUI            *GUICmd            `arg:"subcommand:gui" help:"Run the collection from a local web UI"`
+	Subscribe      *SubscribeCmd      `arg:"subcommand:subscribe" help:"Stream fault and configuration changes from the APIC between collections"`
+	Generate       *GenerateCmd       `arg:"subcommand:generate" help:"Write a synthetic collection of a fabric of a given size"`
+	MockAPIC       *MockAPICCmd       `arg:"subcommand:mock-apic" help:"Serve canned APIC responses for demos and testing"`
+	Serve          *ServeCmd          `arg:"subcommand:serve" help:"Run an HTTP API that triggers collections on demand"`
+	VersionCmd     *VersionCmd        `arg:"subcommand:version" help:"Print the collector version"`
+	Config         string             `arg:"-c" help:"JSON config file; command line parameters take precedence" placeholder:"FILE"`
+	NonInteractive bool               `arg:"--non-interactive" help:"Never prompt for input or wait for enter before exiting; implied when stdin is not a terminal"`
+	Quiet          bool               `arg:"-q" help:"Only print warnings, errors and the archive path to the console; the log file is unchanged"`
+	Verbose        bool               `arg:"-v" help:"Print debug messages, including request URLs and timings, to the console"`
+	Debug          bool               `help:"Same as --verbose"`
+	LogFormat      string             `arg:"--log-format" help:"Console log format: text or json [default: text]" placeholder:"FORMAT"`
+	LogFile        string             `arg:"--log-file" help:"Log file; kept after the run [default: aci-vetr-c.log]" placeholder:"FILE"`
+	LogMaxSize     string             `arg:"--log-max-size" help:"Rotate the log file when larger than this, e.g. 10MB; requires --log-keep" placeholder:"SIZE"`
+	LogMaxAge      time.Duration      `arg:"--log-max-age" help:"Remove rotated log files older than this, e.g. 168h" placeholder:"AGE"`
+	LogKeep        int                `arg:"--log-keep" help:"Number of rotated log files to keep; the log is kept after the run" placeholder:"N"`
+	Syslog         string             `help:"Forward info and higher log messages to a syslog server, e.g. udp://host:514, tcp://host:601 or tls://host:6514" placeholder:"URL"`
+	PprofCPU       string             `arg:"--pprof-cpu" help:"Write a CPU profile to this file" placeholder:"FILE"`
+	PprofMem       string             `arg:"--pprof-mem" help:"Write a heap profile to this file on exit" placeholder:"FILE"`
+	PprofAddr      string             `arg:"--pprof-addr" help:"Serve live profiles on this local address, e.g. 127.0.0.1:6060" placeholder:"ADDR"`
+	logRotation    logRotation        `arg:"-"`
+}
+
+// keepLog checks whether the log file is kept after the run, rather than only
+// included in the archive.
+func (a Args) keepLog() bool {
+	return a.LogFile != "" || a.LogKeep > 0
+}
+
+// removeLog checks whether the log file is removed on exit. With --cleanup
+// it's removed even if kept otherwise, but only after a successful run, so
+// failures can still be investigated.
+func (a Args) removeLog(err error) bool {
+	if a.Collect != nil && a.Collect.Cleanup {
+		return err == nil || isPartial(err)
+	}
+	return !a.keepLog()
+}
+
+// interactive checks whether the user can be prompted for input.
+func (a Args) interactive() bool {
+	return !a.NonInteractive && terminal.IsTerminal(int(syscall.Stdin))
 }
 
 // Description is the CLI description string.
@@ -39,25 +327,317 @@ func (Args) Version() string {
 	return "version " + version
 }
 
+// readConfig reads parameters from a JSON config file, e.g.
+//
+//	{"apic": "10.0.0.1,10.0.0.2", "username": "admin", "password": "secret"}
+//
+// Keys are the parameter field names, matched case-insensitively.
+func readConfig(path string, dest interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+	if err := json.Unmarshal(b, dest); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// mergeConfig sets fields in dest that weren't set on the command line to the
+// value from the config file.
+func mergeConfig(dest, config reflect.Value) {
+	for i := 0; i < dest.NumField(); i++ {
+		field := dest.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			mergeConfig(field, config.Field(i))
+			continue
+		}
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			field.Set(config.Field(i))
+		}
+	}
+}
+
+// applyConfig merges the config file into the subcommand parameters.
+func applyConfig(path string, cmd interface{}) error {
+	dest := reflect.ValueOf(cmd).Elem()
+	config := reflect.New(dest.Type())
+	if err := readConfig(path, config.Interface()); err != nil {
+		return err
+	}
+	mergeConfig(dest, config.Elem())
+	return nil
+}
+
+// validTenant matches the names the APIC allows for a tenant.
+var validTenant = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// parseWindow parses a time window in days, e.g. 7d, or as a duration, e.g.
+// 12h.
+func parseWindow(s string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q, expected e.g. 7d or 12h", s)
+	}
+	return d, nil
+}
+
+// splitList splits comma-separated values, e.g. --attr dn,name.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// withCollect adds the collect subcommand to command line arguments without a
+// subcommand, e.g. -a apic -u admin, as the collect flags are only accepted
+// after it. Asking for the help or version alone is left as is.
+func withCollect(flags []string) []string {
+	commands := make(map[string]bool)
+	t := reflect.TypeOf(Args{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("arg"); strings.HasPrefix(tag, "subcommand:") {
+			commands[strings.TrimPrefix(tag, "subcommand:")] = true
+		}
+	}
+	informational := len(flags) > 0
+	for _, flag := range flags {
+		if commands[flag] {
+			return flags
+		}
+		switch flag {
+		case "-h", "--help", "--version":
+		default:
+			informational = false
+		}
+	}
+	if informational {
+		return flags
+	}
+	return append([]string{"collect"}, flags...)
+}
+
 // NewArgs collects the CLI args and creates a new 'Args'.
+// Running without a subcommand is equivalent to collect.
 func newArgs() (Args, error) {
-	args := Args{Output: resultZip}
-	arg.MustParse(&args)
+	args := Args{}
+	os.Args = append(os.Args[:1:1], withCollect(os.Args[1:])...)
+	p := arg.MustParse(&args)
+	if args.Config != "" {
+		switch cmd := p.Subcommand().(type) {
+		case *CollectCmd, *CheckCmd, *IngestCmd, *ControlCmd, *SubscribeCmd, *ServeCmd:
+			if err := applyConfig(args.Config, cmd); err != nil {
+				return args, err
+			}
+		}
+	}
 
-	switch {
-	case args.WriteScript || args.ReadRaw != "":
-		return args, nil
+	switch args.LogFormat {
+	case "", "text", "json":
 	default:
-		if args.APIC == "" {
-			args.APIC = input("APIC IP:")
+		return args, fmt.Errorf("unknown log format %q, expected text or json", args.LogFormat)
+	}
+	args.logRotation = logRotation{maxAge: args.LogMaxAge, keep: args.LogKeep}
+	if args.LogMaxSize != "" {
+		size, err := parseSize(args.LogMaxSize)
+		if err != nil {
+			return args, err
+		}
+		args.logRotation.maxSize = size
+	}
+
+	switch {
+	case args.Collect != nil:
+		if args.Collect.Output == "" {
+			args.Collect.Output = resultZip
+		}
+		if err := validateTemplate(args.Collect.Output); err != nil {
+			return args, err
+		}
+		if args.Collect.ArchiveFormat != "" {
+			output, err := withArchiveFormat(args.Collect.Output, args.Collect.ArchiveFormat)
+			if err != nil {
+				return args, err
+			}
+			args.Collect.Output = output
+		}
+		if _, ok := collector.CompressionLevels[args.Collect.Compression]; args.Collect.Compression != "" && !ok {
+			return args, fmt.Errorf("unknown compression level %q, expected store, fast or best", args.Collect.Compression)
+		}
+		if args.Collect.MaxArchiveSize != "" {
+			if _, err := parseSize(args.Collect.MaxArchiveSize); err != nil {
+				return args, err
+			}
+		}
+		args.Collect.CSV = splitList(args.Collect.CSV)
+		if args.Collect.OnlyFailed && args.Collect.DB == "" {
+			return args, errors.New("--only-failed requires --db with the previous collection")
+		}
+		if args.Collect.KeepDB && args.Collect.InMemory {
+			return args, errors.New("--keep-db cannot be used with --in-memory")
+		}
+		if args.Collect.KeepDB && args.Collect.Cleanup {
+			return args, errors.New("--keep-db cannot be used with --cleanup")
+		}
+		if args.Collect.Record != "" && args.Collect.Replay != "" {
+			return args, errors.New("--record cannot be used with --replay")
+		}
+		if args.Collect.NDOUsername != "" && args.Collect.NDOPassword == "" {
+			return args, errors.New("--ndo-username requires --ndo-password")
+		}
+		if args.Collect.NDO != "" && args.Collect.Replay != "" {
+			return args, errors.New("--ndo cannot be used with --replay; NDO requests are not recorded")
+		}
+		if severity := args.Collect.FaultSeverity; severity != "" {
+			known := false
+			for _, s := range collector.FaultSeverities {
+				known = known || s == severity
+			}
+			if !known {
+				return args, fmt.Errorf("unknown fault severity %q, expected info, warning, minor, major or critical", severity)
+			}
+		}
+		if args.Collect.ControlAddr != "" {
+			if err := checkLoopback(args.Collect.ControlAddr); err != nil {
+				return args, err
+			}
+		}
+		// Rejected before authenticating to the APIC, where the requests are built
+		if _, err := presetRequests(args.Collect.Preset); err != nil {
+			return args, err
+		}
+		if args.Collect.History != "" {
+			if _, err := parseWindow(args.Collect.History); err != nil {
+				return args, err
+			}
+		}
+		if args.Collect.Pod < 0 {
+			return args, errors.New("--pod must be a pod ID, e.g. 1")
+		}
+		args.Collect.Tenant = splitList(args.Collect.Tenant)
+		for _, name := range args.Collect.Tenant {
+			if !validTenant.MatchString(name) {
+				return args, fmt.Errorf("invalid tenant name %q", name)
+			}
+		}
+		if args.Collect.SSH {
+			for flag, set := range map[string]bool{
+				"--replay":             args.Collect.Replay != "",
+				"--record":             args.Collect.Record != "",
+				"--dry-run":            args.Collect.DryRun,
+				"--only-failed":        args.Collect.OnlyFailed,
+				"--nd-site":            args.Collect.NDSite != "",
+				"--skip-stats":         args.Collect.SkipStats,
+				"--fault-min-severity": args.Collect.FaultSeverity != "",
+				"--skip-acked-faults":  args.Collect.SkipAcked,
+				"--history":            args.Collect.History != "",
+				"--events":             args.Collect.Events,
+				"--audit-log":          args.Collect.AuditLog,
+				"--endpoints":          args.Collect.Endpoints,
+				"--coop":               args.Collect.Coop,
+				"--adjacencies":        args.Collect.Adjacencies,
+				"--pod":                args.Collect.Pod != 0,
+				"--tenant":             len(args.Collect.Tenant) > 0,
+				"--schedule":           args.Collect.Schedule != "",
+			} {
+				if set {
+					return args, fmt.Errorf("--ssh cannot be used with %s", flag)
+				}
+			}
+		}
+		if args.Collect.Replay != "" {
+			// The APIC and credentials aren't needed to replay
+			return args, nil
+		}
+		if !args.interactive() {
+			return args, args.Collect.require()
+		}
+		args.Collect.prompt()
+	case args.Check != nil:
+		if !args.interactive() {
+			return args, args.Check.require()
+		}
+		args.Check.prompt()
+	case args.Subscribe != nil:
+		if args.Subscribe.NDSite != "" {
+			return args, errors.New("subscribe cannot connect through Nexus Dashboard")
+		}
+		args.Subscribe.Classes = splitList(args.Subscribe.Classes)
+		if len(args.Subscribe.Classes) == 0 {
+			args.Subscribe.Classes = defaultSubscriptions
+		}
+		if args.Subscribe.DB == "" {
+			args.Subscribe.DB = keptDBPath(resultZip)
+		}
+		if isArchive(args.Subscribe.DB) || isParts(args.Subscribe.DB) {
+			return args, fmt.Errorf("cannot merge changes into archive %s; collect with --keep-db and subscribe with the kept db file", args.Subscribe.DB)
+		}
+		if !args.interactive() {
+			return args, args.Subscribe.require()
+		}
+		args.Subscribe.prompt()
+	case args.Ingest != nil:
+		switch {
+		case args.Ingest.Input == "" && args.Ingest.ConfigExport == "":
+			return args, errors.New("input or --config-export is required")
+		case args.Ingest.Input != "" && args.Ingest.ConfigExport != "":
+			return args, errors.New("--config-export cannot be used with an input")
+		}
+		if args.Ingest.Output == "" {
+			args.Ingest.Output = resultZip
+		}
+	case args.Query != nil:
+		if args.Query.DB == "" {
+			args.Query.DB = resultZip
+		}
+		args.Query.Attr = splitList(args.Query.Attr)
+	case args.GUI != nil:
+		if args.GUI.Output == "" {
+			args.GUI.Output = resultZip
+		}
+	case args.Generate != nil:
+		if args.Generate.Output == "" {
+			args.Generate.Output = syntheticZip
+		}
+	case args.MockAPIC != nil:
+		if args.MockAPIC.Addr == "" {
+			args.MockAPIC.Addr = "127.0.0.1:8443"
+		}
+		if (args.MockAPIC.TLSCert == "") != (args.MockAPIC.TLSKey == "") {
+			return args, errors.New("--tls-cert and --tls-key must be used together")
+		}
+	case args.Serve != nil:
+		if args.Serve.Addr == "" {
+			args.Serve.Addr = "127.0.0.1:8080"
+		}
+		if args.Serve.Dir == "" {
+			args.Serve.Dir = "runs"
 		}
-		if args.Username == "" {
-			args.Username = input("Username:")
+		if (args.Serve.TLSCert == "") != (args.Serve.TLSKey == "") {
+			return args, errors.New("--tls-cert and --tls-key must be used together")
 		}
-		if args.Password == "" {
-			fmt.Print("Password: ")
-			pwd, _ := terminal.ReadPassword(int(syscall.Stdin))
-			args.Password = string(pwd)
+	case args.InstallService != nil:
+		if args.Config == "" {
+			return args, errors.New("install-service requires --config with the APIC connection parameters")
 		}
 	}
 	return args, nil
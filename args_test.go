@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyConfig(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	config := `{"apic": "apic1,apic2", "username": "admin", "password": "secret", "schedule": "24h"}`
+	a.NoError(ioutil.WriteFile(path, []byte(config), 0600))
+
+	cmd := &CollectCmd{Connection: Connection{Username: "cli-user"}}
+	a.NoError(applyConfig(path, cmd))
+	a.Equal("apic1,apic2", cmd.APIC)
+	a.Equal("cli-user", cmd.Username)
+	a.Equal("secret", cmd.Password)
+	a.Equal("24h", cmd.Schedule)
+}
+
+func TestSplitList(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{"dn", "name", "descr"}, splitList([]string{"dn, name", "descr", ""}))
+	a.Nil(splitList(nil))
+}
+
+func TestWithCollect(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{"collect"}, withCollect(nil))
+	a.Equal([]string{"collect", "-a", "1.2.3.4", "-u", "admin", "--non-interactive"},
+		withCollect([]string{"-a", "1.2.3.4", "-u", "admin", "--non-interactive"}))
+	a.Equal([]string{"-v", "check", "-a", "1.2.3.4"}, withCollect([]string{"-v", "check", "-a", "1.2.3.4"}))
+	a.Equal([]string{"--help"}, withCollect([]string{"--help"}))
+	a.Equal([]string{"collect", "-a", "1.2.3.4", "--help"}, withCollect([]string{"-a", "1.2.3.4", "--help"}))
+}
+
+func TestParseWindow(t *testing.T) {
+	a := assert.New(t)
+	d, err := parseWindow("7d")
+	a.NoError(err)
+	a.Equal(7*24*time.Hour, d)
+	d, err = parseWindow("12h")
+	a.NoError(err)
+	a.Equal(12*time.Hour, d)
+	for _, s := range []string{"", "d", "-1d", "0h", "week"} {
+		_, err = parseWindow(s)
+		a.Error(err, s)
+	}
+}
+
+func TestConnectionRequire(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(Connection{APIC: "apic", Username: "admin", Password: "secret"}.require())
+	err := Connection{APIC: "apic"}.require()
+	a.EqualError(err, "missing --username, --password; cannot prompt when running non-interactively")
+}
+
+func TestRemoveLog(t *testing.T) {
+	a := assert.New(t)
+	a.True(Args{}.removeLog(nil))
+	a.False(Args{LogFile: "collect.log"}.removeLog(nil))
+
+	cleanup := Args{LogFile: "collect.log", Collect: &CollectCmd{Cleanup: true}}
+	a.True(cleanup.removeLog(nil))
+	a.True(cleanup.removeLog(exitError{exitPartial, errors.New("1 classes failed")}))
+	a.False(cleanup.removeLog(exitError{exitArchive, errors.New("failed verification")}))
+}
+
+func TestArchiveLog(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(logPath, CollectCmd{}.archiveLog())
+	a.Equal("runs/aci-vetr-c-1.log", CollectCmd{logPath: "runs/aci-vetr-c-1.log"}.archiveLog())
+}
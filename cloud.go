@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"aci-vetr-c/collector"
+)
+
+// cloudVendor returns the cloud provider a Cloud APIC manages, e.g. aws or
+// azure, or "" for an on-premises APIC.
+func cloudVendor(client collector.Getter) (string, error) {
+	res, err := client.Get("/api/class/cloudProvP")
+	if err != nil {
+		return "", fmt.Errorf("cannot query cloud provider: %v", err)
+	}
+	return res.Get("imdata.0.cloudProvP.attributes.vendor").Str, nil
+}
+
+// cloudRequests returns the Cloud APIC requests plus those of the registered
+// plugins. Presets target on-premises fabrics and don't apply.
+func cloudRequests() []*collector.Request {
+	reqs := collector.CloudRequests()
+	return append(reqs, collector.PluginRequests(reqs)...)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// cloudGetter returns the cloud provider profile, or an error for releases
+// without the class.
+type cloudGetter struct {
+	body string
+	err  error
+}
+
+func (g cloudGetter) Get(path string, mods ...collector.Mod) (gjson.Result, error) {
+	return gjson.Parse(g.body), g.err
+}
+
+func TestCloudVendor(t *testing.T) {
+	a := assert.New(t)
+	vendor, err := cloudVendor(cloudGetter{body: `{"imdata":[{"cloudProvP":{"attributes":{"vendor":"aws"}}}]}`})
+	a.NoError(err)
+	a.Equal("aws", vendor)
+
+	vendor, err = cloudVendor(cloudGetter{body: `{"imdata":[]}`})
+	a.NoError(err)
+	a.Equal("", vendor)
+
+	_, err = cloudVendor(cloudGetter{err: errors.New("unknown class")})
+	a.Error(err)
+}
+
+func TestCloudRequests(t *testing.T) {
+	a := assert.New(t)
+	prefixes := make(map[string]bool)
+	for _, req := range cloudRequests() {
+		a.False(prefixes[req.Prefix], req.Prefix)
+		prefixes[req.Prefix] = true
+	}
+	a.True(prefixes["cloudEPg"])
+	a.True(prefixes["hcloudCtx"])
+	a.False(prefixes["fvBD"])
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mholt/archiver/v3"
+)
+
+// CompressionLevels are the archive compression levels by name.
+var CompressionLevels = map[string]int{
+	"store": flate.NoCompression,
+	"fast":  flate.BestSpeed,
+	"best":  flate.BestCompression,
+}
+
+// NewArchiver returns the archiver for the format of a path, at the given
+// compression level. The level isn't configurable for tar.zst archives.
+func NewArchiver(path, compression string) (archiver.Archiver, error) {
+	a, err := archiver.ByExtension(path)
+	if err != nil {
+		return nil, err
+	}
+	if compression == "" {
+		return a.(archiver.Archiver), nil
+	}
+	level, ok := CompressionLevels[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression level %q, expected store, fast or best", compression)
+	}
+	switch a := a.(type) {
+	case *archiver.Zip:
+		a.CompressionLevel = level
+		if level == flate.NoCompression {
+			a.FileMethod = archiver.Store
+		}
+	case *archiver.TarGz:
+		a.CompressionLevel = level
+	}
+	return a.(archiver.Archiver), nil
+}
+
+// memFile is the file info of an archive member held in memory.
+type memFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f memFile) Name() string       { return f.name }
+func (f memFile) Size() int64        { return f.size }
+func (f memFile) Mode() os.FileMode  { return 0644 }
+func (f memFile) ModTime() time.Time { return f.modTime }
+func (f memFile) IsDir() bool        { return false }
+func (f memFile) Sys() interface{}   { return nil }
+
+// OpenMember opens an archive member, from memory if its name is in
+// inMemory, otherwise from disk.
+func OpenMember(path string, inMemory map[string][]byte) (io.ReadCloser, os.FileInfo, error) {
+	if b, ok := inMemory[path]; ok {
+		info := memFile{name: filepath.Base(path), size: int64(len(b)), modTime: time.Now()}
+		return ioutil.NopCloser(bytes.NewReader(b)), info, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// CreateArchive streams members into a new archive, reading those in
+// inMemory from memory so they never touch disk.
+func CreateArchive(out string, members []string, inMemory map[string][]byte, compression string) error {
+	a, err := NewArchiver(out, compression)
+	if err != nil {
+		return err
+	}
+	w, ok := a.(archiver.Writer)
+	if !ok {
+		return fmt.Errorf("cannot stream to %s", out)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := w.Create(f); err != nil {
+		return err
+	}
+	for _, member := range members {
+		r, info, err := OpenMember(member, inMemory)
+		if err != nil {
+			w.Close()
+			return err
+		}
+		err = w.Write(archiver.File{FileInfo: info, ReadCloser: r})
+		r.Close()
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"compress/flate"
+	"testing"
+
+	"github.com/mholt/archiver/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewArchiver(t *testing.T) {
+	a := assert.New(t)
+	z, err := NewArchiver("data.zip", "store")
+	if a.NoError(err) {
+		a.Equal(archiver.Store, z.(*archiver.Zip).FileMethod)
+	}
+	tgz, err := NewArchiver("data.tar.gz", "best")
+	if a.NoError(err) {
+		a.Equal(flate.BestCompression, tgz.(*archiver.TarGz).CompressionLevel)
+	}
+	z, err = NewArchiver("data.zip", "")
+	if a.NoError(err) {
+		a.Equal(flate.DefaultCompression, z.(*archiver.Zip).CompressionLevel)
+	}
+	_, err = NewArchiver("data.zip", "max")
+	a.Error(err)
+}
@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+)
+
+// RecordKey returns the db key for a record, i.e. prefix:dn. Records without
+// a DN, e.g. from count and stats queries, are keyed by their index instead,
+// e.g. prefix:#3, and ok is false.
+func RecordKey(prefix string, i int, record gjson.Result) (key string, ok bool) {
+	if dn := record.Get("dn").Str; dn != "" {
+		return prefix + ":" + dn, true
+	}
+	return fmt.Sprintf("%s:#%d", prefix, i), false
+}
+
+// WriteRecords writes the records of each class to a db, keyed by RecordKey.
+func WriteRecords(db *buntdb.DB, responses map[string]goaci.Res, log zerolog.Logger) error {
+	w := NewWriter(db, Limits{}, log)
+	for prefix, res := range responses {
+		if err := w.Write(prefix, res.Array()); err != nil {
+			break
+		}
+	}
+	return w.Close()
+}
+
+// Writer is a Sink that writes the records of a fetch to a db, keyed by
+// RecordKey, from a single goroutine. The batches wait in a queue as long as
+// the limit on concurrent requests, so with the batches being decoded, the
+// records in flight stay within the memory budget however large the
+// responses. A failed write fails the writes that follow.
+type Writer struct {
+	db      *buntdb.DB
+	log     zerolog.Logger
+	ops     chan writeOp
+	done    chan struct{}
+	close   sync.Once
+	mu      sync.Mutex
+	err     error          // The first failed write
+	counts  map[string]int // Records per class, for the index keys
+	missing map[string]int // Records per class without a DN
+}
+
+// writeOp is a batch of records to write or a class to drop. With flushed
+// set, it's a request to be told once the operations before it are done.
+type writeOp struct {
+	prefix  string
+	records []goaci.Res
+	drop    bool
+	flushed chan struct{}
+}
+
+// NewWriter returns a Writer to a db, with a queue sized by the limits. It
+// must be closed to stop its goroutine.
+func NewWriter(db *buntdb.DB, limits Limits, log zerolog.Logger) *Writer {
+	w := &Writer{
+		db:      db,
+		log:     log,
+		ops:     make(chan writeOp, limits.concurrency()),
+		done:    make(chan struct{}),
+		counts:  make(map[string]int),
+		missing: make(map[string]int),
+	}
+	go w.run()
+	return w
+}
+
+// run writes the queued operations to the db until the queue is closed.
+func (w *Writer) run() {
+	defer close(w.done)
+	for op := range w.ops {
+		var err error
+		switch {
+		case op.flushed != nil:
+			close(op.flushed)
+		case w.failed() != nil:
+			// Skip the rest once a write fails
+		case op.drop:
+			err = w.drop(op.prefix)
+		default:
+			err = w.write(op.prefix, op.records)
+		}
+		if err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+		}
+	}
+}
+
+// failed returns the error of the first failed write, if any.
+func (w *Writer) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Write queues a batch of records, waiting while the queue is full. It
+// returns the error of an earlier failed write.
+func (w *Writer) Write(prefix string, records []goaci.Res) error {
+	if err := w.failed(); err != nil {
+		return err
+	}
+	w.ops <- writeOp{prefix: prefix, records: records}
+	return nil
+}
+
+// Drop queues the removal of a class's records.
+func (w *Writer) Drop(prefix string) error {
+	if err := w.failed(); err != nil {
+		return err
+	}
+	w.ops <- writeOp{prefix: prefix, drop: true}
+	return nil
+}
+
+// Flush waits for the queued operations to be written to the db.
+func (w *Writer) Flush() error {
+	flushed := make(chan struct{})
+	w.ops <- writeOp{flushed: flushed}
+	<-flushed
+	return w.failed()
+}
+
+// Counts returns the number of records written per class, other than those
+// still queued; see Flush.
+func (w *Writer) Counts() map[string]int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	counts := make(map[string]int)
+	for prefix, n := range w.counts {
+		counts[prefix] = n
+	}
+	return counts
+}
+
+// Close writes the queued operations and stops the writer, logging the
+// classes with records stored by index. Closing it again does nothing.
+func (w *Writer) Close() error {
+	w.close.Do(func() {
+		close(w.ops)
+		<-w.done
+		for prefix, missing := range w.missing {
+			if missing > 0 {
+				w.log.Warn().Str("resource", prefix).Int("records", missing).
+					Msg("records without a DN; storing them by index")
+			}
+		}
+	})
+	return w.failed()
+}
+
+// write writes a batch of records in a transaction.
+func (w *Writer) write(prefix string, records []goaci.Res) error {
+	w.mu.Lock()
+	n, missing := w.counts[prefix], 0
+	w.mu.Unlock()
+	if len(records) > 0 {
+		if err := w.db.Update(func(tx *buntdb.Tx) error {
+			for _, record := range records {
+				key, ok := RecordKey(prefix, n, record)
+				if !ok {
+					missing++
+				}
+				if _, _, err := tx.Set(key, record.Raw, nil); err != nil {
+					return fmt.Errorf("cannot set key: %v", err)
+				}
+				n++
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("cannot write to DB file: %v", err)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.counts[prefix] = n
+	w.missing[prefix] += missing
+	return nil
+}
+
+// drop deletes the records of a class.
+func (w *Writer) drop(prefix string) error {
+	w.mu.Lock()
+	delete(w.counts, prefix)
+	delete(w.missing, prefix)
+	w.mu.Unlock()
+	if err := w.db.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		if err := tx.AscendKeys(prefix+":*", func(key, _ string) bool {
+			keys = append(keys, key)
+			return true
+		}); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot delete from DB file: %v", err)
+	}
+	return nil
+}
+
+// ReadRecords reads the records of the given classes from a db written by a
+// Writer, or of every class if none are given. Classes without records are
+// left out.
+func ReadRecords(db *buntdb.DB, prefixes ...string) (map[string]goaci.Res, error) {
+	records := make(map[string][]string)
+	add := func(key, value string) bool {
+		if i := strings.Index(key, ":"); i > 0 {
+			records[key[:i]] = append(records[key[:i]], value)
+		}
+		return true
+	}
+	if err := db.View(func(tx *buntdb.Tx) error {
+		if len(prefixes) == 0 {
+			return tx.Ascend("", add)
+		}
+		for _, prefix := range prefixes {
+			if err := tx.AscendKeys(prefix+":*", add); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("cannot read DB file: %v", err)
+	}
+	responses := make(map[string]goaci.Res)
+	for prefix, raw := range records {
+		responses[prefix] = gjson.Parse("[" + strings.Join(raw, ",") + "]")
+	}
+	return responses, nil
+}
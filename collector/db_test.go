@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+)
+
+func TestWriter(t *testing.T) {
+	a := assert.New(t)
+	var buf bytes.Buffer
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	w := NewWriter(db, Limits{Requests: 1}, zerolog.New(&buf))
+	a.NoError(w.Write("fvBD", gjson.Parse(`[{"dn": "uni/tn-a/BD-one"}]`).Array()))
+	a.NoError(w.Write("fvBD", gjson.Parse(`[{"dn": "uni/tn-a/BD-two"}]`).Array()))
+	// Records without a DN are keyed by their index in the class
+	a.NoError(w.Write("eqptcapacityL2TotalUsage5min", gjson.Parse(`[{"totalCum": "1"}, {"totalCum": "2"}]`).Array()))
+	a.NoError(w.Write("fvCtx", nil))
+	a.NoError(w.Write("faultInst", gjson.Parse(`[{"dn": "topology/pod-1/node-101/fault-F0532"}]`).Array()))
+	a.NoError(w.Drop("faultInst"))
+	a.NoError(w.Close())
+	a.Equal(map[string]int{"fvBD": 2, "eqptcapacityL2TotalUsage5min": 2, "fvCtx": 0}, w.Counts())
+	a.Contains(buf.String(), "records without a DN")
+
+	responses, err := ReadRecords(db)
+	if a.NoError(err) {
+		a.Len(responses, 2)
+		a.Equal([]interface{}{"uni/tn-a/BD-one", "uni/tn-a/BD-two"}, responses["fvBD"].Get("#.dn").Value())
+	}
+	db.View(func(tx *buntdb.Tx) error {
+		value, err := tx.Get("eqptcapacityL2TotalUsage5min:#1")
+		a.NoError(err)
+		a.Equal(`{"totalCum": "2"}`, value)
+		return nil
+	})
+	responses, err = ReadRecords(db, "fvBD", "faultInst")
+	if a.NoError(err) {
+		a.Equal([]string{"fvBD"}, keys(responses))
+	}
+}
+
+func TestWriterFailed(t *testing.T) {
+	a := assert.New(t)
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	w := NewWriter(db, Limits{}, zerolog.New(&bytes.Buffer{}))
+	a.NoError(w.Write("fvBD", gjson.Parse(`[{"dn": "uni/tn-a/BD-one"}]`).Array()))
+	a.NoError(w.Flush())
+
+	// A failed write fails the writes that follow
+	db.Close()
+	a.NoError(w.Write("fvBD", gjson.Parse(`[{"dn": "uni/tn-a/BD-two"}]`).Array()))
+	a.EqualError(w.Flush(), "cannot write to DB file: database closed")
+	a.Error(w.Write("fvCtx", nil))
+	a.Equal(map[string]int{"fvBD": 1}, w.Counts())
+	a.Error(w.Close())
+}
+
+// keys returns the classes of the responses.
+func keys(responses map[string]goaci.Res) []string {
+	var prefixes []string
+	for prefix := range responses {
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
@@ -0,0 +1,30 @@
+// Package collector collects the class queries of the ACI vetR collector from
+// an APIC and stores them for a vetR analysis, for use by other tools that
+// run the collection themselves rather than through the aci-vetr-c CLI.
+//
+// A collection logs in to the APIC and fetches the request catalog, writing
+// the records to a buntdb database as they're decoded, then archives it:
+//
+//	log := zerolog.New(os.Stderr)
+//	pool := collector.NewPool([]string{"apic1"}, "admin", "password", log)
+//	if err := pool.Login(); err != nil {
+//		return err
+//	}
+//	db, err := buntdb.Open("data.db")
+//	if err != nil {
+//		return err
+//	}
+//	w := collector.NewWriter(db, collector.Limits{}, log)
+//	reqs := collector.WithDefaults(collector.Requests())
+//	if err := collector.FetchTo(pool, reqs, collector.Limits{}, w, log); err != nil {
+//		return err
+//	}
+//	if err := w.Close(); err != nil {
+//		return err
+//	}
+//	db.Close()
+//	return collector.CreateArchive("aci-vetr-data.zip", []string{"data.db"}, nil, "")
+//
+// FetchTo only fails if every request fails; the failed and unsupported classes
+// are reported by FailedClasses and SkippedClasses.
+package collector
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FaultSeverities are the fault severities, from the least severe.
+var FaultSeverities = []string{"info", "warning", "minor", "major", "critical"}
+
+// ForFaultSeverity restricts the fault requests to faults of the severity
+// or more severe, e.g. major and critical for major.
+func ForFaultSeverity(reqs []*Request, severity string) []*Request {
+	var filters []string
+	for i, s := range FaultSeverities {
+		if s == severity {
+			for _, s := range FaultSeverities[i:] {
+				filters = append(filters, fmt.Sprintf(`eq(faultInst.severity,"%s")`, s))
+			}
+		}
+	}
+	if len(filters) == 0 {
+		return reqs
+	}
+	filter := filters[0]
+	if len(filters) > 1 {
+		filter = "or(" + strings.Join(filters, ",") + ")"
+	}
+	for _, req := range reqs {
+		if req.Class == "faultInst" {
+			req.Mods = andFilter(req, filter)
+		}
+	}
+	return reqs
+}
+
+// WithoutAckedFaults leaves the acknowledged and delegated faults out of the
+// fault requests, e.g. legacy faults that were acknowledged long ago.
+func WithoutAckedFaults(reqs []*Request) []*Request {
+	for _, req := range reqs {
+		if req.Class == "faultInst" {
+			req.Mods = andFilter(req, `and(ne(faultInst.ack,"yes"),ne(faultInst.delegated,"yes"))`)
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestForFaultSeverity(t *testing.T) {
+	a := assert.New(t)
+	reqs := ForFaultSeverity(WithDefaults([]*Request{{Class: "faultInst"}, {Class: "fvBD"}}), "major")
+	a.Equal([]string{
+		`or(eq(faultInst.severity,"major"),eq(faultInst.severity,"critical"))`,
+		"",
+	}, shardFilters(reqs))
+
+	// The node shards keep the filter
+	reqs = ForFaultSeverity(WithDefaults([]*Request{{Class: "faultInst", Shard: ShardNode}}), "critical")
+	shards := shardRequests(reqs[0], map[string]goaci.Res{
+		"topSystem": gjson.Parse(`[{"dn": "topology/pod-1/node-101/sys"}]`),
+	})
+	a.Equal(`and(eq(faultInst.severity,"critical"),wcard(faultInst.dn,"^topology/pod-1/node-101/"))`, shardFilters(shards)[0])
+
+	// Unknown severities are left to the caller to reject
+	reqs = ForFaultSeverity(WithDefaults([]*Request{{Class: "faultInst"}}), "cleared")
+	a.Equal([]string{""}, shardFilters(reqs))
+}
+
+func TestWithoutAckedFaults(t *testing.T) {
+	a := assert.New(t)
+	reqs := WithoutAckedFaults(ForFaultSeverity(WithDefaults([]*Request{{Class: "faultInst"}, {Class: "fvBD"}}), "critical"))
+	a.Equal([]string{
+		`and(eq(faultInst.severity,"critical"),and(ne(faultInst.ack,"yes"),ne(faultInst.delegated,"yes")))`,
+		"",
+	}, shardFilters(reqs))
+}
+
+func TestFaultHistory(t *testing.T) {
+	a := assert.New(t)
+	req := FaultHistory(24 * time.Hour)
+	a.Equal("faultRecord", req.Prefix)
+	a.Equal("/api/class/faultRecord", req.Path)
+	a.Contains(shardFilters([]*Request{req})[0], `gt(faultRecord.created,"`)
+
+	// Event records may identify users and hosts
+	req = EventHistory(24 * time.Hour)
+	a.Equal("eventRecord", req.Prefix)
+	a.True(req.Sensitive)
+	a.Contains(shardFilters([]*Request{req})[0], `gt(eventRecord.created,"`)
+	a.True(AuditHistory(time.Hour).Sensitive)
+}
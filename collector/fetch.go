@@ -0,0 +1,339 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/tidwall/gjson"
+	"golang.org/x/sync/errgroup"
+)
+
+// Getter makes API GET requests, e.g. a goaci.Client or a Pool.
+type Getter interface {
+	Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error)
+}
+
+// Planner is implemented by a Getter that reports progress, to be told of the
+// requests about to be made, e.g. the shards of a class.
+type Planner interface {
+	Plan(n int)
+}
+
+// plan tells the client of the requests about to be made, if it's a Planner.
+func plan(client Getter, n int) {
+	if p, ok := client.(Planner); ok {
+		p.Plan(n)
+	}
+}
+
+// APIC error texts for a class it doesn't know, in lower case.
+var unknownClassErrors = []string{"unresolved class", "unknown class"}
+
+// IsUnsupportedClass checks whether a request failed because the APIC doesn't
+// know the class, e.g. a class introduced in a newer release. Other client
+// errors, e.g. an invalid filter, are failures.
+func IsUnsupportedClass(err error) bool {
+	e, ok := err.(*APIError)
+	if !ok || (e.Status != http.StatusBadRequest && e.Status != http.StatusNotFound) {
+		return false
+	}
+	text := strings.ToLower(e.Text)
+	for _, unknown := range unknownClassErrors {
+		if strings.Contains(text, unknown) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkippedClasses lists the classes not supported by the APIC.
+func SkippedClasses(reqs []*Request) []string {
+	var skipped []string
+	for _, req := range reqs {
+		if req.Skipped {
+			skipped = append(skipped, req.Prefix)
+		}
+	}
+	sort.Strings(skipped)
+	return skipped
+}
+
+// AppendResults combines two arrays of results.
+func AppendResults(a, b goaci.Res) goaci.Res {
+	if !a.IsArray() || len(a.Array()) == 0 {
+		return b
+	}
+	if !b.IsArray() || len(b.Array()) == 0 {
+		return a
+	}
+	raw := strings.TrimSpace(a.Raw)
+	raw = raw[:len(raw)-1] + "," + strings.TrimSpace(b.Raw)[1:]
+	return gjson.Parse(raw)
+}
+
+// Sink receives the records of the requests as they're fetched, e.g. a
+// Writer. The records of requests sharing a prefix, e.g. shards, are added
+// to the same class.
+type Sink interface {
+	// Write adds a batch of records to a class; an empty batch adds the
+	// class without records.
+	Write(prefix string, records []goaci.Res) error
+	// Drop removes the records of a class, e.g. one with a failed shard,
+	// whose records would be incomplete.
+	Drop(prefix string) error
+	// Flush waits for the records to be stored.
+	Flush() error
+}
+
+// responseSink keeps the records of a fetch in memory, by prefix.
+type responseSink struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func newResponseSink() *responseSink {
+	return &responseSink{records: make(map[string][]string)}
+}
+
+func (s *responseSink) Write(prefix string, records []goaci.Res) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw := s.records[prefix]
+	for _, record := range records {
+		raw = append(raw, record.Raw)
+	}
+	s.records[prefix] = raw
+	return nil
+}
+
+func (s *responseSink) Drop(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, prefix)
+	return nil
+}
+
+func (s *responseSink) Flush() error {
+	return nil
+}
+
+// responses returns the records of each class.
+func (s *responseSink) responses() map[string]goaci.Res {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	responses := make(map[string]goaci.Res)
+	for prefix, raw := range s.records {
+		responses[prefix] = gjson.Parse("[" + strings.Join(raw, ",") + "]")
+	}
+	return responses
+}
+
+// Fetch makes the requests like FetchTo, keeping the records in memory, e.g.
+// for the few classes needed to plan the other requests.
+func Fetch(client Getter, reqs []*Request, limits Limits, log zerolog.Logger) (map[string]goaci.Res, error) {
+	sink := newResponseSink()
+	err := FetchTo(client, reqs, limits, sink, log)
+	return sink.responses(), err
+}
+
+// FetchTo makes the requests through a bounded pool of workers, which write
+// the records to the sink in batches as each response is decoded, so no
+// response is held in memory as a whole. The batches are sized by the
+// memory budget. Failed requests are recorded on the request; an error is
+// returned if every request fails or the sink fails.
+func FetchTo(client Getter, reqs []*Request, limits Limits, sink Sink, log zerolog.Logger) error {
+	plan(client, len(reqs))
+	workers := limits.workers(len(reqs))
+	batch := limits.batchSize()
+	jobs := make(chan *Request)
+	var g errgroup.Group
+
+	go func() {
+		for _, req := range reqs {
+			jobs <- req
+		}
+		close(jobs)
+	}()
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for req := range jobs {
+				fetchOne(client, req, sink, batch, log)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if err := sink.Flush(); err != nil {
+		return err
+	}
+	if failed := FailedClasses(reqs); len(failed) > 0 && len(failed) == len(reqs) {
+		return fmt.Errorf("all requests failed, e.g. %s: %s", reqs[0].Prefix, failed[reqs[0].Prefix])
+	}
+	return nil
+}
+
+// fetchOne makes a request, writing its records to the sink in batches of
+// about batch bytes and recording the duration, size and any error on it.
+// The class of a request that fails once records were written is dropped,
+// as its records would be incomplete.
+func fetchOne(client Getter, req *Request, sink Sink, batch int, log zerolog.Logger) {
+	written := false
+	defer func() {
+		// A malformed response mustn't take down the other requests
+		if r := recover(); r != nil {
+			req.Err = fmt.Errorf("unexpected error: %v", r)
+			log.Error().Err(req.Err).Str("resource", req.Prefix).Msg("failed to process response")
+		}
+		if req.Err != nil && written {
+			if err := sink.Drop(req.Prefix); err != nil {
+				log.Error().Err(err).Str("resource", req.Prefix).Msg("cannot drop incomplete records")
+			}
+		}
+	}()
+	startTime := time.Now()
+	log.Debug().Time("start_time", startTime).Msgf("begin: %s", req.Prefix)
+
+	log.Info().Str("resource", req.Prefix).Msg("fetching resource...")
+	log.Debug().Str("url", req.Path).Msg("requesting resource")
+
+	var (
+		records []goaci.Res
+		size    int
+	)
+	n, err := StreamRecords(client, req.Path, req.Filter, func(record goaci.Res) error {
+		records = append(records, record)
+		size += len(record.Raw)
+		if size < batch {
+			return nil
+		}
+		written = true
+		err := sink.Write(req.Prefix, records)
+		records, size = nil, 0
+		return err
+	}, req.Mods...)
+	if err == nil {
+		written = true
+		err = sink.Write(req.Prefix, records)
+	}
+	req.Elapsed = time.Since(startTime)
+	if err != nil && IsUnsupportedClass(err) {
+		req.Skipped = true
+		log.Warn().Err(err).Str("resource", req.Prefix).
+			Msg("class not supported by this APIC version; skipping")
+		return
+	}
+	if err != nil {
+		// Collect the other classes; failures are summarized at the end
+		req.Err = err
+		log.Error().Err(err).Str("resource", req.Prefix).Msg("failed to make request")
+		return
+	}
+	req.Size = n
+	log.Debug().
+		TimeDiff("elapsed_time", time.Now(), startTime).
+		Msgf("done: %s", req.Prefix)
+}
+
+// clientGetter makes the requests of a goaci client with the APIC errors.
+type clientGetter struct {
+	client *goaci.Client
+}
+
+func (g clientGetter) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	return getResponse(g.client, path, mods...)
+}
+
+func (g clientGetter) StreamRecords(path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error) {
+	return streamRecords(g.client, path, filter, fn, mods...)
+}
+
+// StreamRecords makes a request and passes the filtered records to fn,
+// streaming the response if the client supports it. It returns the response
+// size.
+func StreamRecords(client Getter, path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error) {
+	if c, ok := client.(*goaci.Client); ok {
+		client = clientGetter{c}
+	}
+	if c, ok := client.(RecordStreamer); ok && strings.HasPrefix(filter, "#.") {
+		return c.StreamRecords(path, filter, fn, mods...)
+	}
+	res, err := client.Get(path, mods...)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range res.Get("imdata." + filter).Array() {
+		if err := fn(record); err != nil {
+			return len(res.Raw), err
+		}
+	}
+	return len(res.Raw), nil
+}
+
+// FailedClasses returns the request errors per class.
+func FailedClasses(reqs []*Request) map[string]string {
+	failed := make(map[string]string)
+	for _, req := range reqs {
+		if req.Err != nil {
+			failed[req.Prefix] = req.Err.Error()
+		}
+	}
+	return failed
+}
+
+// Default number of concurrent requests to the APIC.
+const defaultMaxRequests = 16
+
+// Size of the batches of records written to the db, without a memory budget,
+// and the smallest size with one.
+const (
+	defaultBatchSize = 1 << 20
+	minBatchSize     = 64 << 10
+)
+
+// Limits bound the concurrent requests of a fetch and the memory their
+// records use on the way to the db.
+type Limits struct {
+	Requests int    // Concurrent requests; 0 for the default
+	Memory   uint64 // Records in flight between the requests and the db; 0 for the default batches
+}
+
+// concurrency returns the number of concurrent requests.
+func (l Limits) concurrency() int {
+	if l.Requests <= 0 {
+		return defaultMaxRequests
+	}
+	return l.Requests
+}
+
+// workers returns the number of workers for a number of requests.
+func (l Limits) workers(n int) int {
+	workers := l.concurrency()
+	if workers > n {
+		workers = n
+	}
+	return workers
+}
+
+// batchSize returns the size of the batches of records, so that those being
+// decoded by every worker, those queued for a Writer and the one being
+// written fit within the memory budget.
+func (l Limits) batchSize() int {
+	if l.Memory == 0 {
+		return defaultBatchSize
+	}
+	size := l.Memory / uint64(2*l.concurrency()+1)
+	switch {
+	case size > defaultBatchSize:
+		return defaultBatchSize
+	case size < minBatchSize:
+		return minBatchSize
+	}
+	return int(size)
+}
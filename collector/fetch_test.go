@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestFetchLimitsWorkers(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(defaultMaxRequests, Limits{}.workers(100))
+	a.Equal(3, Limits{}.workers(3))
+	a.Equal(4, Limits{Requests: 4}.workers(100))
+}
+
+func TestFetchLimitsBatchSize(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(defaultBatchSize, Limits{}.batchSize())
+	a.Equal(defaultBatchSize, Limits{Memory: 1 << 30}.batchSize())
+	// The batches of every worker, the queue and the writer fit the budget
+	a.Equal(100<<10, Limits{Requests: 4, Memory: 900 << 10}.batchSize())
+	a.Equal(minBatchSize, Limits{Memory: 1 << 20}.batchSize())
+}
+
+func TestFetch(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		Reply(200).
+		BodyString(goaci.Body{}.
+			Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").
+			Set("imdata.1.fvTenant.attributes.dn", "uni/tn-one").
+			Str)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	log := zerolog.New(&bytes.Buffer{})
+	reqs := []*Request{{
+		Class:  "fvTenant",
+		Path:   "/api/class/fvTenant",
+		Filter: "#.fvTenant.attribute",
+	}}
+	results, err := Fetch(&client, reqs, Limits{}, log)
+	a.NoError(err)
+	if tenants, ok := results["fvTenant"]; ok {
+		a.Equal("uni/tn-zero", tenants.Get("0.dn").Str)
+		a.Equal("uni/tn-one", tenants.Get("1.dn").Str)
+	}
+}
+
+func TestFetchUnsupportedClass(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		Reply(200).
+		BodyString(goaci.Body{}.Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").Str)
+	gock.New("https://apic").
+		Get("/api/class/fvNewClass.json").
+		Reply(400).
+		BodyString(goaci.Body{}.Set("imdata.0.error.attributes.text", "Request failed, unresolved class for fvNewClass").Str)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	log := zerolog.New(&bytes.Buffer{})
+	reqs := []*Request{
+		{Class: "fvTenant", Prefix: "fvTenant", Path: "/api/class/fvTenant", Filter: "#.fvTenant.attributes"},
+		{Class: "fvNewClass", Prefix: "fvNewClass", Path: "/api/class/fvNewClass", Filter: "#.fvNewClass.attributes"},
+	}
+	results, err := Fetch(&client, reqs, Limits{}, log)
+	a.NoError(err)
+	a.Equal("uni/tn-zero", results["fvTenant"].Get("0.dn").Str)
+	a.NotContains(results, "fvNewClass")
+	a.Equal([]string{"fvNewClass"}, SkippedClasses(reqs))
+}
+
+func TestIsUnsupportedClass(t *testing.T) {
+	a := assert.New(t)
+	a.True(IsUnsupportedClass(&APIError{Status: 400, Text: "Request failed, unresolved class for fvNewClass"}))
+	a.True(IsUnsupportedClass(&APIError{Status: 404, Text: "Unknown class fvNewClass"}))
+	a.False(IsUnsupportedClass(&APIError{Status: 400, Text: "Invalid query-target-filter"}))
+	a.False(IsUnsupportedClass(&APIError{Status: 400}))
+	a.False(IsUnsupportedClass(&APIError{Status: 500, Text: "unresolved class"}))
+}
+
+func TestFetchFailedClass(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		Reply(200).
+		BodyString(goaci.Body{}.Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").Str)
+	gock.New("https://apic").
+		Get("/api/class/faultInst.json").
+		Times(2).
+		Reply(500)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	log := zerolog.New(&bytes.Buffer{})
+	reqs := WithDefaults([]*Request{{Class: "fvTenant"}, {Class: "faultInst"}})
+	results, err := Fetch(&client, reqs, Limits{}, log)
+	a.NoError(err)
+	a.Equal("uni/tn-zero", results["fvTenant"].Get("0.dn").Str)
+	a.Equal(map[string]string{"faultInst": "received HTTP status 500"}, FailedClasses(reqs))
+
+	// Fail if nothing could be collected
+	_, err = Fetch(&client, WithDefaults([]*Request{{Class: "faultInst"}}), Limits{}, log)
+	a.EqualError(err, "all requests failed, e.g. faultInst: received HTTP status 500")
+}
+
+// panicGetter panics for one path, as for a malformed response.
+type panicGetter struct {
+	path string
+}
+
+func (g panicGetter) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	if path == g.path {
+		panic("unexpected response")
+	}
+	return gjson.Parse(`{"imdata": [{"fvTenant": {"attributes": {"dn": "uni/tn-zero"}}}]}`), nil
+}
+
+func TestFetchPanic(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	reqs := WithDefaults([]*Request{{Class: "fvTenant"}, {Class: "faultInst"}})
+	results, err := Fetch(panicGetter{path: "/api/class/faultInst"}, reqs, Limits{}, log)
+	a.NoError(err)
+	a.Equal("uni/tn-zero", results["fvTenant"].Get("0.dn").Str)
+	a.Equal(map[string]string{"faultInst": "unexpected error: unexpected response"}, FailedClasses(reqs))
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+)
+
+// Plugin adds organization-specific requests and post-processing to a
+// collection without changing the request catalog. Plugins are compiled in
+// and register themselves from an init function:
+//
+//	func init() {
+//		collector.Register(myPlugin{})
+//	}
+type Plugin interface {
+	// Name identifies the plugin in the log and the collection metadata.
+	Name() string
+	// Requests returns the additional requests, collected with the catalog.
+	Requests() []*Request
+	// Process runs once the requests are collected, and may query the APIC
+	// and add or replace responses, e.g. aggregates of the collected records.
+	Process(client Getter, responses map[string]goaci.Res, log zerolog.Logger) error
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = make(map[string]Plugin)
+)
+
+// Register makes a plugin part of every collection. It panics if a plugin
+// is registered twice under the same name, as plugins register on init.
+func Register(p Plugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, dup := plugins[p.Name()]; dup {
+		panic(fmt.Sprintf("collector: plugin %s registered twice", p.Name()))
+	}
+	plugins[p.Name()] = p
+}
+
+// Plugins returns the registered plugins by name.
+func Plugins() []Plugin {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	var list []Plugin
+	for _, p := range plugins {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// PluginRequests returns the requests of the registered plugins, other than
+// those with the prefix of a request already in reqs.
+func PluginRequests(reqs []*Request) []*Request {
+	seen := make(map[string]bool)
+	for _, req := range reqs {
+		seen[req.Prefix] = true
+	}
+	var extra []*Request
+	for _, p := range Plugins() {
+		for _, req := range WithDefaults(p.Requests()) {
+			if !seen[req.Prefix] {
+				seen[req.Prefix] = true
+				extra = append(extra, req)
+			}
+		}
+	}
+	return extra
+}
+
+// RunPlugins post-processes the responses with the registered plugins. A
+// failed plugin doesn't stop the others; their errors are returned.
+func RunPlugins(client Getter, responses map[string]goaci.Res, log zerolog.Logger) []error {
+	var errs []error
+	for _, p := range Plugins() {
+		log.Info().Str("plugin", p.Name()).Msg("running plugin...")
+		if err := runPlugin(p, client, responses, log); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s failed: %v", p.Name(), err))
+		}
+	}
+	return errs
+}
+
+// runPlugin runs a plugin, recovering from a panic so a broken plugin
+// doesn't lose the collection.
+func runPlugin(p Plugin, client Getter, responses map[string]goaci.Res, log zerolog.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected error: %v", r)
+		}
+	}()
+	return p.Process(client, responses, log)
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// testPlugin counts the records of a class into an aggregate.
+type testPlugin struct {
+	name  string
+	fail  bool
+	panic bool
+}
+
+func (p testPlugin) Name() string { return p.name }
+
+func (p testPlugin) Requests() []*Request {
+	return []*Request{{Class: "fvAEPg"}, {Class: "fvTenant"}}
+}
+
+func (p testPlugin) Process(client Getter, responses map[string]goaci.Res, log zerolog.Logger) error {
+	switch {
+	case p.panic:
+		panic("broken plugin")
+	case p.fail:
+		return errors.New("no records")
+	}
+	responses[p.name] = gjson.Parse(`[{"count":1}]`)
+	return nil
+}
+
+// register registers plugins for a test, returning a func unregistering them.
+func register(ps ...Plugin) func() {
+	for _, p := range ps {
+		Register(p)
+	}
+	return func() {
+		pluginsMu.Lock()
+		defer pluginsMu.Unlock()
+		for _, p := range ps {
+			delete(plugins, p.Name())
+		}
+	}
+}
+
+func TestPluginRequests(t *testing.T) {
+	a := assert.New(t)
+	defer register(testPlugin{name: "epgs"})()
+
+	extra := PluginRequests([]*Request{{Class: "fvTenant", Prefix: "fvTenant"}})
+	a.Len(extra, 1)
+	a.Equal("fvAEPg", extra[0].Prefix)
+	a.Equal("/api/class/fvAEPg", extra[0].Path)
+	a.Equal("#.fvAEPg.attributes", extra[0].Filter)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	a := assert.New(t)
+	defer register(testPlugin{name: "epgs"})()
+	a.Panics(func() { Register(testPlugin{name: "epgs"}) })
+}
+
+func TestRunPlugins(t *testing.T) {
+	a := assert.New(t)
+	defer register(
+		testPlugin{name: "b", fail: true},
+		testPlugin{name: "a"},
+		testPlugin{name: "c", panic: true},
+	)()
+	var names []string
+	for _, p := range Plugins() {
+		names = append(names, p.Name())
+	}
+	a.Equal([]string{"a", "b", "c"}, names)
+
+	responses := make(map[string]goaci.Res)
+	errs := RunPlugins(nil, responses, zerolog.New(&bytes.Buffer{}))
+	a.Len(errs, 2)
+	a.EqualError(errs[0], "plugin b failed: no records")
+	a.EqualError(errs[1], "plugin c failed: unexpected error: broken plugin")
+	a.Equal(int64(1), responses["a"].Get("0.count").Int())
+}
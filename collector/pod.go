@@ -0,0 +1,18 @@
+package collector
+
+import "fmt"
+
+// ForPod restricts the requests to the nodes of a pod: records under
+// topology/, e.g. switches, stats and node faults, are kept only for the pod,
+// and the policy under uni/ is kept whole. The tenant classes, which are all
+// policy, are unchanged.
+func ForPod(reqs []*Request, pod int) []*Request {
+	for _, req := range reqs {
+		if tenantClasses[req.Class] {
+			continue
+		}
+		req.Mods = andFilter(req, fmt.Sprintf(`or(wcard(%[1]s.dn,"^topology/pod-%[2]d/"),not(wcard(%[1]s.dn,"^topology/pod-")))`,
+			req.Class, pod))
+	}
+	return reqs
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForPod(t *testing.T) {
+	a := assert.New(t)
+	reqs := ForPod(WithDefaults([]*Request{
+		{Class: "topSystem"},
+		{Class: "fvBD"},
+		{
+			Class: "eventRecord",
+			Mods:  []Mod{goaci.Query("query-target-filter", `wcard(eventRecord.descr,"moved")`)},
+		},
+	}), 2)
+	a.Equal([]string{
+		`or(wcard(topSystem.dn,"^topology/pod-2/"),not(wcard(topSystem.dn,"^topology/pod-")))`,
+		"",
+		`and(wcard(eventRecord.descr,"moved"),or(wcard(eventRecord.dn,"^topology/pod-2/"),not(wcard(eventRecord.dn,"^topology/pod-"))))`,
+	}, shardFilters(reqs))
+
+	// Tenant classes are still fetched per tenant
+	tenant, _ := TenantRequests(reqs)
+	a.Len(tenant, 1)
+}
@@ -0,0 +1,250 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+)
+
+// Number of attempts for a request before failing over to the next APIC.
+const requestRetries = 3
+
+// Pool is a set of APIC controllers for a single fabric.
+// Requests are made to the active controller and fail over to the next
+// controller in the list if login or a request repeatedly fails, e.g. times
+// out. Client errors, e.g. an invalid filter, fail immediately.
+type Pool struct {
+	mu      sync.Mutex
+	hosts   []string
+	usr     string
+	pwd     string
+	active  int
+	failed  int // Number of hosts tried since the last successful login
+	client  *goaci.Client
+	log     zerolog.Logger
+	timeout time.Duration
+	mods    []func(*goaci.Client) // Client modifiers
+}
+
+// NewPool returns a pool for the controllers of a fabric. The client
+// modifiers are applied to the client of each controller, e.g. to tune the
+// HTTP transport.
+func NewPool(hosts []string, usr, pwd string, log zerolog.Logger, mods ...func(*goaci.Client)) *Pool {
+	return &Pool{
+		hosts:   hosts,
+		usr:     usr,
+		pwd:     pwd,
+		log:     log,
+		timeout: 600,
+		mods:    mods,
+	}
+}
+
+// Host returns the active APIC host.
+func (p *Pool) Host() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hosts[p.active]
+}
+
+// Client returns the client of the active controller, or nil before login,
+// for APIC features that are tied to a session, e.g. event subscriptions.
+func (p *Pool) Client() *goaci.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.client
+}
+
+// Login authenticates to the first reachable controller, starting with the
+// active controller.
+func (p *Pool) Login() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.login()
+}
+
+// login requires the lock to be held.
+func (p *Pool) login() error {
+	if len(p.hosts) == 0 {
+		return errors.New("no APIC hosts provided")
+	}
+	var errs []string
+	for p.failed < len(p.hosts) {
+		host := p.hosts[p.active]
+		mods := append([]func(*goaci.Client){goaci.RequestTimeout(p.timeout)}, p.mods...)
+		client, err := goaci.NewClient(host, p.usr, p.pwd, mods...)
+		if err == nil {
+			err = client.Login()
+		}
+		if err == nil {
+			p.client = &client
+			p.failed = 0
+			return nil
+		}
+		p.log.Warn().Err(err).Str("host", host).Msg("cannot authenticate to APIC")
+		errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+		p.next()
+	}
+	return fmt.Errorf("all APIC hosts failed: %s", strings.Join(errs, "; "))
+}
+
+// next moves to the next controller in the list.
+func (p *Pool) next() {
+	p.active = (p.active + 1) % len(p.hosts)
+	p.failed++
+}
+
+// failover switches to the next controller, unless another request has
+// already failed over from the given client.
+func (p *Pool) failover(from *goaci.Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != from {
+		return nil
+	}
+	prev := p.hosts[p.active]
+	p.next()
+	if err := p.login(); err != nil {
+		return err
+	}
+	p.log.Warn().
+		Str("from", prev).
+		Str("to", p.hosts[p.active]).
+		Msg("failing over to next APIC")
+	return nil
+}
+
+// Skip moves to the next controller, e.g. past a standby controller, which
+// only serves a subset of the API.
+func (p *Pool) Skip() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next()
+	return p.login()
+}
+
+// Len returns the number of controllers.
+func (p *Pool) Len() int {
+	return len(p.hosts)
+}
+
+// relogin renews the session of a client whose token the APIC rejected,
+// unless another request already renewed it since the given time.
+func (p *Pool) relogin(client *goaci.Client, since time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client.LastRefresh.After(since) {
+		return nil
+	}
+	return client.Login()
+}
+
+// retryable checks whether a failed request may succeed when retried, e.g.
+// after a timeout, an APIC server error or an expired session. Other client
+// errors, e.g. an invalid filter, a missing permission or an unsupported
+// class, fail the same way on every controller, and a streamed request that
+// already passed on records isn't repeated.
+func retryable(err error) bool {
+	if _, ok := err.(partialError); ok {
+		return false
+	}
+	e, ok := err.(*APIError)
+	return !ok || e.Status >= http.StatusInternalServerError || e.Status == http.StatusUnauthorized
+}
+
+// Get makes a GET request to the active controller, retrying and failing over
+// as required.
+func (p *Pool) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	var res goaci.Res
+	err := p.retry(path, mods, func(client *goaci.Client) error {
+		var err error
+		res, err = getResponse(client, path, mods...)
+		return err
+	})
+	return res, err
+}
+
+// StreamRecords streams a GET response from the active controller, passing
+// the filtered records, e.g. #.fvTenant.attributes, to fn as they're decoded.
+// It returns the response size. A request retried after fn was called would
+// repeat records, so only a request that fails before any record is retried.
+func (p *Pool) StreamRecords(path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error) {
+	var size int
+	err := p.retry(path, mods, func(client *goaci.Client) error {
+		n := 0
+		var err error
+		size, err = streamRecords(client, path, filter, func(record goaci.Res) error {
+			n++
+			return fn(record)
+		}, mods...)
+		if err != nil && n > 0 {
+			return partialError{err}
+		}
+		return err
+	})
+	if e, ok := err.(partialError); ok {
+		return size, e.err
+	}
+	return size, err
+}
+
+// partialError is a request that failed after some of its records were
+// passed on, which mustn't be retried.
+type partialError struct {
+	err error
+}
+
+func (e partialError) Error() string {
+	return e.err.Error()
+}
+
+// retry makes a request to the active controller, retrying and failing over
+// as required.
+func (p *Pool) retry(path string, mods []func(*goaci.Req), do func(*goaci.Client) error) error {
+	for hop := 0; ; hop++ {
+		p.mu.Lock()
+		client := p.client
+		p.mu.Unlock()
+		if client == nil {
+			return errors.New("not authenticated to the APIC")
+		}
+		// Full URL including query parameters, for debugging
+		url := client.NewReq("GET", path, nil, mods...).HttpReq.URL.String()
+		var err error
+		for attempt := 1; attempt <= requestRetries; attempt++ {
+			start := time.Now()
+			err = do(client)
+			if err == nil {
+				p.log.Debug().Int("attempt", attempt).Str("url", url).
+					TimeDiff("elapsed_time", time.Now(), start).Msg("request complete")
+				return nil
+			}
+			if !retryable(err) {
+				// Retrying or failing over won't help
+				return err
+			}
+			p.log.Debug().Err(err).Int("attempt", attempt).Str("url", url).
+				TimeDiff("elapsed_time", time.Now(), start).Msg("request failed")
+			if e, ok := err.(*APIError); ok && e.Status == http.StatusUnauthorized {
+				if lerr := p.relogin(client, start); lerr != nil {
+					p.log.Warn().Err(lerr).Str("host", client.Url).Msg("cannot renew APIC session")
+				}
+			}
+			if attempt < requestRetries {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+		if hop+1 >= len(p.hosts) {
+			return err
+		}
+		if ferr := p.failover(client); ferr != nil {
+			return fmt.Errorf("%v; %v", err, ferr)
+		}
+	}
+}
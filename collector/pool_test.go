@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestPoolFailover(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic1").
+		Post("/api/aaaLogin.json").
+		Reply(500)
+	gock.New("https://apic2").
+		Post("/api/aaaLogin.json").
+		Reply(200).
+		BodyString(`{"imdata":[]}`)
+	gock.New("https://apic2").
+		Get("/api/class/fvTenant.json").
+		Reply(200).
+		BodyString(goaci.Body{}.
+			Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").
+			Str)
+
+	log := zerolog.New(&bytes.Buffer{})
+	pool := NewPool([]string{"apic1", "apic2"}, "usr", "pwd", log, func(c *goaci.Client) {
+		gock.InterceptClient(c.HttpClient)
+	})
+	a.NoError(pool.Login())
+	a.Equal("apic2", pool.Host())
+
+	res, err := pool.Get("/api/class/fvTenant")
+	a.NoError(err)
+	a.Equal("uni/tn-zero", res.Get("imdata.0.fvTenant.attributes.dn").Str)
+}
+
+func TestPoolClientError(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic1").
+		Post("/api/aaaLogin.json").
+		Reply(200).
+		BodyString(`{"imdata":[]}`)
+	gock.New("https://apic1").
+		Get("/api/class/fvTenant.json").
+		Times(1).
+		Reply(400).
+		BodyString(goaci.Body{}.Set("imdata.0.error.attributes.text", "Invalid filter").Str)
+
+	log := zerolog.New(&bytes.Buffer{})
+	pool := NewPool([]string{"apic1", "apic2"}, "usr", "pwd", log, func(c *goaci.Client) {
+		gock.InterceptClient(c.HttpClient)
+	})
+	a.NoError(pool.Login())
+	_, err := pool.Get("/api/class/fvTenant")
+	a.EqualError(err, "received HTTP status 400: Invalid filter")
+	// Neither retried nor failed over
+	a.Equal("apic1", pool.Host())
+	a.True(gock.IsDone())
+}
+
+func TestPoolRelogin(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic1").
+		Post("/api/aaaLogin.json").
+		Times(2).
+		Reply(200).
+		BodyString(`{"imdata":[]}`)
+	gock.New("https://apic1").
+		Get("/api/class/fvTenant.json").
+		Reply(401).
+		BodyString(goaci.Body{}.Set("imdata.0.error.attributes.text", "Token was invalid").Str)
+	gock.New("https://apic1").
+		Get("/api/class/fvTenant.json").
+		Reply(200).
+		BodyString(goaci.Body{}.Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").Str)
+
+	log := zerolog.New(&bytes.Buffer{})
+	pool := NewPool([]string{"apic1"}, "usr", "pwd", log, func(c *goaci.Client) {
+		gock.InterceptClient(c.HttpClient)
+	})
+	a.NoError(pool.Login())
+	res, err := pool.Get("/api/class/fvTenant")
+	a.NoError(err)
+	a.Equal("uni/tn-zero", res.Get("imdata.0.fvTenant.attributes.dn").Str)
+	a.True(gock.IsDone())
+}
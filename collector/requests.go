@@ -0,0 +1,405 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// Mod modifies a request, e.g. adding query parameters.
+type Mod = func(*goaci.Req)
+
+// Default time window for the endpoint event records.
+const epHistory = 7 * 24 * time.Hour
+
+// Descriptions of the endpoint learning anomaly events, by prefix.
+var endpointEvents = map[string]string{"epRogue": "rogue", "epMove": "moved"}
+
+// createdSince filters event, fault and audit records to those created within the window.
+func createdSince(class string, window time.Duration, filters ...string) Mod {
+	ts := time.Now().Add(-window).UTC().Format("2006-01-02T15:04:05")
+	filter := fmt.Sprintf(`gt(%s.created,"%s")`, class, ts)
+	for _, f := range filters {
+		filter = fmt.Sprintf("and(%s,%s)", filter, f)
+	}
+	return goaci.Query("query-target-filter", filter)
+}
+
+// endpointEventsSince filters the event records to those of an endpoint
+// learning anomaly, e.g. rogue, created within the window.
+func endpointEventsSince(descr string, window time.Duration) Mod {
+	return createdSince("eventRecord", window, fmt.Sprintf(`wcard(eventRecord.descr,"%s")`, descr))
+}
+
+// ForHistory bounds the endpoint event records by the history window, as
+// for the fault, event and audit records, rather than the default week.
+func ForHistory(reqs []*Request, window time.Duration) []*Request {
+	for _, req := range reqs {
+		if descr, ok := endpointEvents[req.Prefix]; ok && req.Class == "eventRecord" {
+			req.Mods = []Mod{endpointEventsSince(descr, window)}
+		}
+	}
+	return reqs
+}
+
+// FaultHistory returns the request for the fault records created within the
+// window, including faults that have since cleared, e.g. flapping faults.
+func FaultHistory(window time.Duration) *Request {
+	return WithDefaults([]*Request{{
+		Class: "faultRecord",
+		Mods:  []Mod{createdSince("faultRecord", window)},
+	}})[0]
+}
+
+// EventHistory returns the request for the event records created within the
+// window, e.g. port flaps and policy deployments.
+func EventHistory(window time.Duration) *Request {
+	return WithDefaults([]*Request{{
+		Class:     "eventRecord",
+		Mods:      []Mod{createdSince("eventRecord", window)},
+		Sensitive: true,
+	}})[0]
+}
+
+// AuditHistory returns the request for the configuration audit log records
+// created within the window, recording who changed what.
+func AuditHistory(window time.Duration) *Request {
+	return WithDefaults([]*Request{{
+		Class:     "aaaModLR",
+		Mods:      []Mod{createdSince("aaaModLR", window)},
+		Sensitive: true,
+	}})[0]
+}
+
+// EndpointRequests returns the requests for the full endpoint and IP
+// tables, rather than their counts, for endpoint-level analysis. The tables
+// can be huge and are fetched per tenant.
+func EndpointRequests() []*Request {
+	return WithDefaults([]*Request{
+		{Class: "fvCEp", Prefix: "fvCEpTable", Shard: ShardTenant, Sensitive: true},
+		{Class: "fvIp", Prefix: "fvIpTable", Shard: ShardTenant, Sensitive: true},
+	})
+}
+
+// CoopRequest returns the request for the spines' COOP endpoint database, for
+// comparing with the endpoints learned by the leaves. It's fetched per node.
+func CoopRequest() *Request {
+	return WithDefaults([]*Request{{Class: "coopEpRec", Shard: ShardSpine, Sensitive: true}})[0]
+}
+
+// AdjacencyRequests returns the requests for the ARP and IPv6 neighbor
+// discovery adjacencies of the nodes, for gateway and first-hop
+// troubleshooting. They're fetched per node.
+func AdjacencyRequests() []*Request {
+	return WithDefaults([]*Request{
+		{Class: "arpAdjEp", Shard: ShardNode, Sensitive: true},
+		{Class: "ndAdjEp", Shard: ShardNode, Sensitive: true},
+	})
+}
+
+// Request is an API request for a class. The result fields are set by
+// Fetch.
+type Request struct {
+	Class     string // MO class
+	Path      string // Request path
+	Prefix    string // Prefix for the DB
+	Mods      []Mod  // Request modifiers, e.g. query parameters
+	Filter    string // Result filter (default to #.{class}.attributes)
+	Sensitive bool   // Operational data that may identify users or hosts
+	Shard     string // Split into a request per tenant, pod or node, for huge classes
+	Stats     bool   // Health and capacity stats, left out of config-only collections
+
+	MinVersion string // First APIC release with the class, e.g. 3.2
+
+	Elapsed time.Duration // Request duration
+	Size    int           // Response size in bytes
+	Skipped bool          // Class not supported by the APIC
+	Err     error         // Request error
+}
+
+// Requests returns the default request catalog.
+func Requests() []*Request {
+	reqs := []*Request{
+		/************************************************************
+		Infrastructure
+		************************************************************/
+		{Class: "topSystem"},    // All devices
+		{Class: "eqptBoard"},    // APIC hardware
+		{Class: "fabricNode"},   // Switch hardware
+		{Class: "fabricSetupP"}, // Pods (fabric setup policy)
+		{Class: "infraWiNode"},  // APIC cluster health
+		{Class: "infraSnNode"},  // Standby APICs
+		{Class: "eqptStorage"},  // Disk partitions and utilization
+
+		// Hardware status
+		{Class: "eqptFt"},    // Fan trays
+		{Class: "eqptPsu"},   // Power supplies
+		{Class: "eqptFlash"}, // SSD and flash wear
+
+		// Modular switch inventory
+		{Class: "eqptLC"},   // Linecards
+		{Class: "eqptSupC"}, // Supervisors
+		{Class: "eqptFC"},   // Fabric modules
+
+		// Ports
+		{Class: "l1PhysIf", Shard: ShardNode},    // Physical interface settings
+		{Class: "ethpmPhysIf", Shard: ShardNode}, // Interface operational state
+		{Class: "ethpmFcot", Shard: ShardNode},   // Transceivers and optical monitoring
+
+		// Port-channels and vPCs
+		{Class: "pcAggrIf"},   // Port-channel state
+		{Class: "pcRsMbrIfs"}, // Port-channel --> member interface
+		{Class: "vpcDom"},     // vPC domain, role and peer status
+		{Class: "vpcIf"},      // vPC interface state
+
+		/************************************************************
+		Fabric-wide settings
+		************************************************************/
+		{Class: "epLoopProtectP"},    // EP loop protection policy
+		{Class: "epControlP"},        // Rogue EP control policy
+		{Class: "epIpAgingP"},        // IP aging policy
+		{Class: "infraSetPol"},       // Fabric-wide settings
+		{Class: "infraPortTrackPol"}, // Port tracking policy
+		{Class: "coopPol"},           // COOP group policy
+
+		/************************************************************
+		Tenants
+		************************************************************/
+		// Primary constructs
+		{Class: "fvAEPg"},   // EPG
+		{Class: "fvRsBd"},   // EPG --> BD
+		{Class: "fvBD"},     // BD
+		{Class: "fvCtx"},    // VRF
+		{Class: "fvTenant"}, // Tenant
+		{Class: "fvSubnet"}, // Subnet
+
+		// Contracts
+		{Class: "vzBrCP"},          // Contract
+		{Class: "vzFilter"},        // Filter
+		{Class: "vzSubj"},          // Subject
+		{Class: "vzRsSubjFiltAtt"}, // Subject --> filter
+		{Class: "fvRsProv"},        // EPG --> contract provided
+		{Class: "fvRsCons"},        // EPG --> contract consumed
+
+		// L3outs
+		{Class: "l3extOut"},            // L3out
+		{Class: "l3extLNodeP"},         // L3 node profile
+		{Class: "l3extRsNodeL3OutAtt"}, // Node profile --> Node
+		{Class: "l3extLIfP"},           // L3 interface profile
+		{Class: "l3extInstP"},          // External EPG
+
+		/************************************************************
+		Fabric Policies
+		************************************************************/
+		{Class: "isisDomPol"},         // ISIS policy
+		{Class: "bgpRRNodePEp"},       // BGP route reflector nodes
+		{Class: "l3IfPol"},            // L3 interface policy
+		{Class: "fabricNodeControl"},  // node control (Dom, netflow,etc)
+		{Class: "fabricRsNodeCtrl"},   // node policy group --> node control
+		{Class: "fabricRsLeNodePGrp"}, // leaf --> leaf node policy group
+		{Class: "fabricNodeBlk"},      // Node block
+
+		// vPC protection groups
+		{Class: "fabricExplicitGEp"}, // vPC domain
+		{Class: "fabricNodePEp"},     // vPC domain --> node
+
+		/************************************************************
+		Fabric Access
+		************************************************************/
+		// MCP
+		{Class: "mcpIfPol"},          // MCP inteface policy
+		{Class: "infraRsMcpIfPol"},   // MCP pol --> policy group
+		{Class: "infraRsAccBaseGrp"}, // policy group --> host port selector
+		{Class: "infraRsAccPortP"},   // int profile --> node profile
+
+		{Class: "mcpInstPol"}, // MCP global policy
+
+		// Spanning tree
+		{Class: "stpInstPol"},              // STP global policy
+		{Class: "stpIfPol"},                // STP interface policy (BPDU guard/filter)
+		{Class: "infraRsStpIfPol"},         // STP pol --> policy group
+		{Class: "stpIf", Shard: ShardNode}, // STP interface state
+
+		// AEP/domain/VLANs
+		{Class: "infraAttEntityP"}, // AEP
+		{Class: "infraRsDomP"},     // AEP --> domain
+		{Class: "infraRsVlanNs"},   // Domain --> VLAN pool
+		{Class: "fvnsEncapBlk"},    // VLAN encap block
+
+		/************************************************************
+		Admin/Operations
+		************************************************************/
+		{Class: "firmwareRunning"},        // Switch firmware
+		{Class: "firmwareCtrlrRunning"},   // Controller firmware
+		{Class: "pkiExportEncryptionKey"}, // Crypto key
+
+		/************************************************************
+		Live State
+		************************************************************/
+		{Class: "faultInst", Shard: ShardNode}, // Faults
+		{Class: "fvcapRule"},                   // Capacity rules
+
+		// Endpoint learning anomalies
+		{ // Rogue endpoint events
+			Class:     "eventRecord",
+			Prefix:    "epRogue",
+			Mods:      []Mod{endpointEventsSince("rogue", epHistory)},
+			Sensitive: true,
+		},
+		{ // Endpoint move events
+			Class:     "eventRecord",
+			Prefix:    "epMove",
+			Mods:      []Mod{endpointEventsSince("moved", epHistory)},
+			Sensitive: true,
+		},
+
+		{ // Endpoint count
+			Class:  "fvCEp",
+			Filter: "#.moCount.attributes",
+			Mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
+		},
+		{ // IP count
+			Class:  "fvIp",
+			Filter: "#.moCount.attributes",
+			Mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
+		},
+
+		{ // L4-L7 container count
+			Class:  "vnsCDev",
+			Filter: "#.moCount.attributes",
+			Mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
+		},
+
+		{ // L4-L7 service graph count
+			Class:  "vnsGraphInst",
+			Filter: "#.moCount.attributes",
+			Mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
+		},
+
+		{ // MO count by node
+			Class:  "ctxClassCnt",
+			Filter: "#.moCount.attributes",
+			Mods:   []Mod{goaci.Query("rsp-subtree-class", "l2BD,fvEpP,l3Dom")},
+		},
+
+		// Fabric health
+		{Class: "fabricHealthTotal", Stats: true}, // Total and per-pod health scores
+		{ // Per-device health stats
+			Class:  "topSystem",
+			Prefix: "heatlhInst",
+			Mods:   []Mod{goaci.Query("rsp-subtree-include", "health,no-scoped")},
+			Filter: "#.attributes.healthInst",
+			Stats:  true,
+		},
+
+		// Switch capacity. The remote and total stats came with forwarding
+		// scale profiles.
+		{Class: "eqptcapacityVlanUsage5min", Stats: true},                           // VLAN
+		{Class: "eqptcapacityPolUsage5min", Stats: true},                            // TCAM
+		{Class: "eqptcapacityL2Usage5min", Stats: true},                             // L2 local
+		{Class: "eqptcapacityL2RemoteUsage5min", MinVersion: "3.2", Stats: true},    // L2 remote
+		{Class: "eqptcapacityL2TotalUsage5min", MinVersion: "3.2", Stats: true},     // L2 total
+		{Class: "eqptcapacityL3Usage5min", Stats: true},                             // L3 local
+		{Class: "eqptcapacityL3UsageCap5min", Stats: true},                          // L3 local cap
+		{Class: "eqptcapacityL3RemoteUsage5min", MinVersion: "3.2", Stats: true},    // L3 remote
+		{Class: "eqptcapacityL3RemoteUsageCap5min", MinVersion: "3.2", Stats: true}, // L3 remote cap
+		{Class: "eqptcapacityL3TotalUsage5min", MinVersion: "3.2", Stats: true},     // L3 total
+		{Class: "eqptcapacityL3TotalUsageCap5min", MinVersion: "3.2", Stats: true},  // L3 total cap
+		{Class: "eqptcapacityMcastUsage5min", Stats: true},                          // Multicast
+
+		// Node CPU, memory and temperature
+		{Class: "procSysCPU5min", Stats: true}, // CPU utilization
+		{Class: "procSysMem5min", Stats: true}, // Memory utilization
+		{Class: "eqptTemp5min", Stats: true},   // Sensor temperatures
+
+		// Interface error counters
+		{Class: "rmonEtherStats", Shard: ShardNode, Stats: true}, // CRC errors and drops
+		{Class: "rmonDot3Stats", Shard: ShardNode, Stats: true},  // FCS and alignment errors
+		{Class: "rmonIfIn", Shard: ShardNode, Stats: true},       // Input errors and discards
+		{Class: "rmonIfOut", Shard: ShardNode, Stats: true},      // Output errors and discards
+	}
+
+	return WithDefaults(reqs)
+}
+
+// CloudRequests returns the request catalog for Cloud APIC, which manages
+// tenants in AWS or Azure rather than an on-premises fabric.
+func CloudRequests() []*Request {
+	reqs := []*Request{
+		/************************************************************
+		Infrastructure
+		************************************************************/
+		{Class: "topSystem"},                 // Controllers and cloud routers
+		{Class: "infraWiNode"},               // APIC cluster health
+		{Class: "firmwareCtrlrRunning"},      // Controller firmware
+		{Class: "cloudProvP"},                // Cloud provider
+		{Class: "cloudRegion"},               // Regions
+		{Class: "cloudtemplateInfraNetwork"}, // Infra network template
+		{Class: "cloudtemplateIntNetwork"},   // Internal network template
+		{Class: "cloudtemplateExtNetwork"},   // External network template
+
+		/************************************************************
+		Tenants
+		************************************************************/
+		// Primary constructs
+		{Class: "fvTenant"},                  // Tenant
+		{Class: "fvCtx"},                     // VRF
+		{Class: "cloudCtxProfile"},           // Cloud context profile (VPC/VNet)
+		{Class: "cloudRsCtxProfileToRegion"}, // Context profile --> region
+		{Class: "cloudRsToCtx"},              // Context profile --> VRF
+		{Class: "cloudCidr"},                 // CIDR
+		{Class: "cloudSubnet"},               // Subnet
+		{Class: "cloudApp"},                  // Cloud application profile
+		{Class: "cloudEPg"},                  // Cloud EPG
+		{Class: "cloudRsCloudEPgCtx"},        // Cloud EPG --> VRF
+		{Class: "cloudEPSelector"},           // Cloud EPG selector
+		{Class: "cloudExtEPg"},               // Cloud external EPG
+		{Class: "cloudExtEPSelector"},        // Cloud external EPG selector
+
+		// Contracts
+		{Class: "vzBrCP"},          // Contract
+		{Class: "vzFilter"},        // Filter
+		{Class: "vzSubj"},          // Subject
+		{Class: "vzRsSubjFiltAtt"}, // Subject --> filter
+		{Class: "fvRsProv"},        // EPG --> contract provided
+		{Class: "fvRsCons"},        // EPG --> contract consumed
+
+		/************************************************************
+		Cloud resources discovered in the provider
+		************************************************************/
+		{Class: "hcloudRegion"},                    // Regions in use
+		{Class: "hcloudCtx"},                       // VPCs/VNets
+		{Class: "hcloudCidr"},                      // VPC/VNet CIDRs
+		{Class: "hcloudSubnet"},                    // Subnets
+		{Class: "hcloudCsr"},                       // Cloud routers
+		{Class: "hcloudSecurityGroup"},             // Security groups
+		{Class: "hcloudSgRule"},                    // Security group rules
+		{Class: "hcloudRouteTable"},                // Route tables
+		{Class: "hcloudEndPoint", Sensitive: true}, // Cloud endpoints, e.g. VM interfaces
+
+		/************************************************************
+		Live State
+		************************************************************/
+		{Class: "faultInst"},                      // Faults
+		{Class: "fabricHealthTotal", Stats: true}, // Total health score
+	}
+
+	return WithDefaults(reqs)
+}
+
+// WithDefaults fills in the default filter, path and prefix for the class.
+func WithDefaults(reqs []*Request) []*Request {
+	for _, req := range reqs {
+		if req.Filter == "" {
+			req.Filter = fmt.Sprintf("#.%s.attributes", req.Class)
+		}
+		if req.Path == "" {
+			req.Path = "/api/class/" + req.Class
+		}
+		if req.Prefix == "" {
+			req.Prefix = req.Class
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventRecordRequests(t *testing.T) {
+	a := assert.New(t)
+	events := make(map[string]*Request)
+	for _, req := range Requests() {
+		if req.Class == "eventRecord" {
+			events[req.Prefix] = req
+		}
+	}
+	a.Len(events, 2)
+	for prefix, descr := range map[string]string{"epRogue": "rogue", "epMove": "moved"} {
+		req := events[prefix]
+		if !a.NotNil(req, prefix) {
+			continue
+		}
+		a.True(req.Sensitive, prefix)
+		a.Equal("/api/class/eventRecord", req.Path)
+		filter := shardFilters([]*Request{req})[0]
+		a.Regexp(`^and\(gt\(eventRecord\.created,"\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d"\),wcard\(eventRecord\.descr,"`+descr+`"\)\)$`, filter)
+	}
+}
+
+func TestForHistory(t *testing.T) {
+	a := assert.New(t)
+	reqs := ForHistory(Requests(), 30*24*time.Hour)
+	month := time.Now().Add(-30 * 24 * time.Hour).UTC().Format("2006-01-02")
+	for _, req := range reqs {
+		if _, ok := endpointEvents[req.Prefix]; ok {
+			a.Contains(shardFilters([]*Request{req})[0], `gt(eventRecord.created,"`+month, req.Prefix)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+)
+
+// Request shards, splitting a huge class into DN-scoped requests so that
+// each response stays within the APIC's limits.
+const (
+	ShardTenant = "tenant" // A request per tenant, from the fvTenant records
+	ShardPod    = "pod"    // A request per pod, from the topSystem records
+	ShardNode   = "node"   // A request per node, from the topSystem records
+	ShardSpine  = "spine"  // A request per spine, from the topSystem records
+)
+
+// ShardedRequests splits the requests into those to be sharded and the
+// others.
+func ShardedRequests(reqs []*Request) (sharded, other []*Request) {
+	for _, req := range reqs {
+		if req.Shard != "" {
+			sharded = append(sharded, req)
+		} else {
+			other = append(other, req)
+		}
+	}
+	return sharded, other
+}
+
+// shardScopes returns the DN prefixes of a shard, e.g. uni/tn-common/ per
+// tenant, and a pattern matching every scope, for the records outside them.
+func shardScopes(shard string, responses map[string]goaci.Res) (scopes []string, all string) {
+	seen := make(map[string]bool)
+	switch shard {
+	case ShardTenant:
+		for _, tenant := range responses["fvTenant"].Array() {
+			if dn := tenant.Get("dn").Str; dn != "" {
+				seen[dn+"/"] = true
+			}
+		}
+		all = "^uni/tn-"
+	case ShardPod, ShardNode, ShardSpine:
+		for _, node := range responses["topSystem"].Array() {
+			dn := strings.TrimSuffix(node.Get("dn").Str, "/sys")
+			if !strings.HasPrefix(dn, "topology/pod-") {
+				continue
+			}
+			if shard == ShardSpine && node.Get("role").Str != "spine" {
+				continue
+			}
+			if shard == ShardPod {
+				dn = strings.Join(strings.SplitN(dn, "/", 3)[:2], "/")
+			}
+			seen[dn+"/"] = true
+		}
+		all = "^topology/pod-[0-9]+/"
+		if shard != ShardPod {
+			all += "node-[0-9]+/"
+		}
+	}
+	for scope := range seen {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes, all
+}
+
+// andFilter returns the modifiers of a request with an additional query
+// filter, combined with any filter of the request.
+func andFilter(req *Request, filter string) []Mod {
+	client := goaci.Client{}
+	if f := client.NewReq("GET", req.Path, nil, req.Mods...).HttpReq.URL.Query().Get("query-target-filter"); f != "" {
+		filter = fmt.Sprintf("and(%s,%s)", f, filter)
+	}
+	// Replacing the request's filter, as queries are added
+	return append(append([]Mod{}, req.Mods...), func(r *goaci.Req) {
+		q := r.HttpReq.URL.Query()
+		q.Set("query-target-filter", filter)
+		r.HttpReq.URL.RawQuery = q.Encode()
+	})
+}
+
+// shardRequests returns the DN-scoped requests of a sharded request: one per
+// scope, and one for the records outside every scope. Any filter of the
+// request applies to every shard. shardRequests returns the request itself
+// if there are no scopes, e.g. as the tenants or nodes weren't collected.
+func shardRequests(req *Request, responses map[string]goaci.Res) []*Request {
+	scopes, all := shardScopes(req.Shard, responses)
+	if len(scopes) == 0 {
+		return []*Request{req}
+	}
+	shard := func(f string) *Request {
+		return &Request{Class: req.Class, Path: req.Path, Prefix: req.Prefix, Filter: req.Filter, Mods: andFilter(req, f)}
+	}
+	var shards []*Request
+	for _, scope := range scopes {
+		shards = append(shards, shard(fmt.Sprintf(`wcard(%s.dn,"^%s")`, req.Class, scope)))
+	}
+	return append(shards, shard(fmt.Sprintf(`not(wcard(%s.dn,"%s"))`, req.Class, all)))
+}
+
+// Shards returns the DN-scoped requests of the sharded requests, with the
+// tenants and nodes of the responses, e.g. to plan them.
+func Shards(reqs []*Request, responses map[string]goaci.Res) []*Request {
+	var shards []*Request
+	for _, req := range reqs {
+		shards = append(shards, shardRequests(req, responses)...)
+	}
+	return shards
+}
+
+// FetchShards fetches the sharded requests through the worker pool into the
+// sink, with the tenants and nodes of the responses already collected. The
+// shards' results are recorded on the sharded request; as its records would
+// be incomplete, a class with a failed shard is dropped from the sink. Only
+// a failed sink returns an error.
+func FetchShards(client Getter, reqs []*Request, responses map[string]goaci.Res, limits Limits, sink Sink, log zerolog.Logger) error {
+	var all []*Request
+	shards := make(map[*Request][]*Request)
+	for _, req := range reqs {
+		shards[req] = shardRequests(req, responses)
+		all = append(all, shards[req]...)
+		log.Debug().Str("resource", req.Prefix).Int("shards", len(shards[req])).Msg("sharding request")
+	}
+	// Errors are recorded on the shards
+	FetchTo(client, all, limits, sink, log)
+	for _, req := range reqs {
+		if len(shards[req]) == 1 && shards[req][0] == req {
+			continue
+		}
+		req.Skipped = true
+		for _, shard := range shards[req] {
+			req.Elapsed += shard.Elapsed
+			req.Size += shard.Size
+			req.Skipped = req.Skipped && shard.Skipped
+			if shard.Err != nil && req.Err == nil {
+				req.Err = shard.Err
+			}
+		}
+		if req.Err != nil {
+			if err := sink.Drop(req.Prefix); err != nil {
+				log.Error().Err(err).Str("resource", req.Prefix).Msg("cannot drop incomplete records")
+			}
+		}
+	}
+	return sink.Flush()
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// shardFilters returns the query filters of requests.
+func shardFilters(reqs []*Request) []string {
+	client := goaci.Client{}
+	var filters []string
+	for _, req := range reqs {
+		filters = append(filters, client.NewReq("GET", req.Path, nil, req.Mods...).HttpReq.URL.Query().Get("query-target-filter"))
+	}
+	return filters
+}
+
+func TestShardRequests(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-b"}, {"dn": "uni/tn-a"}]`),
+		"topSystem": gjson.Parse(`[
+			{"dn": "topology/pod-1/node-1/sys", "role": "controller"},
+			{"dn": "topology/pod-1/node-101/sys", "role": "leaf"},
+			{"dn": "topology/pod-1/node-1001/sys", "role": "spine"},
+			{"dn": "topology/pod-2/node-201/sys", "role": "leaf"}
+		]`),
+	}
+
+	req := WithDefaults([]*Request{{Class: "faultInst", Shard: ShardNode}})[0]
+	a.Equal([]string{
+		`wcard(faultInst.dn,"^topology/pod-1/node-1/")`,
+		`wcard(faultInst.dn,"^topology/pod-1/node-1001/")`,
+		`wcard(faultInst.dn,"^topology/pod-1/node-101/")`,
+		`wcard(faultInst.dn,"^topology/pod-2/node-201/")`,
+		`not(wcard(faultInst.dn,"^topology/pod-[0-9]+/node-[0-9]+/"))`,
+	}, shardFilters(shardRequests(req, responses)))
+
+	// Spine shards skip the leaves and controllers
+	req = WithDefaults([]*Request{{Class: "coopEpRec", Shard: ShardSpine}})[0]
+	a.Equal([]string{
+		`wcard(coopEpRec.dn,"^topology/pod-1/node-1001/")`,
+		`not(wcard(coopEpRec.dn,"^topology/pod-[0-9]+/node-[0-9]+/"))`,
+	}, shardFilters(shardRequests(req, responses)))
+
+	req = WithDefaults([]*Request{{Class: "faultInst", Shard: ShardPod}})[0]
+	a.Equal([]string{
+		`wcard(faultInst.dn,"^topology/pod-1/")`,
+		`wcard(faultInst.dn,"^topology/pod-2/")`,
+		`not(wcard(faultInst.dn,"^topology/pod-[0-9]+/"))`,
+	}, shardFilters(shardRequests(req, responses)))
+
+	// Filters of the request apply to every shard
+	req = WithDefaults([]*Request{{
+		Class: "fvRsPathAtt",
+		Shard: ShardTenant,
+		Mods:  []Mod{goaci.Query("query-target-filter", `eq(fvRsPathAtt.mode,"regular")`)},
+	}})[0]
+	a.Equal([]string{
+		`and(eq(fvRsPathAtt.mode,"regular"),wcard(fvRsPathAtt.dn,"^uni/tn-a/"))`,
+		`and(eq(fvRsPathAtt.mode,"regular"),wcard(fvRsPathAtt.dn,"^uni/tn-b/"))`,
+		`and(eq(fvRsPathAtt.mode,"regular"),not(wcard(fvRsPathAtt.dn,"^uni/tn-")))`,
+	}, shardFilters(shardRequests(req, responses)))
+
+	// Without tenants or nodes, the class is queried as a whole
+	a.Equal([]*Request{req}, shardRequests(req, map[string]goaci.Res{}))
+}
+
+func TestShards(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}]`),
+	}
+	reqs := WithDefaults([]*Request{
+		{Class: "fvRsPathAtt", Shard: ShardTenant},
+		{Class: "faultInst", Shard: ShardNode},
+	})
+	a.Equal([]string{
+		`wcard(fvRsPathAtt.dn,"^uni/tn-a/")`,
+		`not(wcard(fvRsPathAtt.dn,"^uni/tn-"))`,
+		"",
+	}, shardFilters(Shards(reqs, responses)))
+}
+
+// shardGetter fails the shard of one node.
+type shardGetter struct {
+	fail string
+}
+
+func (g shardGetter) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	filter := shardFilters([]*Request{{Path: path, Mods: mods}})[0]
+	if filter == `wcard(faultInst.dn,"^`+g.fail+`")` {
+		return goaci.Res{}, errors.New("received HTTP status 500")
+	}
+	return gjson.Parse(`{"imdata": [{"faultInst": {"attributes": {"dn": "topology/pod-1/node-101/sys/fault-F0532"}}}]}`), nil
+}
+
+func TestFetchShards(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	responses := map[string]goaci.Res{
+		"topSystem": gjson.Parse(`[{"dn": "topology/pod-1/node-101/sys"}, {"dn": "topology/pod-1/node-102/sys"}]`),
+	}
+
+	reqs := WithDefaults([]*Request{{Class: "faultInst", Shard: ShardNode}})
+	sink := newResponseSink()
+	FetchShards(shardGetter{}, reqs, responses, Limits{}, sink, log)
+	a.Len(sink.responses()["faultInst"].Array(), 3)
+	a.Empty(FailedClasses(reqs))
+	a.True(reqs[0].Size > 0)
+
+	// A failed shard fails the class, as its records would be incomplete
+	reqs = WithDefaults([]*Request{{Class: "faultInst", Shard: ShardNode}})
+	sink = newResponseSink()
+	FetchShards(shardGetter{fail: "topology/pod-1/node-102/"}, reqs, responses, Limits{}, sink, log)
+	a.NotContains(sink.responses(), "faultInst")
+	a.Equal(map[string]string{"faultInst": "received HTTP status 500"}, FailedClasses(reqs))
+}
+
+// planGetter counts the planned requests.
+type planGetter struct {
+	shardGetter
+	planned *int
+}
+
+func (g planGetter) Plan(n int) { *g.planned += n }
+
+func TestFetchShardsPlan(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	responses := map[string]goaci.Res{
+		"topSystem": gjson.Parse(`[{"dn": "topology/pod-1/node-101/sys"}, {"dn": "topology/pod-1/node-102/sys"}]`),
+	}
+	var planned int
+	reqs := WithDefaults([]*Request{{Class: "faultInst", Shard: ShardNode}})
+	FetchShards(planGetter{planned: &planned}, reqs, responses, Limits{}, newResponseSink(), log)
+	// A shard per node and one for the records outside the nodes
+	a.Equal(3, planned)
+}
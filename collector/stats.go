@@ -0,0 +1,19 @@
+package collector
+
+// WithoutStats removes the health and capacity stats requests for a
+// config-only collection, returning the remaining requests and the prefixes
+// left out.
+func WithoutStats(reqs []*Request) ([]*Request, []string) {
+	var (
+		kept    []*Request
+		skipped []string
+	)
+	for _, req := range reqs {
+		if req.Stats {
+			skipped = append(skipped, req.Prefix)
+			continue
+		}
+		kept = append(kept, req)
+	}
+	return kept, skipped
+}
@@ -0,0 +1,26 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutStats(t *testing.T) {
+	a := assert.New(t)
+	reqs, skipped := WithoutStats(Requests())
+	a.Contains(skipped, "eqptcapacityPolUsage5min")
+	a.Contains(skipped, "heatlhInst")
+	a.Contains(skipped, "fabricHealthTotal")
+	a.Len(append(reqs, make([]*Request, len(skipped))...), len(Requests()))
+	for _, req := range reqs {
+		a.NotContains(req.Class, "eqptcapacity")
+	}
+	// Policy and the controllers are still collected
+	var prefixes []string
+	for _, req := range reqs {
+		prefixes = append(prefixes, req.Prefix)
+	}
+	a.Contains(prefixes, "fvBD")
+	a.Contains(prefixes, "topSystem")
+}
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+)
+
+// Token lifetime after which goaci refreshes the token before a request.
+const tokenRefresh = 480 * time.Second
+
+// RecordStreamer streams the records of a response rather than buffering the
+// whole body, e.g. a Pool.
+type RecordStreamer interface {
+	StreamRecords(path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error)
+}
+
+// countingReader counts the uncompressed bytes read from a response body.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += n
+	return n, err
+}
+
+// Most of an APIC error response that's read for the error text.
+const maxErrorBody = 1 << 16
+
+// APIError is a request the APIC failed, with the text of the APIC error in
+// the response, e.g. for a class it doesn't know.
+type APIError struct {
+	Status int
+	Text   string // imdata.0.error.attributes.text, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("received HTTP status %d", e.Status)
+	}
+	return fmt.Sprintf("received HTTP status %d: %s", e.Status, e.Text)
+}
+
+// responseBody reads a body, closing both it and any decompressor.
+type responseBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b responseBody) Close() error {
+	for _, c := range b.closers {
+		c.Close()
+	}
+	return nil
+}
+
+// openResponse makes a GET request for a gzip-compressed response and
+// returns the decompressed body. A failed request returns an APIError, as
+// goaci doesn't expose the body of the APIC error.
+func openResponse(client *goaci.Client, path string, mods ...func(*goaci.Req)) (io.ReadCloser, error) {
+	req := client.NewReq("GET", path, nil, mods...)
+	if req.Refresh && time.Since(client.LastRefresh) > tokenRefresh {
+		if err := client.Refresh(); err != nil {
+			return nil, err
+		}
+	}
+	// Request gzip explicitly rather than relying on the transport, which
+	// doesn't decompress the response once the header is set
+	req.HttpReq.Header.Set("Accept-Encoding", "gzip")
+	httpRes, err := client.HttpClient.Do(req.HttpReq)
+	if err != nil {
+		return nil, err
+	}
+	body := responseBody{Reader: httpRes.Body, closers: []io.Closer{httpRes.Body}}
+	if httpRes.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(httpRes.Body)
+		if err != nil && httpRes.StatusCode == http.StatusOK {
+			httpRes.Body.Close()
+			return nil, fmt.Errorf("cannot decompress response body: %v", err)
+		}
+		if err == nil {
+			body = responseBody{Reader: gz, closers: []io.Closer{gz, httpRes.Body}}
+		}
+	}
+	if httpRes.StatusCode != http.StatusOK {
+		defer body.Close()
+		b, _ := ioutil.ReadAll(io.LimitReader(body, maxErrorBody))
+		return nil, &APIError{
+			Status: httpRes.StatusCode,
+			Text:   gjson.GetBytes(b, "imdata.0.error.attributes.text").Str,
+		}
+	}
+	return body, nil
+}
+
+// getResponse makes a GET request like goaci's Get, but with the APIC error
+// of a failed request.
+func getResponse(client *goaci.Client, path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	body, err := openResponse(client, path, mods...)
+	if err != nil {
+		return goaci.Res{}, err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return goaci.Res{}, fmt.Errorf("cannot read response body: %v", err)
+	}
+	return gjson.ParseBytes(b), nil
+}
+
+// streamRecords makes a GET request and decodes the imdata elements one at a
+// time, passing the filtered part of each to fn as it's decoded, so large
+// responses, e.g. faultInst, are never held in memory. The filter must apply
+// to each element, i.e. start with #. It returns the response size; an error
+// from fn stops the request.
+func streamRecords(client *goaci.Client, path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error) {
+	r, err := openResponse(client, path, mods...)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	body := &countingReader{r: r}
+	var fnErr error
+	err = decodeImdata(body, func(element json.RawMessage) error {
+		record := gjson.GetBytes(element, strings.TrimPrefix(filter, "#."))
+		if !record.Exists() {
+			return nil
+		}
+		fnErr = fn(record)
+		return fnErr
+	})
+	if fnErr != nil {
+		return body.n, fnErr
+	}
+	if err != nil {
+		return body.n, fmt.Errorf("cannot decode response body: %v", err)
+	}
+	return body.n, nil
+}
+
+// decodeImdata calls fn for each element of the imdata array of a response,
+// skipping the other fields, e.g. totalCount. An error from fn stops the
+// decoding and is returned.
+func decodeImdata(r io.Reader, fn func(json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if token != "imdata" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var element json.RawMessage
+			if err := dec.Decode(&element); err != nil {
+				return err
+			}
+			if err := fn(element); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
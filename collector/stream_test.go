@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestDecodeImdata(t *testing.T) {
+	a := assert.New(t)
+	var elements []string
+	body := `{"totalCount": "2", "imdata": [{"fvTenant": {}}, {"fvBD": {}}], "extra": {"a": [1]}}`
+	a.NoError(decodeImdata(strings.NewReader(body), func(e json.RawMessage) error {
+		elements = append(elements, string(e))
+		return nil
+	}))
+	a.Equal([]string{`{"fvTenant": {}}`, `{"fvBD": {}}`}, elements)
+
+	a.Error(decodeImdata(strings.NewReader(`{"imdata": [{"fvTenant": {}}`), func(json.RawMessage) error { return nil }))
+	a.Error(decodeImdata(strings.NewReader(`[]`), func(json.RawMessage) error { return nil }))
+
+	// An error from fn stops the decoding
+	elements = nil
+	err := decodeImdata(strings.NewReader(body), func(e json.RawMessage) error {
+		elements = append(elements, string(e))
+		return errors.New("full")
+	})
+	a.EqualError(err, "full")
+	a.Len(elements, 1)
+}
+
+// collect returns a callback that adds the streamed records to an array.
+func collect(records *[]string) func(goaci.Res) error {
+	return func(record goaci.Res) error {
+		*records = append(*records, record.Raw)
+		return nil
+	}
+}
+
+func TestStreamRecords(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	body := `{"totalCount":"3","imdata":[` +
+		`{"fvTenant":{"attributes":{"dn":"uni/tn-a"}}},` +
+		`{"fvBD":{"attributes":{"dn":"uni/tn-a/BD-b"}}},` +
+		`{"fvTenant":{"attributes":{"dn":"uni/tn-c"}}}]}`
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		Persist().
+		Reply(200).
+		BodyString(body)
+	gock.New("https://apic").
+		Get("/api/class/fvNewClass.json").
+		Reply(400).
+		BodyString(goaci.Body{}.Set("imdata.0.error.attributes.text", "Request failed, unresolved class for fvNewClass").Str)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	for _, filter := range []string{"#.fvTenant.attributes", "#.*.attributes"} {
+		var records []string
+		size, err := streamRecords(&client, "/api/class/fvTenant", filter, collect(&records))
+		if a.NoError(err) {
+			a.Equal(len(body), size)
+			a.Equal(gjson.Get(body, "imdata."+filter).String(), "["+strings.Join(records, ",")+"]", filter)
+		}
+	}
+	_, err := streamRecords(&client, "/api/class/fvNewClass", "#.fvNewClass.attributes", collect(new([]string)))
+	if a.Error(err) {
+		a.True(IsUnsupportedClass(err))
+	}
+
+	// An error from the callback, e.g. a failed db write, fails the request
+	_, err = streamRecords(&client, "/api/class/fvTenant", "#.fvTenant.attributes", func(goaci.Res) error {
+		return errors.New("cannot write to DB file")
+	})
+	a.EqualError(err, "cannot write to DB file")
+}
+
+func TestStreamRecordsGzip(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	body := `{"totalCount":"1","imdata":[{"faultInst":{"attributes":{"dn":"topology/pod-1/node-101/fault-F0532"}}}]}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(body))
+	gz.Close()
+	gock.New("https://apic").
+		Get("/api/class/faultInst.json").
+		MatchHeader("Accept-Encoding", "gzip").
+		Reply(200).
+		SetHeader("Content-Encoding", "gzip").
+		Body(&compressed)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	var records []string
+	size, err := streamRecords(&client, "/api/class/faultInst", "#.faultInst.attributes", collect(&records))
+	if a.NoError(err) {
+		a.Equal(len(body), size)
+		if a.Len(records, 1) {
+			a.Equal("topology/pod-1/node-101/fault-F0532", gjson.Get(records[0], "dn").Str)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/tidwall/gjson"
+	"golang.org/x/sync/errgroup"
+)
+
+// Classes below the tenant that can be fetched with a subtree query per
+// tenant rather than a query per class.
+var tenantClasses = map[string]bool{
+	"fvAEPg":              true,
+	"fvRsBd":              true,
+	"fvBD":                true,
+	"fvCtx":               true,
+	"fvSubnet":            true,
+	"vzBrCP":              true,
+	"vzFilter":            true,
+	"vzSubj":              true,
+	"vzRsSubjFiltAtt":     true,
+	"fvRsProv":            true,
+	"fvRsCons":            true,
+	"l3extOut":            true,
+	"l3extLNodeP":         true,
+	"l3extRsNodeL3OutAtt": true,
+	"l3extLIfP":           true,
+	"l3extInstP":          true,
+}
+
+// TenantRequests splits the requests into the plain class queries of tenant
+// classes and the others.
+func TenantRequests(reqs []*Request) (tenant, other []*Request) {
+	for _, req := range reqs {
+		if tenantClasses[req.Class] && req.Mods == nil &&
+			req.Path == "/api/class/"+req.Class && req.Filter == "#."+req.Class+".attributes" {
+			tenant = append(tenant, req)
+		} else {
+			other = append(other, req)
+		}
+	}
+	return tenant, other
+}
+
+// TenantSubtrees returns the subtree query of the requests' classes for each
+// tenant of the tenant query's records, prefixed with the tenant's DN.
+func TenantSubtrees(reqs []*Request, tenants goaci.Res) []*Request {
+	var classes []string
+	for _, req := range reqs {
+		classes = append(classes, req.Class)
+	}
+	var subtrees []*Request
+	for _, tenant := range tenants.Array() {
+		dn := tenant.Get("dn").Str
+		if dn == "" {
+			continue
+		}
+		subtrees = append(subtrees, &Request{
+			Class:  "fvTenant",
+			Path:   "/api/mo/" + dn,
+			Prefix: dn,
+			Mods: []Mod{
+				goaci.Query("query-target", "subtree"),
+				goaci.Query("target-subtree-class", strings.Join(classes, ",")),
+			},
+		})
+	}
+	return subtrees
+}
+
+// FetchTenants makes a subtree query of the requests' classes per tenant,
+// e.g.
+//
+//	/api/mo/uni/tn-common.json?query-target=subtree&target-subtree-class=fvBD,fvCtx
+//
+// fanning the records out to the requests' classes, as if each class were
+// queried fabric-wide, and writing them to the sink a tenant at a time. The
+// tenants are the records of the tenant query. As the records of a failed
+// tenant would be missing, a failed tenant fails every request. Only a
+// failed sink returns an error.
+func FetchTenants(client Getter, reqs []*Request, tenants goaci.Res, limits Limits, sink Sink, log zerolog.Logger) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	var classes []string
+	prefixes := make(map[string]string)
+	for _, req := range reqs {
+		classes = append(classes, req.Class)
+		prefixes[req.Class] = req.Prefix
+	}
+	subtrees := TenantSubtrees(reqs, tenants)
+	log.Info().Int("tenants", len(subtrees)).Strs("classes", classes).Msg("fetching tenant subtrees...")
+	plan(client, len(subtrees))
+
+	startTime := time.Now()
+	var (
+		mu     sync.Mutex
+		sizes  = make(map[string]int)
+		failed error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed == nil {
+			failed = err
+		}
+	}
+	jobs := make(chan *Request)
+	go func() {
+		for _, subtree := range subtrees {
+			jobs <- subtree
+		}
+		close(jobs)
+	}()
+	var g errgroup.Group
+	for i := 0; i < limits.workers(len(subtrees)); i++ {
+		g.Go(func() error {
+			for subtree := range jobs {
+				log.Debug().Str("tenant", subtree.Prefix).Msg("requesting tenant subtree")
+				res, err := client.Get(subtree.Path, subtree.Mods...)
+				if err != nil {
+					fail(fmt.Errorf("cannot fetch subtree of %s: %v", subtree.Prefix, err))
+					continue
+				}
+				records := make(map[string][]goaci.Res)
+				for _, mo := range res.Get("imdata").Array() {
+					mo.ForEach(func(class, body gjson.Result) bool {
+						records[class.Str] = append(records[class.Str], body.Get("attributes"))
+						return true
+					})
+				}
+				for class, batch := range records {
+					prefix, ok := prefixes[class]
+					if !ok {
+						continue
+					}
+					if err := sink.Write(prefix, batch); err != nil {
+						fail(err)
+					}
+					mu.Lock()
+					for _, record := range batch {
+						sizes[prefix] += len(record.Raw)
+					}
+					mu.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	elapsed := time.Since(startTime)
+	for _, req := range reqs {
+		req.Elapsed = elapsed
+		err := failed
+		if err == nil {
+			// The class is collected even without records
+			err = sink.Write(req.Prefix, nil)
+		}
+		if err != nil {
+			req.Err = err
+			log.Error().Err(err).Str("resource", req.Prefix).Msg("failed to make request")
+			if err := sink.Drop(req.Prefix); err != nil {
+				log.Error().Err(err).Str("resource", req.Prefix).Msg("cannot drop incomplete records")
+			}
+			continue
+		}
+		req.Size = sizes[req.Prefix]
+	}
+	return sink.Flush()
+}
+
+// ForTenants restricts the tenant and tenant classes to the named tenants.
+// The fabric-wide classes, including the infra and access policy, are
+// unchanged.
+func ForTenants(reqs []*Request, names []string) []*Request {
+	for _, req := range reqs {
+		var filters []string
+		for _, name := range names {
+			switch {
+			case req.Class == "fvTenant":
+				filters = append(filters, fmt.Sprintf(`eq(fvTenant.dn,"uni/tn-%s")`, name))
+			case tenantClasses[req.Class]:
+				filters = append(filters, fmt.Sprintf(`wcard(%s.dn,"^uni/tn-%s/")`, req.Class, name))
+			}
+		}
+		switch len(filters) {
+		case 0:
+			continue
+		case 1:
+			req.Mods = andFilter(req, filters[0])
+		default:
+			req.Mods = andFilter(req, "or("+strings.Join(filters, ",")+")")
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// tenantGetter answers tenant subtree queries, failing for one tenant.
+type tenantGetter struct {
+	fail string
+}
+
+func (g tenantGetter) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	client := goaci.Client{}
+	req := client.NewReq("GET", path, nil, mods...)
+	query := req.HttpReq.URL.Query()
+	if query.Get("query-target") != "subtree" || query.Get("target-subtree-class") != "fvBD,fvCtx" {
+		return goaci.Res{}, errors.New("unexpected query")
+	}
+	switch path {
+	case "/api/mo/" + g.fail:
+		return goaci.Res{}, errors.New("received HTTP status 500")
+	case "/api/mo/uni/tn-a":
+		return gjson.Parse(`{"imdata": [
+			{"fvBD": {"attributes": {"dn": "uni/tn-a/BD-one"}}},
+			{"fvCtx": {"attributes": {"dn": "uni/tn-a/ctx-one"}}},
+			{"fvBD": {"attributes": {"dn": "uni/tn-a/BD-two"}}}
+		]}`), nil
+	}
+	return gjson.Parse(`{"imdata": [{"fvBD": {"attributes": {"dn": "uni/tn-b/BD-one"}}}]}`), nil
+}
+
+func TestTenantRequests(t *testing.T) {
+	a := assert.New(t)
+	tenant, other := TenantRequests(Requests())
+	var classes []string
+	for _, req := range tenant {
+		classes = append(classes, req.Class)
+	}
+	a.Contains(classes, "fvBD")
+	a.Contains(classes, "l3extOut")
+	a.NotContains(classes, "fvTenant")
+	for _, req := range other {
+		a.NotEqual("fvBD", req.Class)
+	}
+	a.Len(append(tenant, other...), len(Requests()))
+}
+
+func TestTenantSubtrees(t *testing.T) {
+	a := assert.New(t)
+	tenants := gjson.Parse(`[{"dn": "uni/tn-a"}, {"name": "b"}]`)
+	subtrees := TenantSubtrees(WithDefaults([]*Request{{Class: "fvBD"}, {Class: "fvCtx"}}), tenants)
+	if a.Len(subtrees, 1) {
+		a.Equal("uni/tn-a", subtrees[0].Prefix)
+		req := goaci.Client{}.NewReq("GET", subtrees[0].Path, nil, subtrees[0].Mods...)
+		a.Equal("/api/mo/uni/tn-a.json", req.HttpReq.URL.Path)
+		a.Equal("fvBD,fvCtx", req.HttpReq.URL.Query().Get("target-subtree-class"))
+	}
+}
+
+func TestFetchTenants(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	tenants := gjson.Parse(`[{"dn": "uni/tn-a"}, {"dn": "uni/tn-b"}]`)
+
+	reqs := WithDefaults([]*Request{{Class: "fvBD"}, {Class: "fvCtx"}})
+	sink := newResponseSink()
+	FetchTenants(tenantGetter{}, reqs, tenants, Limits{}, sink, log)
+	results := sink.responses()
+	a.Len(results["fvBD"].Array(), 3)
+	a.Equal("uni/tn-a/ctx-one", results["fvCtx"].Get("0.dn").Str)
+	a.Empty(FailedClasses(reqs))
+
+	// A failed tenant fails every class, as its records would be missing
+	reqs = WithDefaults([]*Request{{Class: "fvBD"}, {Class: "fvCtx"}})
+	sink = newResponseSink()
+	FetchTenants(tenantGetter{fail: "uni/tn-b"}, reqs, tenants, Limits{}, sink, log)
+	a.Empty(sink.responses())
+	failed := FailedClasses(reqs)
+	a.Len(failed, 2)
+	a.Contains(failed["fvBD"], "uni/tn-b")
+}
+
+func TestForTenants(t *testing.T) {
+	a := assert.New(t)
+	reqs := ForTenants(WithDefaults([]*Request{
+		{Class: "fvTenant"},
+		{Class: "fvBD"},
+		{Class: "infraAccPortP"},
+	}), []string{"prod"})
+	a.Equal([]string{
+		`eq(fvTenant.dn,"uni/tn-prod")`,
+		`wcard(fvBD.dn,"^uni/tn-prod/")`,
+		"",
+	}, shardFilters(reqs))
+
+	reqs = ForTenants(WithDefaults([]*Request{{Class: "fvCtx"}}), []string{"prod", "dev"})
+	a.Equal([]string{`or(wcard(fvCtx.dn,"^uni/tn-prod/"),wcard(fvCtx.dn,"^uni/tn-dev/"))`}, shardFilters(reqs))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/mholt/archiver/v3"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// configObjects collects the objects of a configuration export by class,
+// e.g.
+//
+//	{"polUni": {"attributes": {"dn": "uni"}, "children": [{"fvTenant": ...}]}}
+//
+// Children are exported with their RN, so their DN is built from their
+// parent's.
+func configObjects(mo gjson.Result, parent string, objects map[string][]string) {
+	mo.ForEach(func(class, body gjson.Result) bool {
+		attrs := body.Get("attributes")
+		record := goaci.Body{Str: "{}"}
+		if attrs.IsObject() {
+			record = goaci.Body{Str: attrs.Raw}
+		}
+		dn := attrs.Get("dn").Str
+		if rn := attrs.Get("rn").Str; dn == "" && rn != "" {
+			dn = rn
+			if parent != "" {
+				dn = parent + "/" + rn
+			}
+			record = record.Set("dn", dn)
+		}
+		objects[class.Str] = append(objects[class.Str], record.Str)
+		for _, child := range body.Get("children").Array() {
+			configObjects(child, dn, objects)
+		}
+		return true
+	})
+}
+
+// readConfigExport converts an APIC configuration export or snapshot to a
+// standard archive, for sites that can't run the collector or scripts. Only
+// the configuration classes of the plain class queries can be read from an
+// export; the other requests are recorded as missing in the metadata.
+func readConfigExport(in, out string, log Logger) error {
+	objects := make(map[string][]string)
+	var files, xmlFiles int
+	err := archiver.Walk(in, func(f archiver.File) error {
+		switch {
+		case f.IsDir():
+		case strings.HasSuffix(f.Name(), ".json"):
+			b, err := ioutil.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			if !gjson.ValidBytes(b) {
+				return fmt.Errorf("invalid JSON in %s", f.Name())
+			}
+			res := gjson.ParseBytes(b)
+			if imdata := res.Get("imdata"); imdata.IsArray() {
+				for _, mo := range imdata.Array() {
+					configObjects(mo, "", objects)
+				}
+			} else {
+				configObjects(res, "", objects)
+			}
+			files++
+		case strings.HasSuffix(f.Name(), ".xml"):
+			xmlFiles++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading from config export: %v", err)
+	}
+	if files == 0 {
+		if xmlFiles > 0 {
+			return errors.New("XML config exports are not supported; export the configuration in JSON format")
+		}
+		return errors.New("no configuration found in config export")
+	}
+
+	results := make(map[string]goaci.Res)
+	missing := []string{}
+	for _, request := range collector.Requests() {
+		records, ok := objects[request.Class]
+		if !ok || request.Mods != nil || request.Filter != "#."+request.Class+".attributes" {
+			missing = append(missing, request.Prefix)
+			continue
+		}
+		results[request.Prefix] = gjson.Parse("[" + strings.Join(records, ",") + "]")
+		log.Info().Str("resource", request.Prefix).Int("count", len(records)).Msg("read resource")
+	}
+	sort.Strings(missing)
+	log.Warn().Int("classes", len(missing)).Strs("missing", missing).
+		Msg("classes not in the config export, e.g. operational data, are missing")
+
+	// Write to DB and create archive
+	missingJSON, _ := json.Marshal(missing)
+	meta := goaci.Body{}.
+		Set("source", "config-export").
+		Set("configExport", filepath.Base(in)).
+		SetRaw("missingClasses", string(missingJSON))
+	if err := writeArchive(out, results, meta, archiveOptions{files: []string{logPath}}, log); err != nil {
+		return err
+	}
+
+	separator()
+	if quiet() {
+		fmt.Println(out)
+	} else {
+		log.Info().Msgf("Please provide %s to Cisco Services for further analysis.", out)
+	}
+	return nil
+}
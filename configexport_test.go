@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/archiver/v3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+const testConfigExport = `{"totalCount":"1","imdata":[{"polUni":{"attributes":{"dn":"uni"},"children":[
+	{"fvTenant":{"attributes":{"rn":"tn-common","name":"common"},"children":[
+		{"fvBD":{"attributes":{"rn":"BD-default","name":"default","unicastRoute":"yes"},"children":[
+			{"fvSubnet":{"attributes":{"rn":"subnet-[10.0.0.1/24]","ip":"10.0.0.1/24"}}}
+		]}},
+		{"fvCtx":{"attributes":{"dn":"uni/tn-common/ctx-default","name":"default"}}}
+	]}}
+]}}]}`
+
+func TestReadConfigExport(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ce2_backup_1.json")
+	a.NoError(ioutil.WriteFile(file, []byte(testConfigExport), 0644))
+	in := filepath.Join(dir, "ce2_backup.tar.gz")
+	a.NoError(archiver.Archive([]string{file}, in))
+	out := filepath.Join(dir, "out.zip")
+
+	a.NoError(readConfigExport(in, out, log))
+	c, err := readCollection(out)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal("common", gjson.Get(c.records["fvTenant:uni/tn-common"], "name").Str)
+	a.Equal("yes", gjson.Get(c.records["fvBD:uni/tn-common/BD-default"], "unicastRoute").Str)
+	a.Contains(c.records, "fvSubnet:uni/tn-common/BD-default/subnet-[10.0.0.1/24]")
+	a.Contains(c.records, "fvCtx:uni/tn-common/ctx-default")
+	a.Equal("config-export", c.meta.Get("source").Str)
+	a.Equal("ce2_backup.tar.gz", c.meta.Get("configExport").Str)
+	missing := c.meta.Get("missingClasses").String()
+	a.Contains(missing, `"topSystem"`)
+	a.Contains(missing, `"faultInst"`)
+	a.NotContains(missing, `"fvBD"`)
+
+	// XML exports
+	xml := filepath.Join(dir, "ce2_backup_1.xml")
+	a.NoError(ioutil.WriteFile(xml, []byte("<polUni/>"), 0644))
+	in = filepath.Join(dir, "ce2_xml.tar.gz")
+	a.NoError(archiver.Archive([]string{xml}, in))
+	err = readConfigExport(in, out, log)
+	if a.Error(err) {
+		a.Contains(err.Error(), "JSON")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// runState tracks collection progress and allows the collection to be paused
+// between requests.
+type runState struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	paused  bool
+	started time.Time
+	total   int
+	done    int
+	output  string // Archive of the collection, once named
+}
+
+func newRunState() *runState {
+	s := &runState{started: time.Now()}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// start resets progress for a new collection. The total grows as requests
+// are planned, e.g. the shards of a class once the nodes are known.
+func (s *runState) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total = 0
+	s.done = 0
+	s.output = ""
+	s.started = time.Now()
+}
+
+// setOutput records the archive of the collection, e.g. with the output
+// template expanded.
+func (s *runState) setOutput(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.output = path
+}
+
+// archive returns the archive of the collection, if named.
+func (s *runState) archive() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.output
+}
+
+// plan adds requests to the total.
+func (s *runState) plan(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total += n
+}
+
+// progress returns the number of completed and total requests.
+func (s *runState) progress() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done, s.total
+}
+
+// wait blocks while the collection is paused.
+func (s *runState) wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.paused {
+		s.cond.Wait()
+	}
+}
+
+func (s *runState) pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+func (s *runState) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	s.cond.Broadcast()
+}
+
+func (s *runState) complete() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done++
+	// Requests outside a plan, e.g. by plugins, are counted as they complete
+	if s.done > s.total {
+		s.total = s.done
+	}
+}
+
+func (s *runState) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := "running"
+	if s.paused {
+		state = "paused"
+	}
+	return fmt.Sprintf("%s %d/%d requests complete, elapsed %s",
+		state, s.done, s.total, time.Since(s.started).Round(time.Second))
+}
+
+// pausable wraps a collector.Getter so that requests wait while the run is paused.
+// Requests already in flight are allowed to complete.
+type pausable struct {
+	collector.Getter
+	state *runState
+}
+
+func (p pausable) Plan(n int) {
+	p.state.plan(n)
+}
+
+func (p pausable) Get(path string, mods ...func(*goaci.Req)) (goaci.Res, error) {
+	p.state.wait()
+	defer p.state.complete()
+	return p.Getter.Get(path, mods...)
+}
+
+func (p pausable) StreamRecords(path, filter string, fn func(goaci.Res) error, mods ...func(*goaci.Req)) (int, error) {
+	p.state.wait()
+	defer p.state.complete()
+	return collector.StreamRecords(p.Getter, path, filter, fn, mods...)
+}
+
+// checkLoopback checks that the control address is on the loopback
+// interface, as the control socket has no authentication.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid control address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("control address %q must be a loopback address, e.g. 127.0.0.1:7777", addr)
+	}
+	return nil
+}
+
+// serveControl listens on a local address for control commands.
+// The protocol is one command per line: pause, resume or status.
+func serveControl(addr string, state *runState, log Logger) (net.Listener, error) {
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open control socket: %v", err)
+	}
+	log.Info().Str("addr", ln.Addr().String()).Msg("Control socket listening")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleControl(conn, state, log)
+		}
+	}()
+	return ln, nil
+}
+
+func handleControl(conn net.Conn, state *runState, log Logger) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		switch cmd {
+		case "":
+			continue
+		case "pause":
+			state.pause()
+			log.Warn().Msg("Collection paused by operator")
+		case "resume":
+			state.resume()
+			log.Info().Msg("Collection resumed by operator")
+		case "status":
+		default:
+			fmt.Fprintf(conn, "unknown command %q (pause, resume, status)\n", cmd)
+			continue
+		}
+		fmt.Fprintln(conn, state.status())
+	}
+}
+
+// sendControl sends a single command to a running collector and returns the
+// response.
+func sendControl(addr, cmd string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("cannot connect to control socket at %s: %v", addr, err)
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, cmd); err != nil {
+		return "", err
+	}
+	res, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("no response from control socket: %v", err)
+	}
+	return strings.TrimSpace(res), nil
+}
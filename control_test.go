@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControl(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	state := newRunState()
+	state.start()
+	state.plan(2)
+	ln, err := serveControl("127.0.0.1:0", state, log)
+	if !a.NoError(err) {
+		return
+	}
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	res, err := sendControl(addr, "pause")
+	a.NoError(err)
+	a.True(strings.HasPrefix(res, "paused 0/2"))
+
+	done := make(chan struct{})
+	go func() {
+		state.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	res, err = sendControl(addr, "resume")
+	a.NoError(err)
+	a.True(strings.HasPrefix(res, "running"))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after resume")
+	}
+
+	res, err = sendControl(addr, "bogus")
+	a.NoError(err)
+	a.Contains(res, "unknown command")
+}
+
+func TestCheckLoopback(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(checkLoopback("127.0.0.1:7777"))
+	a.NoError(checkLoopback("[::1]:7777"))
+	a.NoError(checkLoopback("localhost:7777"))
+	a.Error(checkLoopback("0.0.0.0:7777"))
+	a.Error(checkLoopback(":7777"))
+	a.Error(checkLoopback("10.0.0.1:7777"))
+	a.Error(checkLoopback("127.0.0.1"))
+}
+
+func TestRunStateProgress(t *testing.T) {
+	a := assert.New(t)
+	state := newRunState()
+	state.start()
+	client := pausable{state: state}
+	client.Plan(2)
+	state.complete()
+	done, total := state.progress()
+	a.Equal(1, done)
+	a.Equal(2, total)
+	// Unplanned requests, e.g. by plugins
+	state.complete()
+	state.complete()
+	done, total = state.progress()
+	a.Equal(3, done)
+	a.Equal(3, total)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/mholt/archiver/v3"
+	"github.com/tidwall/buntdb"
+
+	"aci-vetr-c/collector"
+)
+
+// openDB opens a collection db file, or the db file within a collection
+// archive or split archive. The returned func closes the db and removes any
+// temporary files.
+func openDB(path string) (*buntdb.DB, func(), error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, err
+	}
+	dbPath := path
+	cleanup := func() {}
+	if isArchive(path) || isParts(path) {
+		dir, err := ioutil.TempDir("", "aci-vetr")
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot create temp dir: %v", err)
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		archive := path
+		if isParts(path) {
+			joined := filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), partsSuffix))
+			if archive, err = joinArchive(path, joined); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+		}
+		dbPath = filepath.Join(dir, dbName)
+		if err := extractDB(archive, dbPath); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	db, err := buntdb.Open(dbPath)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("cannot open db: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		cleanup()
+	}, nil
+}
+
+// extractDB extracts the db file from a collection archive.
+func extractDB(archive, dest string) error {
+	found := false
+	err := archiver.Walk(archive, func(f archiver.File) error {
+		if f.IsDir() || f.Name() != dbName {
+			return nil
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		if _, err := io.Copy(out, f); err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading from archive: %v", err)
+	}
+	if !found {
+		return fmt.Errorf("%s not found in %s", dbName, archive)
+	}
+	return nil
+}
+
+// isRecord reports whether a db key is a collected record, i.e. prefix:dn,
+// rather than metadata.
+func isRecord(key string) bool {
+	return strings.Contains(key, ":")
+}
+
+// splitKey splits a record key into the prefix and DN.
+func splitKey(key string) (string, string) {
+	i := strings.Index(key, ":")
+	if i < 0 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
+
+// readRecords reads all collected records from the db.
+func readRecords(db *buntdb.DB) (map[string]string, error) {
+	records := make(map[string]string)
+	err := db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			if isRecord(key) {
+				records[key] = value
+			}
+			return true
+		})
+	})
+	return records, err
+}
+
+// Classes read back from the collection db once the records are fetched,
+// for the aggregates, the metadata and the summary.
+var postClasses = append([]string{"topSystem", "infraSnNode", "fabricNode", "fvRsProv", "fvRsCons"}, policyClasses...)
+
+// readBack reads the classes needed once the records are fetched from the
+// collection db, with those of the follow-up rules. The plugins, payloads,
+// upgrade readiness summary and --split-sensitive need every class.
+func readBack(db *buntdb.DB, args CollectCmd) (map[string]goaci.Res, error) {
+	if len(collector.Plugins()) > 0 || len(payloads(args)) > 0 || args.SplitSensitive || args.Preset == upgradeReadiness {
+		return collector.ReadRecords(db)
+	}
+	classes := append([]string{}, postClasses...)
+	for _, rule := range args.FollowUp {
+		classes = append(classes, rule.Class)
+	}
+	return collector.ReadRecords(db, classes...)
+}
+
+// storeChanged writes the classes the follow-up queries, aggregates and
+// plugins added to the responses read back, or replaced or removed, to the
+// collection db. The records of a class that wasn't read back are added to
+// those already in the db.
+func storeChanged(sink collector.Sink, fetched, responses map[string]goaci.Res) error {
+	for prefix, res := range responses {
+		before, ok := fetched[prefix]
+		if ok && before.Raw == res.Raw {
+			continue
+		}
+		if ok {
+			if err := sink.Drop(prefix); err != nil {
+				return err
+			}
+		}
+		if err := sink.Write(prefix, res.Array()); err != nil {
+			return err
+		}
+	}
+	for prefix := range fetched {
+		if _, ok := responses[prefix]; !ok {
+			if err := sink.Drop(prefix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestOpenDB(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, out, log)) {
+		return
+	}
+
+	db, closeDB, err := openDB(out)
+	if !a.NoError(err) {
+		return
+	}
+	defer closeDB()
+	records, err := readRecords(db)
+	a.NoError(err)
+	a.Contains(records, "fvTenant:uni/tn-common")
+	a.NotContains(records, "meta")
+
+	_, _, err = openDB(filepath.Join(dir, "missing.zip"))
+	a.Error(err)
+}
+
+func TestWriteToDBWithoutDN(t *testing.T) {
+	a := assert.New(t)
+	var buf bytes.Buffer
+	log := zerolog.New(&buf)
+	defer os.Remove(dbName)
+
+	responses := map[string]goaci.Res{
+		"fvTenant":         gjson.Parse(`[{"dn": "uni/tn-a"}]`),
+		"eqptEgrTotal5min": gjson.Parse(`[{"bytesRate": "1"}, {"bytesRate": "2"}]`),
+	}
+	if !a.NoError(writeToDB(responses, goaci.Body{}, log)) {
+		return
+	}
+	a.Contains(buf.String(), `"resource":"eqptEgrTotal5min","records":2`)
+
+	db, closeDB, err := openDB(dbName)
+	if !a.NoError(err) {
+		return
+	}
+	defer closeDB()
+	records, err := readRecords(db)
+	a.NoError(err)
+	a.Contains(records, "fvTenant:uni/tn-a")
+	a.Equal(`{"bytesRate": "1"}`, records["eqptEgrTotal5min:#0"])
+	a.Equal(`{"bytesRate": "2"}`, records["eqptEgrTotal5min:#1"])
+}
+
+func TestStoreChanged(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	defer db.Close()
+	w := collector.NewWriter(db, collector.Limits{}, log)
+	a.NoError(w.Write("fvTenant", gjson.Parse(`[{"dn": "uni/tn-a"}]`).Array()))
+	a.NoError(w.Write("fvBD", gjson.Parse(`[{"dn": "uni/tn-a/BD-b"}]`).Array()))
+	a.NoError(w.Write("fvCEpFollowUp", gjson.Parse(`[{"dn": "uni/tn-a/ap-c/epg-d/cep-1"}]`).Array()))
+	a.NoError(w.Flush())
+
+	fetched, err := collector.ReadRecords(db, "fvTenant", "fvBD")
+	if !a.NoError(err) {
+		return
+	}
+	responses := map[string]goaci.Res{
+		// Replaced, e.g. by a plugin
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}, {"dn": "uni/tn-b"}]`),
+		// Added to the records in the db, e.g. by a follow-up query
+		"fvCEpFollowUp": gjson.Parse(`[{"dn": "uni/tn-a/ap-c/epg-d/cep-2"}]`),
+		// Added, e.g. an aggregate
+		contractsPerLeaf: gjson.Parse(`[{"dn": "topology/pod-1/node-101"}]`),
+	}
+	a.NoError(storeChanged(w, fetched, responses))
+	a.NoError(w.Close())
+	a.Equal(map[string]int{"fvTenant": 2, "fvCEpFollowUp": 2, contractsPerLeaf: 1}, w.Counts())
+	records, err := readRecords(db)
+	a.NoError(err)
+	a.Contains(records, "fvTenant:uni/tn-b")
+	a.NotContains(records, "fvBD:uni/tn-a/BD-b")
+}
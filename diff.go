@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// diffStats counts the records that differ between two collections.
+type diffStats struct {
+	added   []string
+	removed []string
+	changed []string
+}
+
+// diffRecords compares two sets of records by prefix.
+func diffRecords(old, new map[string]string) map[string]*diffStats {
+	stats := make(map[string]*diffStats)
+	get := func(key string) *diffStats {
+		prefix, _ := splitKey(key)
+		s, ok := stats[prefix]
+		if !ok {
+			s = &diffStats{}
+			stats[prefix] = s
+		}
+		return s
+	}
+	for key, value := range new {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			s := get(key)
+			s.added = append(s.added, key)
+		case prev != value:
+			s := get(key)
+			s.changed = append(s.changed, key)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			s := get(key)
+			s.removed = append(s.removed, key)
+		}
+	}
+	return stats
+}
+
+func loadRecords(path string) (map[string]string, error) {
+	db, closeDB, err := openDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %v", path, err)
+	}
+	defer closeDB()
+	return readRecords(db)
+}
+
+// diff prints the differences between two collections.
+func diff(oldPath, newPath string, keys bool) error {
+	old, err := loadRecords(oldPath)
+	if err != nil {
+		return err
+	}
+	new, err := loadRecords(newPath)
+	if err != nil {
+		return err
+	}
+	stats := diffRecords(old, new)
+	var prefixes []string
+	for prefix := range stats {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tADDED\tREMOVED\tCHANGED")
+	for _, prefix := range prefixes {
+		s := stats[prefix]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", prefix, len(s.added), len(s.removed), len(s.changed))
+	}
+	w.Flush()
+	if !keys {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		s := stats[prefix]
+		for _, group := range []struct {
+			symbol string
+			keys   []string
+		}{{"+", s.added}, {"-", s.removed}, {"~", s.changed}} {
+			sort.Strings(group.keys)
+			for _, key := range group.keys {
+				fmt.Println(group.symbol, key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRecords(t *testing.T) {
+	a := assert.New(t)
+	old := map[string]string{
+		"fvTenant:uni/tn-a":  `{"name":"a"}`,
+		"fvTenant:uni/tn-b":  `{"name":"b"}`,
+		"fvBD:uni/tn-a/BD-x": `{"name":"x"}`,
+	}
+	new := map[string]string{
+		"fvTenant:uni/tn-a":  `{"name":"a"}`,
+		"fvTenant:uni/tn-c":  `{"name":"c"}`,
+		"fvBD:uni/tn-a/BD-x": `{"name":"x","descr":"changed"}`,
+	}
+	stats := diffRecords(old, new)
+	a.Equal([]string{"fvTenant:uni/tn-c"}, stats["fvTenant"].added)
+	a.Equal([]string{"fvTenant:uni/tn-b"}, stats["fvTenant"].removed)
+	a.Empty(stats["fvTenant"].changed)
+	a.Equal([]string{"fvBD:uni/tn-a/BD-x"}, stats["fvBD"].changed)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig is the SMTP configuration for email notifications.
+type EmailConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"` // Default 587; 465 uses implicit TLS
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Attach the archives when their total size is below this, e.g. 10MB
+	AttachMaxSize string `json:"attachMaxSize"`
+}
+
+func (c *EmailConfig) validate() error {
+	if c.Host == "" || c.From == "" || len(c.To) == 0 {
+		return errors.New("email notification requires host, from and to")
+	}
+	if c.Port == 0 {
+		c.Port = 587
+	}
+	if c.AttachMaxSize != "" {
+		if _, err := parseSize(c.AttachMaxSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachments returns the outputs to attach, if their total size is within
+// the configured limit.
+func (c *EmailConfig) attachments(outputs []string) []string {
+	if c.AttachMaxSize == "" || len(outputs) == 0 {
+		return nil
+	}
+	max, _ := parseSize(c.AttachMaxSize)
+	var total int64
+	for _, out := range outputs {
+		info, err := os.Stat(out)
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+	}
+	if total > max {
+		return nil
+	}
+	return outputs
+}
+
+// emailMessage builds the notification email, with any attachments.
+func emailMessage(c *EmailConfig, r runReport, now time.Time) ([]byte, error) {
+	subject := "ACI vetR collection completed"
+	if r.err != nil {
+		subject = "ACI vetR collection failed"
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", c.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	text, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(text, r.message(now))
+
+	for _, file := range c.attachments(r.outputs) {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/octet-stream"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", filepath.Base(file))},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Wrap base64 at 76 characters per RFC 2045
+		encoded := base64.StdEncoding.EncodeToString(b)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendEmail sends the notification email. Port 465 uses implicit TLS, other
+// ports use STARTTLS when the server supports it.
+func sendEmail(c *EmailConfig, r runReport) error {
+	msg, err := emailMessage(c, r, time.Now())
+	if err != nil {
+		return fmt.Errorf("cannot build email: %v", err)
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	if c.Port != 465 {
+		return smtp.SendMail(addr, auth, c.From, c.To, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: c.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, to := range c.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailMessage(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data.zip")
+	a.NoError(ioutil.WriteFile(file, []byte("archive"), 0644))
+
+	c := &EmailConfig{Host: "smtp", From: "collector@example.com", To: []string{"noc@example.com"}, AttachMaxSize: "1KB"}
+	a.NoError(c.validate())
+	a.Equal(587, c.Port)
+	r := runReport{apic: "10.0.0.1", start: time.Now(), outputs: []string{file}}
+	b, err := emailMessage(c, r, time.Now())
+	if !a.NoError(err) {
+		return
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal("ACI vetR collection completed", msg.Header.Get("Subject"))
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	a.NoError(err)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := mr.NextPart()
+	if a.NoError(err) {
+		body, _ := ioutil.ReadAll(text)
+		a.Contains(string(body), "completed")
+	}
+	attachment, err := mr.NextPart()
+	if a.NoError(err) {
+		a.Equal("data.zip", attachment.FileName())
+		body, _ := ioutil.ReadAll(attachment)
+		decoded, err := base64.StdEncoding.DecodeString(strings.Replace(string(body), "\r\n", "", -1))
+		a.NoError(err)
+		a.Equal("archive", string(decoded))
+	}
+
+	// Too large to attach
+	c.AttachMaxSize = "4"
+	a.Nil(c.attachments(r.outputs))
+
+	a.Error((&EmailConfig{Host: "smtp"}).validate())
+}
+
+// serveSMTP accepts a single message and returns it on the channel.
+func serveSMTP(t *testing.T) (net.Listener, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					messages <- data.String()
+					conn.Write([]byte("250 OK\r\n"))
+				} else {
+					data.WriteString(line)
+				}
+				continue
+			}
+			switch strings.ToUpper(strings.Fields(line)[0]) {
+			case "EHLO", "HELO":
+				conn.Write([]byte("250 localhost\r\n"))
+			case "DATA":
+				inData = true
+				conn.Write([]byte("354 Go ahead\r\n"))
+			case "QUIT":
+				conn.Write([]byte("221 Bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 OK\r\n"))
+			}
+		}
+	}()
+	return ln, messages
+}
+
+func TestSendEmail(t *testing.T) {
+	a := assert.New(t)
+	ln, messages := serveSMTP(t)
+	defer ln.Close()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	c := &EmailConfig{Host: host, Port: p, From: "collector@example.com", To: []string{"noc@example.com"}}
+	a.NoError(sendEmail(c, runReport{apic: "10.0.0.1", start: time.Now()}))
+	select {
+	case msg := <-messages:
+		a.Contains(msg, "Subject: ACI vetR collection completed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// Process exit codes, so wrappers can react to the outcome of a collection.
+const (
+	exitSuccess = 0
+	exitFailure = 1 // Any other error
+	exitAuth    = 2 // Cannot authenticate to the APIC
+	exitPartial = 3 // Collected, but with warnings
+	exitArchive = 4 // Cannot write, split or upload the archive
+)
+
+// exitError is an error with the exit code it maps to.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+// exitCode returns the exit code for an error.
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	if e, ok := err.(exitError); ok {
+		return e.code
+	}
+	return exitFailure
+}
+
+// isPartial checks whether an error only reports warnings, i.e. the
+// collection completed and the archive is usable.
+func isPartial(err error) bool {
+	return exitCode(err) == exitPartial
+}
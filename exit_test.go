@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(exitSuccess, exitCode(nil))
+	a.Equal(exitFailure, exitCode(errors.New("unexpected")))
+	a.Equal(exitAuth, exitCode(exitError{exitAuth, errors.New("cannot authenticate")}))
+	a.Equal("cannot authenticate", exitError{exitAuth, errors.New("cannot authenticate")}.Error())
+	a.True(isPartial(exitError{exitPartial, errors.New("collection completed with warnings")}))
+	a.False(isPartial(exitError{exitArchive, errors.New("cannot create archive")}))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// groupRecords groups records by prefix, sorted by DN.
+func groupRecords(records map[string]string) map[string][]json.RawMessage {
+	var keys []string
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	classes := make(map[string][]json.RawMessage)
+	for _, key := range keys {
+		prefix, _ := splitKey(key)
+		classes[prefix] = append(classes[prefix], json.RawMessage(records[key]))
+	}
+	return classes
+}
+
+// export writes one JSON file per class from a collection, e.g. fvBD.json.
+func export(path, dir string, log Logger) error {
+	db, closeDB, err := openDB(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", path, err)
+	}
+	defer closeDB()
+	records, err := readRecords(db)
+	if err != nil {
+		return fmt.Errorf("cannot read records: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create output directory: %v", err)
+	}
+	classes := groupRecords(records)
+	for prefix, class := range classes {
+		b, err := json.MarshalIndent(class, "", "  ")
+		if err != nil {
+			return fmt.Errorf("cannot encode %s: %v", prefix, err)
+		}
+		file := filepath.Join(dir, prefix+".json")
+		if err := ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+			return fmt.Errorf("cannot write %s: %v", file, err)
+		}
+	}
+	log.Info().Int("classes", len(classes)).Msgf("Exported to %s", dir)
+	return nil
+}
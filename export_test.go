@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestExport(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, in, log)) {
+		return
+	}
+
+	out := filepath.Join(dir, "export")
+	a.NoError(export(in, out, log))
+	files, err := ioutil.ReadDir(out)
+	a.NoError(err)
+	a.Len(files, 3)
+
+	b, err := ioutil.ReadFile(filepath.Join(out, "fvTenant.json"))
+	a.NoError(err)
+	tenants := gjson.ParseBytes(b)
+	a.Len(tenants.Array(), 2)
+	a.Equal("uni/tn-common", tenants.Get("0.dn").Str)
+}
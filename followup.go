@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// FollowUp is a declarative second-phase query, run against each record of a
+// class found in the initial collection. Follow-up rules are set in the
+// config file, e.g.
+//
+//	"followUp": [{
+//	  "class": "l3extOut",
+//	  "target": "children",
+//	  "targetClass": "l3extRsEctx,l3extRsL3DomAtt",
+//	  "prefix": "l3extOutChildren"
+//	}]
+type FollowUp struct {
+	Class       string `json:"class"`       // Class of the collected records to query
+	Target      string `json:"target"`      // query-target, i.e. self, children or subtree [default: children]
+	TargetClass string `json:"targetClass"` // Optional target-subtree-class, comma-separated
+	Filter      string `json:"filter"`      // Optional query-target-filter
+	Prefix      string `json:"prefix"`      // Prefix for the DB [default: {class}FollowUp]
+	Sensitive   bool   `json:"sensitive"`   // Records may identify users or hosts, for --split-sensitive
+}
+
+// validate checks the rule and sets defaults.
+func (f *FollowUp) validate() error {
+	if f.Class == "" {
+		return errors.New("follow-up rule requires a class")
+	}
+	switch f.Target {
+	case "":
+		f.Target = "children"
+	case "self", "children", "subtree":
+	default:
+		return fmt.Errorf("follow-up rule for %s: invalid target %q", f.Class, f.Target)
+	}
+	if f.Prefix == "" {
+		f.Prefix = f.Class + "FollowUp"
+	}
+	return nil
+}
+
+// requests creates a request for each collected record of the rule's class.
+func (f FollowUp) requests(responses map[string]goaci.Res) []*collector.Request {
+	mods := []collector.Mod{goaci.Query("query-target", f.Target)}
+	if f.TargetClass != "" {
+		mods = append(mods, goaci.Query("target-subtree-class", f.TargetClass))
+	}
+	if f.Filter != "" {
+		mods = append(mods, goaci.Query("query-target-filter", f.Filter))
+	}
+	var reqs []*collector.Request
+	for _, record := range responses[f.Class].Array() {
+		dn := record.Get("dn").Str
+		if dn == "" {
+			continue
+		}
+		reqs = append(reqs, &collector.Request{
+			Class:     f.Class,
+			Path:      "/api/mo/" + dn,
+			Prefix:    f.Prefix,
+			Mods:      mods,
+			Filter:    "#.*.attributes",
+			Sensitive: f.Sensitive,
+		})
+	}
+	return reqs
+}
+
+// followUpRequests builds the second-phase requests for all rules.
+func followUpRequests(rules []FollowUp, responses map[string]goaci.Res) ([]*collector.Request, error) {
+	var reqs []*collector.Request
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, rule.requests(responses)...)
+	}
+	return reqs, nil
+}
+
+// fetchFollowUps runs the follow-up rules and adds the results to responses,
+// returning the follow-up requests.
+func fetchFollowUps(client collector.Getter, rules []FollowUp, responses map[string]goaci.Res, limits collector.Limits, log Logger) ([]*collector.Request, error) {
+	reqs, err := followUpRequests(rules, responses)
+	if err != nil {
+		return nil, err
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	log.Info().Int("requests", len(reqs)).Msg("Fetching follow-up queries...")
+	results, err := collector.Fetch(client, reqs, limits, log)
+	if err != nil {
+		return reqs, err
+	}
+	for prefix, res := range results {
+		responses[prefix] = collector.AppendResults(responses[prefix], res)
+	}
+	return reqs, nil
+}
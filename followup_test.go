@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gopkg.in/h2non/gock.v1"
+
+	"aci-vetr-c/collector"
+)
+
+func TestFollowUpValidate(t *testing.T) {
+	a := assert.New(t)
+	rule := FollowUp{Class: "l3extOut"}
+	a.NoError(rule.validate())
+	a.Equal("children", rule.Target)
+	a.Equal("l3extOutFollowUp", rule.Prefix)
+
+	a.Error((&FollowUp{}).validate())
+	a.Error((&FollowUp{Class: "l3extOut", Target: "parents"}).validate())
+}
+
+func TestFetchFollowUps(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	for _, out := range []string{"one", "two"} {
+		gock.New("https://apic").
+			Get("/api/mo/uni/tn-a/out-"+out+".json").
+			MatchParam("query-target", "children").
+			MatchParam("target-subtree-class", "l3extRsEctx").
+			Reply(200).
+			BodyString(goaci.Body{}.
+				Set("imdata.0.l3extRsEctx.attributes.dn", "uni/tn-a/out-"+out+"/rsectx").
+				Str)
+	}
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	log := zerolog.New(&bytes.Buffer{})
+	responses := map[string]goaci.Res{
+		"l3extOut": gjson.Parse(`[{"dn": "uni/tn-a/out-one"}, {"dn": "uni/tn-a/out-two"}]`),
+	}
+	rules := []FollowUp{{Class: "l3extOut", TargetClass: "l3extRsEctx", Prefix: "l3extRsEctx"}}
+	_, err := fetchFollowUps(&client, rules, responses, collector.Limits{}, log)
+	a.NoError(err)
+	var dns []string
+	for _, record := range responses["l3extRsEctx"].Array() {
+		dns = append(dns, record.Get("dn").Str)
+	}
+	a.ElementsMatch([]string{"uni/tn-a/out-one/rsectx", "uni/tn-a/out-two/rsectx"}, dns)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+)
+
+// Default output of generate.
+const syntheticZip = "aci-vetr-synthetic.zip"
+
+// Firmware of generated fabrics.
+const (
+	syntheticAPICVersion   = "5.2(7f)"
+	syntheticSwitchVersion = "n9000-15.2(7f)"
+)
+
+// Number of controllers in generated fabrics.
+const syntheticControllers = 3
+
+// fabricSize is the size of a generated fabric.
+type fabricSize struct {
+	leaves, spines, tenants, epgs int
+}
+
+// fabricGenerator builds the records of a synthetic fabric.
+type fabricGenerator struct {
+	size      fabricSize
+	rnd       *rand.Rand
+	responses map[string][]map[string]string
+}
+
+// add adds a record of a class.
+func (g *fabricGenerator) add(class string, attrs map[string]string) {
+	g.responses[class] = append(g.responses[class], attrs)
+}
+
+// serial returns a random switch serial number, e.g. FDO21120U8N.
+func (g *fabricGenerator) serial() string {
+	const chars = "ABCDEFGHJKLMNPQRSTUVWXYZ0123456789"
+	b := []byte("FDO")
+	for i := 0; i < 8; i++ {
+		b = append(b, chars[g.rnd.Intn(len(chars))])
+	}
+	return string(b)
+}
+
+// node adds a controller or switch.
+func (g *fabricGenerator) node(id int, role, model, version string) {
+	name := fmt.Sprintf("%s-%d", role, id)
+	dn := fmt.Sprintf("topology/pod-1/node-%d", id)
+	serial := g.serial()
+	g.add("topSystem", map[string]string{
+		"dn":           dn + "/sys",
+		"id":           fmt.Sprint(id),
+		"name":         name,
+		"role":         role,
+		"podId":        "1",
+		"address":      fmt.Sprintf("10.0.%d.%d", id/256, id%256),
+		"serial":       serial,
+		"version":      version,
+		"fabricDomain": "synthetic",
+		"state":        "in-service",
+		"fabricMAC":    "00:22:BD:F8:19:FF",
+	})
+	g.add("fabricNode", map[string]string{
+		"dn":       dn,
+		"id":       fmt.Sprint(id),
+		"name":     name,
+		"role":     role,
+		"model":    model,
+		"serial":   serial,
+		"version":  version,
+		"fabricSt": "active",
+		"adSt":     "on",
+	})
+}
+
+// fabric adds the controllers and switches.
+func (g *fabricGenerator) fabric() {
+	for id := 1; id <= syntheticControllers; id++ {
+		g.node(id, "controller", "APIC-SERVER-M3", syntheticAPICVersion)
+		g.add("firmwareCtrlrRunning", map[string]string{
+			"dn":      fmt.Sprintf("topology/pod-1/node-%d/sys/ctrlrfwstatuscont/ctrlrrunning", id),
+			"version": syntheticAPICVersion,
+		})
+		g.add("infraWiNode", map[string]string{
+			"dn":     fmt.Sprintf("topology/pod-1/node-1/av/node-%d", id),
+			"id":     fmt.Sprint(id),
+			"health": "fully-fit",
+			"operSt": "available",
+		})
+	}
+	for i := 0; i < g.size.spines; i++ {
+		g.node(201+i, "spine", "N9K-C9364C", syntheticSwitchVersion)
+	}
+	for i := 0; i < g.size.leaves; i++ {
+		id := 101 + i
+		g.node(id, "leaf", "N9K-C93180YC-FX", syntheticSwitchVersion)
+		g.add("eqptcapacityPolUsage5min", map[string]string{
+			"dn":             fmt.Sprintf("topology/pod-1/node-%d/sys/eqptcapacity/CDeqptcapacityPolUsage5min", id),
+			"polUsageCum":    fmt.Sprint(g.rnd.Intn(20000)),
+			"polUsageCapCum": "61000",
+		})
+		if g.rnd.Intn(4) == 0 {
+			g.add("faultInst", map[string]string{
+				"dn":       fmt.Sprintf("topology/pod-1/node-%d/sys/phys-[eth1/%d]/fault-F0532", id, 1+g.rnd.Intn(48)),
+				"code":     "F0532",
+				"severity": "warning",
+				"descr":    "Port is down, reason:sfpAbsent(connected), used by:EPG",
+				"lc":       "raised",
+			})
+		}
+	}
+	g.add("fabricHealthTotal", map[string]string{
+		"dn":  "topology/health",
+		"cur": fmt.Sprint(80 + g.rnd.Intn(21)),
+	})
+}
+
+// tenants adds the tenants, with a VRF each, and the EPGs, each with its own
+// BD and subnet, spread across the tenants.
+func (g *fabricGenerator) tenants() {
+	names := []string{"common", "infra", "mgmt"}
+	for i := 1; i <= g.size.tenants; i++ {
+		names = append(names, fmt.Sprintf("tenant-%d", i))
+	}
+	for _, name := range names {
+		g.add("fvTenant", map[string]string{"dn": "uni/tn-" + name, "name": name})
+		g.add("fvCtx", map[string]string{
+			"dn":                  fmt.Sprintf("uni/tn-%s/ctx-default", name),
+			"name":                "default",
+			"pcEnfPref":           "enforced",
+			"ipDataPlaneLearning": "enabled",
+		})
+	}
+	if g.size.tenants == 0 {
+		return
+	}
+	for i := 0; i < g.size.epgs; i++ {
+		tn := fmt.Sprintf("uni/tn-tenant-%d", 1+i%g.size.tenants)
+		bd := fmt.Sprintf("bd-%d", i+1)
+		epg := fmt.Sprintf("%s/ap-app/epg-epg-%d", tn, i+1)
+		g.add("fvBD", map[string]string{
+			"dn":             fmt.Sprintf("%s/BD-%s", tn, bd),
+			"name":           bd,
+			"unicastRoute":   "yes",
+			"arpFlood":       "no",
+			"unkMacUcastAct": "proxy",
+		})
+		g.add("fvSubnet", map[string]string{
+			"dn":    fmt.Sprintf("%s/BD-%s/subnet-[10.%d.%d.1/24]", tn, bd, 1+i/256, i%256),
+			"ip":    fmt.Sprintf("10.%d.%d.1/24", 1+i/256, i%256),
+			"scope": "private",
+		})
+		g.add("fvAEPg", map[string]string{
+			"dn":           epg,
+			"name":         fmt.Sprintf("epg-%d", i+1),
+			"pcEnfPref":    "unenforced",
+			"floodOnEncap": "disabled",
+		})
+		g.add("fvRsBd", map[string]string{
+			"dn":         epg + "/rsbd",
+			"tnFvBDName": bd,
+			"tDn":        fmt.Sprintf("%s/BD-%s", tn, bd),
+		})
+	}
+}
+
+// generateResponses builds the records of a synthetic fabric. The same seed
+// always generates the same fabric.
+func generateResponses(size fabricSize, seed int64) (map[string]goaci.Res, error) {
+	g := &fabricGenerator{
+		size:      size,
+		rnd:       rand.New(rand.NewSource(seed)),
+		responses: make(map[string][]map[string]string),
+	}
+	g.fabric()
+	g.tenants()
+	responses := make(map[string]goaci.Res)
+	for class, records := range g.responses {
+		b, err := json.Marshal(records)
+		if err != nil {
+			return nil, err
+		}
+		responses[class] = gjson.ParseBytes(b)
+	}
+	return responses, nil
+}
+
+// generate writes a synthetic fabric to an archive.
+func generate(cmd GenerateCmd, log Logger) error {
+	for _, n := range []int{cmd.Leaves, cmd.Spines, cmd.Tenants, cmd.EPGs} {
+		if n < 0 {
+			return errors.New("fabric size cannot be negative")
+		}
+	}
+	size := fabricSize{leaves: cmd.Leaves, spines: cmd.Spines, tenants: cmd.Tenants, epgs: cmd.EPGs}
+	responses, err := generateResponses(size, cmd.Seed)
+	if err != nil {
+		return err
+	}
+	meta := goaci.Body{}.
+		Set("source", "generate").
+		Set("apicVersion", syntheticAPICVersion).
+		Set("generated.leaves", fmt.Sprint(cmd.Leaves)).
+		Set("generated.spines", fmt.Sprint(cmd.Spines)).
+		Set("generated.tenants", fmt.Sprint(cmd.Tenants)).
+		Set("generated.epgs", fmt.Sprint(cmd.EPGs)).
+		Set("generated.seed", fmt.Sprint(cmd.Seed))
+	if err := writeArchive(cmd.Output, responses, meta, archiveOptions{keepDB: cmd.KeepDB}, log); err != nil {
+		return err
+	}
+	log.Info().Int("leaves", cmd.Leaves).Int("tenants", cmd.Tenants).Int("epgs", cmd.EPGs).
+		Msgf("Generated synthetic fabric %s", cmd.Output)
+	return nil
+}
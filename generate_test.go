@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateResponses(t *testing.T) {
+	a := assert.New(t)
+	size := fabricSize{leaves: 4, spines: 2, tenants: 3, epgs: 10}
+	responses, err := generateResponses(size, 1)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(responses["topSystem"].Array(), syntheticControllers+4+2)
+	a.Len(responses["fvTenant"].Array(), 3+3)
+	a.Len(responses["fvAEPg"].Array(), 10)
+	a.Len(responses["fvBD"].Array(), 10)
+	a.Equal("uni/tn-tenant-1/ap-app/epg-epg-1", responses["fvAEPg"].Get("0.dn").Str)
+	a.Equal("uni/tn-tenant-2/ap-app/epg-epg-2", responses["fvAEPg"].Get("1.dn").Str)
+
+	// The same seed generates the same fabric
+	again, err := generateResponses(size, 1)
+	a.NoError(err)
+	a.Equal(responses["topSystem"].Raw, again["topSystem"].Raw)
+	other, err := generateResponses(size, 2)
+	a.NoError(err)
+	a.NotEqual(responses["topSystem"].Raw, other["topSystem"].Raw)
+
+	// No tenants, no EPGs
+	responses, err = generateResponses(fabricSize{epgs: 10}, 1)
+	a.NoError(err)
+	a.Empty(responses["fvAEPg"].Array())
+}
+
+func TestGenerate(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, syntheticZip)
+
+	a.Error(generate(GenerateCmd{Leaves: -1, Output: out}, log))
+	if !a.NoError(generate(GenerateCmd{Leaves: 2, Spines: 1, Tenants: 1, EPGs: 2, Seed: 1, Output: out}, log)) {
+		return
+	}
+	c, err := readCollection(out)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal("generate", c.meta.Get("source").Str)
+	a.Equal("2", c.meta.Get("generated.leaves").Str)
+	responses, err := responsesFrom(c.records)
+	a.NoError(err)
+	a.Len(responses["fabricNode"].Array(), syntheticControllers+2+1)
+	a.Len(responses["fvAEPg"].Array(), 2)
+}
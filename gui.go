@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog"
+)
+
+// Number of log messages kept for the progress view.
+const guiLogLines = 200
+
+// guiServer is a minimal local web UI for running a collection.
+type guiServer struct {
+	mu     sync.Mutex
+	token  string // Required on all requests
+	output string
+	state  *runState
+	status string // idle, running, done or failed
+	err    string
+	lines  []string
+	log    Logger
+}
+
+// guiStatus is the progress of the current collection.
+type guiStatus struct {
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Done     int      `json:"done"`
+	Total    int      `json:"total"`
+	Messages []string `json:"messages"`
+}
+
+func newGUIServer(output string, log Logger) (*guiServer, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("cannot generate token: %v", err)
+	}
+	return &guiServer{
+		token:  hex.EncodeToString(b),
+		output: output,
+		state:  newRunState(),
+		status: "idle",
+		log:    log,
+	}, nil
+}
+
+// Run captures log messages for the progress view.
+func (s *guiServer) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.InfoLevel || msg == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, fmt.Sprintf("%s %s", level, msg))
+	if len(s.lines) > guiLogLines {
+		s.lines = s.lines[len(s.lines)-guiLogLines:]
+	}
+}
+
+func (s *guiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(guiPage))
+	case "/collect":
+		s.handleCollect(w, r)
+	case "/status":
+		s.handleStatus(w, r)
+	case "/download":
+		s.handleDownload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *guiServer) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var conn Connection
+	if err := json.NewDecoder(r.Body).Decode(&conn); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if conn.APIC == "" || conn.Username == "" || conn.Password == "" {
+		http.Error(w, "APIC, username and password are required", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	if s.status == "running" {
+		s.mu.Unlock()
+		http.Error(w, "a collection is already running", http.StatusConflict)
+		return
+	}
+	s.status = "running"
+	s.err = ""
+	s.lines = nil
+	s.mu.Unlock()
+
+	go func() {
+		args := CollectCmd{Connection: conn, Output: s.output}
+		err := fetchHttp(args, s.state, s.log.Hook(s))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil && !isPartial(err) {
+			s.log.Error().Err(err).Msg("cannot fetch data from the API")
+			s.status = "failed"
+			s.err = err.Error()
+			return
+		}
+		s.status = "done"
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *guiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	done, total := s.state.progress()
+	s.mu.Lock()
+	status := guiStatus{
+		Status:   s.status,
+		Error:    s.err,
+		Done:     done,
+		Total:    total,
+		Messages: append([]string{}, s.lines...),
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *guiServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+	// The output name may be a template, expanded by the collection
+	out := s.state.archive()
+	if status != "done" || out == "" {
+		http.Error(w, "no archive available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", filepath.Base(out)))
+	http.ServeFile(w, r, out)
+}
+
+// openBrowser opens a URL in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// serveGUI runs the web UI on the loopback interface until interrupted.
+func serveGUI(port int, output string, log Logger) error {
+	if port < 0 || port > 65535 {
+		return errors.New("invalid port")
+	}
+	s, err := newGUIServer(output, log)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return fmt.Errorf("cannot start web UI: %v", err)
+	}
+	url := fmt.Sprintf("http://%s/?token=%s", ln.Addr(), s.token)
+	// Not logged, as the log is included in the archive
+	fmt.Fprintf(os.Stderr, "Web UI running at %s\n", url)
+	if err := openBrowser(url); err != nil {
+		log.Warn().Err(err).Msg("cannot open browser; open the URL manually")
+	}
+	go http.Serve(ln, s)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	ln.Close()
+	log.Info().Msg("Web UI stopped.")
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+// guiPage is the web UI, embedded so the collector remains a single binary.
+const guiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ACI vetR collector</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 2em auto; color: #333; }
+label { display: block; margin-top: 1em; }
+input { width: 100%; padding: 0.4em; box-sizing: border-box; }
+button { margin-top: 1.5em; padding: 0.5em 2em; }
+progress { width: 100%; margin-top: 1.5em; }
+pre { background: #f4f4f4; padding: 1em; height: 20em; overflow-y: scroll; }
+.error { color: #b00; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>ACI vetR collector</h1>
+<p>Collects data from the APIC to be used by Cisco Services in the ACI Health Check.</p>
+<form id="form">
+  <label>APIC hostname or IP address <input id="apic" required></label>
+  <label>Username <input id="username" required></label>
+  <label>Password <input id="password" type="password" required></label>
+  <button id="start" type="submit">Start collection</button>
+</form>
+<progress id="progress" value="0" max="1"></progress>
+<p id="status">Idle</p>
+<p id="download" class="hidden"><a id="link">Download the collection archive</a>
+and provide it to Cisco Services for further analysis.</p>
+<pre id="log"></pre>
+<script>
+var token = new URLSearchParams(location.search).get("token");
+var q = "?token=" + encodeURIComponent(token);
+document.getElementById("link").href = "/download" + q;
+
+document.getElementById("form").onsubmit = function(e) {
+  e.preventDefault();
+  fetch("/collect" + q, {
+    method: "POST",
+    body: JSON.stringify({
+      apic: document.getElementById("apic").value,
+      username: document.getElementById("username").value,
+      password: document.getElementById("password").value
+    })
+  }).then(function(res) {
+    if (!res.ok) {
+      res.text().then(function(t) { setStatus(t, true); });
+    }
+    poll();
+  });
+};
+
+function setStatus(text, error) {
+  var el = document.getElementById("status");
+  el.textContent = text;
+  el.className = error ? "error" : "";
+}
+
+function poll() {
+  fetch("/status" + q).then(function(res) { return res.json(); }).then(function(s) {
+    var progress = document.getElementById("progress");
+    progress.max = s.total || 1;
+    progress.value = s.done;
+    document.getElementById("log").textContent = s.messages.join("\n");
+    document.getElementById("start").disabled = s.status == "running";
+    document.getElementById("download").className = s.status == "done" ? "" : "hidden";
+    if (s.status == "running") {
+      setStatus("Collecting: " + s.done + " of " + s.total + " requests complete");
+      setTimeout(poll, 1000);
+    } else if (s.status == "done") {
+      setStatus("Collection complete.");
+    } else if (s.status == "failed") {
+      setStatus("Collection failed: " + s.error, true);
+    }
+  });
+}
+poll();
+</script>
+</body>
+</html>
+`
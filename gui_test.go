@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGUIServer(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	s, err := newGUIServer(resultZip, log)
+	if !a.NoError(err) {
+		return
+	}
+	q := "?token=" + s.token
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	a.Equal(http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/"+q, nil))
+	a.Equal(http.StatusOK, rec.Code)
+	a.Contains(rec.Body.String(), "ACI vetR collector")
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", "/collect"+q, strings.NewReader(`{"apic": "apic"}`)))
+	a.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/download"+q, nil))
+	a.Equal(http.StatusNotFound, rec.Code)
+
+	hooked := s.log.Hook(s)
+	hooked.Info().Msg("fetching resource...")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/status"+q, nil))
+	var status guiStatus
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	a.Equal("idle", status.Status)
+	a.Equal([]string{"info fetching resource..."}, status.Messages)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/?token=x"+s.token[1:], nil))
+	a.Equal(http.StatusForbidden, rec.Code)
+
+	// The archive is the one the collection named, e.g. from a template
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "aci-vetr-data-fabric1.zip")
+	a.NoError(ioutil.WriteFile(out, []byte("archive"), 0644))
+	s.state.setOutput(out)
+	s.mu.Lock()
+	s.status = "done"
+	s.mu.Unlock()
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/download"+q, nil))
+	a.Equal(http.StatusOK, rec.Code)
+	a.Contains(rec.Header().Get("Content-Disposition"), "aci-vetr-data-fabric1.zip")
+	a.Equal("archive", rec.Body.String())
+}
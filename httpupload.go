@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	uploadChunkSize = 8 << 20 // Bytes per upload request
+	uploadRetries   = 3
+)
+
+// Delay before the first retry of a failed chunk, doubled for each retry.
+var uploadBackoff = time.Second
+
+// httpUploader POSTs files to an ingestion endpoint in multipart chunks.
+// Each chunk carries the file name, size and checksum and its offset in the
+// file, so the endpoint can reassemble the file and a failed chunk can be
+// retried without restarting the upload. An upload resumes from the offset
+// the endpoint reports it already has, e.g. after the collector restarted.
+type httpUploader struct {
+	url       string
+	token     string // Bearer token, if required by the endpoint
+	chunkSize int64
+	client    *http.Client
+}
+
+func newHTTPUploader(dest, token string) (*httpUploader, error) {
+	u, err := url.Parse(dest)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upload URL %q, expected https://host/path", dest)
+	}
+	return &httpUploader{
+		url:       dest,
+		token:     token,
+		chunkSize: uploadChunkSize,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// upload posts a file in chunks, retrying each failed chunk.
+func (h *httpUploader) upload(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum, size, err := checksum(f)
+	if err != nil {
+		return err
+	}
+	start := h.resumeOffset(filepath.Base(file), size, sum)
+	if start > 0 && start == size {
+		// Already uploaded, e.g. before the collector restarted
+		return nil
+	}
+	chunk := make([]byte, h.chunkSize)
+	for offset := start; ; offset += h.chunkSize {
+		n, err := f.ReadAt(chunk, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		fields := map[string]string{
+			"name":   filepath.Base(file),
+			"size":   strconv.FormatInt(size, 10),
+			"sha256": sum,
+			"offset": strconv.FormatInt(offset, 10),
+		}
+		if err := h.postChunk(fields, chunk[:n]); err != nil {
+			return fmt.Errorf("chunk at offset %d: %v", offset, err)
+		}
+		if offset+int64(n) >= size {
+			break
+		}
+	}
+	return nil
+}
+
+// resumeOffset asks the endpoint how much of a file it already has:
+//
+//	GET {url}?name=aci-vetr-data.zip&size=1048576&sha256=...
+//
+// answered with {"offset": 524288}, the number of bytes received from the
+// start of the file. The upload starts from the beginning if the endpoint
+// doesn't support the query or has none of the file.
+func (h *httpUploader) resumeOffset(name string, size int64, sum string) int64 {
+	u, _ := url.Parse(h.url)
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("size", strconv.FormatInt(size, 10))
+	q.Set("sha256", sum)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return 0
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0
+	}
+	var status struct {
+		Offset int64 `json:"offset"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1024)).Decode(&status); err != nil {
+		return 0
+	}
+	if status.Offset < 0 || status.Offset > size {
+		return 0
+	}
+	return status.Offset
+}
+
+// postChunk posts a single chunk, retrying with backoff on network errors
+// and server errors.
+func (h *httpUploader) postChunk(fields map[string]string, data []byte) error {
+	backoff := uploadBackoff
+	var err error
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = h.post(fields, data); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post makes a single multipart request, reporting whether a failure may be
+// retried.
+func (h *httpUploader) post(fields map[string]string, data []byte) (bool, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for key, value := range fields {
+		w.WriteField(key, value)
+	}
+	part, err := w.CreateFormFile("chunk", fields["name"])
+	if err != nil {
+		return false, err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", h.url, &body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return res.StatusCode >= 500, fmt.Errorf("HTTP status %s: %s", res.Status, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPUpload(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	uploadBackoff = time.Millisecond
+	defer func() { uploadBackoff = time.Second }()
+
+	var (
+		mu       sync.Mutex
+		received = make(map[int64][]byte)
+		requests int
+		failed   bool
+		token    string
+		name     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			// Nothing to resume
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		offset, _ := strconv.ParseInt(r.FormValue("offset"), 10, 64)
+		// Fail the second chunk once
+		if offset > 0 && !failed {
+			failed = true
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		f, _, err := r.FormFile("chunk")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received[offset], _ = ioutil.ReadAll(f)
+		token = r.Header.Get("Authorization")
+		name = r.FormValue("name")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data.zip")
+	content := []byte("0123456789abcdefghij")
+	a.NoError(ioutil.WriteFile(file, content, 0644))
+
+	up, err := newHTTPUploader(server.URL+"/ingest", "secret")
+	if !a.NoError(err) {
+		return
+	}
+	up.chunkSize = 8
+	a.NoError(uploadFiles([]uploader{up}, []string{file}, log))
+	a.Equal(4, requests) // 3 chunks and a retry
+	a.Equal("Bearer secret", token)
+	a.Equal("data.zip", name)
+	a.Equal(content, append(append(received[0], received[8]...), received[16]...))
+	a.NoFileExists(file)
+}
+
+func TestHTTPUploadResume(t *testing.T) {
+	a := assert.New(t)
+	var (
+		mu       sync.Mutex
+		received = make(map[int64][]byte)
+		query    url.Values
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			// The first chunk was uploaded before a restart
+			query = r.URL.Query()
+			w.Write([]byte(`{"offset": 8}`))
+			return
+		}
+		offset, _ := strconv.ParseInt(r.FormValue("offset"), 10, 64)
+		f, _, err := r.FormFile("chunk")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received[offset], _ = ioutil.ReadAll(f)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data.zip")
+	content := []byte("0123456789abcdefghij")
+	a.NoError(ioutil.WriteFile(file, content, 0644))
+
+	up, err := newHTTPUploader(server.URL+"/ingest", "")
+	if !a.NoError(err) {
+		return
+	}
+	up.chunkSize = 8
+	a.NoError(up.upload(file))
+	a.Equal("data.zip", query.Get("name"))
+	a.Equal("20", query.Get("size"))
+	a.NotEmpty(query.Get("sha256"))
+	a.NotContains(received, int64(0))
+	a.Equal(content[8:], append(received[8], received[16]...))
+}
+
+func TestHTTPUploadClientError(t *testing.T) {
+	a := assert.New(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			requests++
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data.zip")
+	a.NoError(ioutil.WriteFile(file, []byte("archive"), 0644))
+
+	up, err := newHTTPUploader(server.URL, "")
+	if !a.NoError(err) {
+		return
+	}
+	a.Error(up.upload(file))
+	a.Equal(1, requests)
+
+	_, err = newHTTPUploader("ftp://host/path", "")
+	a.Error(err)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/mholt/archiver/v3"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+)
+
+// Metadata fields containing per-resource collection errors.
+var errorFields = []string{"errors", "ingestErrors"}
+
+// countRecords counts the collected records per prefix.
+func countRecords(db *buntdb.DB) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, _ string) bool {
+			if isRecord(key) {
+				prefix, _ := splitKey(key)
+				counts[prefix]++
+			}
+			return true
+		})
+	})
+	return counts, err
+}
+
+// readMeta reads the collection metadata.
+func readMeta(db *buntdb.DB) (gjson.Result, error) {
+	var meta string
+	err := db.View(func(tx *buntdb.Tx) error {
+		var err error
+		meta, err = tx.Get("meta")
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return gjson.Result{}, errors.New("no metadata found; is this a collection?")
+	}
+	return gjson.Parse(meta), err
+}
+
+// archiveMembers lists the files in a collection archive and their sizes.
+func archiveMembers(path string) (map[string]int, error) {
+	members := make(map[string]int)
+	err := archiver.Walk(path, func(f archiver.File) error {
+		if !f.IsDir() {
+			members[f.Name()] = int(f.Size())
+		}
+		return nil
+	})
+	return members, err
+}
+
+// inspect prints a summary of a collection archive or db file.
+func inspect(path string) error {
+	db, closeDB, err := openDB(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", path, err)
+	}
+	defer closeDB()
+	meta, err := readMeta(db)
+	if err != nil {
+		return err
+	}
+	counts, err := countRecords(db)
+	if err != nil {
+		return fmt.Errorf("cannot read records: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Collector version:\t%s\n", meta.Get("collectorVersion").Str)
+	fmt.Fprintf(w, "Timestamp:\t%s\n", meta.Get("timestamp").Str)
+	if source := meta.Get("source").Str; source != "" {
+		fmt.Fprintf(w, "Source:\t%s\n", source)
+	}
+	if v := meta.Get("apicVersion").Str; v != "" {
+		fmt.Fprintf(w, "APIC version:\t%s\n", v)
+	}
+	if preset := meta.Get("preset").Str; preset != "" {
+		fmt.Fprintf(w, "Preset:\t%s\n", preset)
+	}
+	if tier := meta.Get("tier").Str; tier != "" {
+		fmt.Fprintf(w, "Tier:\t%s\n", tier)
+	}
+	if n := meta.Get("standbyControllers.count").Str; n != "" {
+		fmt.Fprintf(w, "Standby controllers:\t%s\n", n)
+	}
+	if skipped := strs(meta.Get("skipped")); len(skipped) > 0 {
+		fmt.Fprintf(w, "Skipped (unsupported):\t%s\n", strings.Join(skipped, ", "))
+	}
+	if excluded := strs(meta.Get("versionExcluded")); len(excluded) > 0 {
+		fmt.Fprintf(w, "Excluded for version:\t%s\n", strings.Join(excluded, ", "))
+	}
+	w.Flush()
+
+	if isArchive(path) {
+		members, err := archiveMembers(path)
+		if err != nil {
+			return fmt.Errorf("cannot read archive: %v", err)
+		}
+		fmt.Println(strings.Repeat("=", 30))
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSIZE")
+		for _, name := range sortedKeys(members) {
+			fmt.Fprintf(w, "%s\t%d\n", name, members[name])
+		}
+		w.Flush()
+		if _, ok := members[manifestName]; ok {
+			n, err := verifyManifest(path)
+			if err != nil {
+				fmt.Printf("Manifest: %v\n", err)
+			} else {
+				fmt.Printf("Manifest: %d files verified\n", n)
+			}
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 30))
+	printCounts(os.Stdout, counts)
+
+	fmt.Println(strings.Repeat("=", 30))
+	errs := 0
+	for _, field := range errorFields {
+		meta.Get(field).ForEach(func(prefix, err gjson.Result) bool {
+			fmt.Printf("Error: %s: %s\n", prefix.Str, err.String())
+			errs++
+			return true
+		})
+	}
+	if errs == 0 {
+		fmt.Println("No collection errors.")
+	}
+	return nil
+}
+
+// printCounts writes the records per prefix as a table.
+func printCounts(out io.Writer, counts map[string]int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tRECORDS")
+	total := 0
+	for _, prefix := range sortedKeys(counts) {
+		fmt.Fprintf(w, "%s\t%d\n", prefix, counts[prefix])
+		total += counts[prefix]
+	}
+	fmt.Fprintf(w, "Total (%d resources)\t%d\n", len(counts), total)
+	w.Flush()
+}
+
+// responseCounts counts the records per prefix of a collection.
+func responseCounts(responses map[string]goaci.Res) map[string]int {
+	counts := make(map[string]int)
+	for prefix, res := range responses {
+		counts[prefix] = len(res.Array())
+	}
+	return counts
+}
+
+// strs converts a JSON array to strings.
+func strs(res gjson.Result) []string {
+	var s []string
+	for _, v := range res.Array() {
+		s = append(s, v.Str)
+	}
+	return s
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
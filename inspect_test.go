@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestInspect(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, out, log)) {
+		return
+	}
+
+	db, closeDB, err := openDB(out)
+	if !a.NoError(err) {
+		return
+	}
+	counts, err := countRecords(db)
+	a.NoError(err)
+	a.Equal(map[string]int{"fvTenant": 2, "fvBD": 1, "topSystem": 1}, counts)
+	meta, err := readMeta(db)
+	a.NoError(err)
+	a.Equal("icurl", meta.Get("source").Str)
+	closeDB()
+
+	members, err := archiveMembers(out)
+	a.NoError(err)
+	a.Contains(members, dbName)
+
+	a.NoError(inspect(out))
+}
+
+func TestPrintCounts(t *testing.T) {
+	a := assert.New(t)
+	counts := responseCounts(map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}, {"dn": "uni/tn-b"}]`),
+		"fvBD":     gjson.Parse(`[{"dn": "uni/tn-a/BD-a"}]`),
+		"fvAEPg":   gjson.Parse(`[]`),
+	})
+	a.Equal(map[string]int{"fvTenant": 2, "fvBD": 1, "fvAEPg": 0}, counts)
+
+	var buf bytes.Buffer
+	printCounts(&buf, counts)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	a.Equal([]string{"fvAEPg", "0"}, strings.Fields(lines[1]))
+	a.Equal([]string{"Total", "(3", "resources)", "3"}, strings.Fields(lines[4]))
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/mattn/go-colorable"
 	"github.com/rs/zerolog"
@@ -11,17 +13,55 @@ import (
 
 type Logger = zerolog.Logger
 
+// Minimum level of messages written to the console. File logging is not
+// affected.
+var consoleLevel = zerolog.InfoLevel
+
+// Write structured JSON instead of colorized text to the console.
+var consoleJSON bool
+
+// quiet checks whether progress messages are suppressed on the console.
+func quiet() bool {
+	return consoleLevel > zerolog.InfoLevel
+}
+
+// textConsole checks whether plain text, e.g. tables, may be printed to the
+// console alongside the log messages.
+func textConsole() bool {
+	return !quiet() && !consoleJSON
+}
+
+// separator prints a divider between the stages of a collection.
+func separator() {
+	if textConsole() {
+		fmt.Println(strings.Repeat("=", 30))
+	}
+}
+
 type MultiLevelWriter struct {
 	file    io.Writer
 	console io.Writer
 }
 
+// consoleWriter writes console messages as text or JSON.
+type consoleWriter struct {
+	text io.Writer
+	json io.Writer
+}
+
+func (w consoleWriter) Write(p []byte) (int, error) {
+	if consoleJSON {
+		return w.json.Write(p)
+	}
+	return w.text.Write(p)
+}
+
 func (w MultiLevelWriter) Write(p []byte) (int, error) {
 	return w.file.Write(p)
 }
 
 func (w MultiLevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
-	if level >= zerolog.InfoLevel {
+	if level >= consoleLevel {
 		n, err := w.console.Write(p)
 		if err != nil {
 			return n, err
@@ -30,18 +70,31 @@ func (w MultiLevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error)
 	return w.file.Write(p)
 }
 
-func newLogger() Logger {
-	file, err := os.Create(logFile)
+// newLogger logs to the console and the log file. The log file always includes
+// debug messages. If the log file can't be created, the logger only logs to
+// the console and the error is returned.
+func newLogger(path string, rotation logRotation) (Logger, error) {
+	var file io.Writer
+	f, err := openLogFile(path, rotation)
 	if err != nil {
-		panic(fmt.Sprintf("cannot create log file %s", logFile))
+		file = ioutil.Discard
+		err = fmt.Errorf("cannot create log file %s: %v", path, err)
+	} else {
+		file, openLog = f, f
 	}
+	return logTo(file), err
+}
 
-	// zerolog.SetGlobalLevel(zerolog.DebugLevel)
+// logTo logs to the console and the given file.
+func logTo(file io.Writer) Logger {
 	zerolog.DurationFieldInteger = true
 
 	writer := MultiLevelWriter{
-		file:    file,
-		console: zerolog.ConsoleWriter{Out: colorable.NewColorableStdout()},
+		file: file,
+		console: consoleWriter{
+			text: zerolog.ConsoleWriter{Out: colorable.NewColorableStdout()},
+			json: os.Stdout,
+		},
 	}
 	return zerolog.New(writer).With().Timestamp().Logger()
 }
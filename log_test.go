@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -30,3 +31,46 @@ func TestLogger(t *testing.T) {
 	a.True(strings.Contains(console, "info_test"))
 	a.False(strings.Contains(console, "debug_test"))
 }
+
+func TestLoggerQuiet(t *testing.T) {
+	a := assert.New(t)
+	defer func(level zerolog.Level) { consoleLevel = level }(consoleLevel)
+	consoleLevel = zerolog.WarnLevel
+
+	fileBuf := &bytes.Buffer{}
+	consoleBuf := &bytes.Buffer{}
+	log := zerolog.New(MultiLevelWriter{file: fileBuf, console: consoleBuf})
+
+	log.Info().Msg("info_test")
+	log.Warn().Msg("warn_test")
+	a.True(quiet())
+	a.Contains(fileBuf.String(), "info_test")
+	a.NotContains(consoleBuf.String(), "info_test")
+	a.Contains(consoleBuf.String(), "warn_test")
+}
+
+func TestConsoleJSON(t *testing.T) {
+	a := assert.New(t)
+	defer func(json bool) { consoleJSON = json }(consoleJSON)
+
+	textBuf := &bytes.Buffer{}
+	jsonBuf := &bytes.Buffer{}
+	log := zerolog.New(MultiLevelWriter{
+		file:    &bytes.Buffer{},
+		console: consoleWriter{text: textBuf, json: jsonBuf},
+	})
+
+	log.Info().Msg("text_test")
+	consoleJSON = true
+	log.Info().Str("resource", "fvTenant").Msg("json_test")
+	a.Contains(textBuf.String(), "text_test")
+	a.NotContains(textBuf.String(), "json_test")
+	a.Equal("fvTenant", gjson.Get(jsonBuf.String(), "resource").Str)
+}
+
+func TestNewLoggerWithoutFile(t *testing.T) {
+	a := assert.New(t)
+	log, err := newLogger(filepath.Join("missing", "dir", "aci-vetr-c.log"), logRotation{})
+	a.Error(err)
+	log.Debug().Msg("still usable")
+}
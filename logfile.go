@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Path of the log file; set from --log-file.
+var logPath = logFile
+
+// The log file of the logger, if it could be created.
+var openLog *rotatingFile
+
+// logRotation configures rotation of the log file. Rotated logs are
+// numbered, newest first, e.g. aci-vetr-c.log.1, aci-vetr-c.log.2.
+type logRotation struct {
+	maxSize int64         // Rotate when the log exceeds this size, 0 to disable
+	maxAge  time.Duration // Remove rotated logs older than this, 0 to disable
+	keep    int           // Number of rotated logs kept
+}
+
+// rotatingFile is a log file that is rotated by size.
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	opts logRotation
+	file *os.File
+	size int64
+}
+
+// openLogFile rotates any log left by the previous run and starts a new one.
+func openLogFile(path string, opts logRotation) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, opts: opts}
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		f.shift()
+	}
+	f.prune()
+	if err := f.create(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Without rotated logs kept, rotating would truncate the log mid-run,
+	// losing the start of the run from the archive, so the log is kept whole
+	if f.opts.maxSize > 0 && f.opts.keep > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.maxSize {
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate starts a new log, e.g. for each scheduled collection, so that the
+// archive of a collection only has its own log. Without rotated logs kept,
+// the log is truncated.
+func (f *rotatingFile) rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.next()
+}
+
+// next closes the log and starts a new one. It requires the lock to be held.
+func (f *rotatingFile) next() error {
+	f.file.Close()
+	f.shift()
+	f.prune()
+	return f.create()
+}
+
+// rotateLog starts a new log file, if there is one.
+func rotateLog() error {
+	if openLog == nil {
+		return nil
+	}
+	return openLog.rotate()
+}
+
+func (f *rotatingFile) create() error {
+	file, err := os.Create(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+// rotated returns the path of the nth rotated log.
+func (f *rotatingFile) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// shift renames the current log to .1, moving older logs up by one and
+// dropping those beyond the number kept. Errors are ignored, as there is
+// nowhere to log them.
+func (f *rotatingFile) shift() {
+	os.Remove(f.rotated(f.opts.keep))
+	for n := f.opts.keep - 1; n >= 1; n-- {
+		os.Rename(f.rotated(n), f.rotated(n+1))
+	}
+	if f.opts.keep > 0 {
+		os.Rename(f.path, f.rotated(1))
+	}
+}
+
+// prune removes rotated logs older than the maximum age, or beyond the
+// number kept, e.g. after the number was reduced.
+func (f *rotatingFile) prune() {
+	matches, _ := filepath.Glob(f.path + ".*")
+	for _, match := range matches {
+		var n int
+		if _, err := fmt.Sscanf(match[len(f.path):], ".%d", &n); err != nil {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if n > f.opts.keep || (f.opts.maxAge > 0 && time.Since(info.ModTime()) > f.opts.maxAge) {
+			os.Remove(match)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "aci-vetr-c.log")
+	read := func(path string) string {
+		b, _ := ioutil.ReadFile(path)
+		return string(b)
+	}
+
+	// Previous runs are kept, newest first
+	opts := logRotation{keep: 2}
+	for _, run := range []string{"first", "second", "third"} {
+		f, err := openLogFile(path, opts)
+		a.NoError(err)
+		f.Write([]byte(run))
+		f.file.Close()
+	}
+	a.Equal("third", read(path))
+	a.Equal("second", read(path+".1"))
+	a.Equal("first", read(path+".2"))
+	a.NoFileExists(path + ".3")
+
+	// Rotate by size
+	opts.maxSize = 8
+	f, err := openLogFile(path, opts)
+	a.NoError(err)
+	f.Write([]byte("12345"))
+	f.Write([]byte("67890"))
+	f.file.Close()
+	a.Equal("67890", read(path))
+	a.Equal("12345", read(path+".1"))
+	a.Equal("third", read(path+".2"))
+
+	// Without rotated logs kept, the log isn't rotated by size
+	f, err = openLogFile(path+"-whole", logRotation{maxSize: 8})
+	a.NoError(err)
+	f.Write([]byte("12345"))
+	f.Write([]byte("67890"))
+	f.file.Close()
+	a.Equal("1234567890", read(path+"-whole"))
+	a.NoFileExists(path + "-whole.1")
+
+	// Remove old logs
+	old := time.Now().Add(-48 * time.Hour)
+	a.NoError(os.Chtimes(path+".2", old, old))
+	f, err = openLogFile(path, logRotation{keep: 5, maxAge: 24 * time.Hour})
+	a.NoError(err)
+	f.file.Close()
+	a.Equal("", read(path))
+	a.Equal("67890", read(path+".1"))
+	a.Equal("12345", read(path+".2"))
+	a.NoFileExists(path + ".3")
+
+	// Without rotation, the log is truncated
+	f, err = openLogFile(path+"-new", logRotation{})
+	a.NoError(err)
+	f.Write([]byte("run"))
+	f.file.Close()
+	f, err = openLogFile(path+"-new", logRotation{})
+	a.NoError(err)
+	f.file.Close()
+	a.Equal("", read(path+"-new"))
+	a.NoFileExists(path + "-new.1")
+
+	// Start a new log, e.g. for a scheduled collection
+	f, err = openLogFile(path, logRotation{keep: 1})
+	a.NoError(err)
+	f.Write([]byte("first run"))
+	a.NoError(f.rotate())
+	f.Write([]byte("second run"))
+	f.file.Close()
+	a.Equal("second run", read(path))
+	a.Equal("first run", read(path+".1"))
+}
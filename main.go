@@ -1,161 +1,240 @@
 package main
 
 import (
-	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/brightpuddle/goaci"
-	"github.com/mholt/archiver"
+	"github.com/mholt/archiver/v3"
 	"github.com/rs/zerolog"
 	"github.com/tidwall/buntdb"
 	"github.com/tidwall/gjson"
-	"golang.org/x/sync/errgroup"
+
+	"aci-vetr-c/collector"
 )
 
 // Version comes from CI
 var version string
 
 const (
-	resultZip  = "aci-vetr-data.zip"
-	scriptName = "vetr-collect.sh"
-	logFile    = "aci-vetr-c.log"
-	dbName     = "data.db"
+	resultZip = "aci-vetr-data.zip"
+	logFile   = "aci-vetr-c.log"
+	dbName    = "data.db"
 )
 
-// Write requests to script to be run on the APIC.
-// Note, this is a more complicated collection methodology and should rarely
-// be used.
-func writeScript(log zerolog.Logger) error {
-	var (
-		final     = "aci-vetr-raw.zip"
-		tmpFolder = "/tmp/aci-vetr-collections"
-	)
-	os.Remove(scriptName)
-	script := []string{
-		"#!/bin/bash",
-		"",
-		"mkdir " + tmpFolder,
-		"",
-		"# Fetch data from API",
-	}
-
-	client := goaci.Client{}
+// Page files written by the script, e.g. fvCEp.2.json
+var pageFile = regexp.MustCompile(`^(.+)\.(\d+)\.json$`)
 
-	for _, request := range getRequests() {
-		req := client.NewReq("GET", request.path, nil, request.mods...)
-		cmd := fmt.Sprintf("icurl -kG https://localhost/%s", req.HttpReq.URL.Path)
-
-		for key, value := range req.HttpReq.URL.Query() {
-			if len(value) >= 1 {
-				cmd = fmt.Sprintf("%s -d '%s=%s'", cmd, key, value[0])
-			}
-		}
-		cmd = fmt.Sprintf("%s > %s/%s", cmd, tmpFolder, request.prefix+".json")
-		script = append(script, cmd)
+// joinPages joins the pages of a raw response. A failed page fails the
+// whole response, as the records would be incomplete.
+func joinPages(pages map[int]goaci.Res) goaci.Res {
+	var numbers []int
+	for n := range pages {
+		numbers = append(numbers, n)
 	}
-
-	script = append(script, []string{
-		"",
-		"# Zip result",
-		fmt.Sprintf("zip -mj ~/%s %s/*.json", final, tmpFolder),
-		"",
-		"# Cleanup",
-		"rm -rf " + tmpFolder,
-		"",
-		"echo Collection complete.",
-		fmt.Sprintf("echo Provide Cisco Services the %s file.", final),
-	}...)
-
-	err := ioutil.WriteFile(scriptName, []byte(strings.Join(script, "\n")), 0755)
-	if err != nil {
-		return err
+	sort.Ints(numbers)
+	var records []string
+	for _, n := range numbers {
+		if rawError(pages[n]) != nil {
+			return pages[n]
+		}
+		for _, record := range pages[n].Get("imdata").Array() {
+			records = append(records, record.Raw)
+		}
 	}
-	log.Info().Msgf("Script complete. Run %s on the APIC.", scriptName)
-	return nil
+	return gjson.Parse(fmt.Sprintf(`{"totalCount":"%d","imdata":[%s]}`,
+		len(records), strings.Join(records, ",")))
 }
 
 // Translate raw (script) data to aci-vetr-data.zip file for backend consumption.
+// Each file in the raw archive is the response for a single request, named
+// for the request prefix, e.g. fvTenant.json.
 func readRaw(in, out string, log zerolog.Logger) error {
-	results := make(map[string]goaci.Res)
+	raw := make(map[string]goaci.Res)
+	pages := make(map[string]map[int]goaci.Res)
 	// Read data from zip
 	err := archiver.Walk(in, func(f archiver.File) error {
-		zfh, ok := f.Header.(zip.FileHeader)
-		if ok && strings.HasSuffix(zfh.Name, ".json") {
-			prefix := strings.TrimSuffix(zfh.Name, ".json")
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
 			b, err := ioutil.ReadAll(f)
 			if err != nil {
 				return err
 			}
-			json := gjson.ParseBytes(b)
-			results[prefix] = json
+			if m := pageFile.FindStringSubmatch(f.Name()); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				if pages[m[1]] == nil {
+					pages[m[1]] = make(map[int]goaci.Res)
+				}
+				pages[m[1]][n] = gjson.ParseBytes(b)
+				return nil
+			}
+			raw[strings.TrimSuffix(f.Name(), ".json")] = gjson.ParseBytes(b)
 		}
 		return nil
 	})
 	if err != nil {
 		return fmt.Errorf("error reading from archive: %v", err)
 	}
+	for prefix, p := range pages {
+		raw[prefix] = joinPages(p)
+	}
 
 	// Apply filters
-	for _, request := range getRequests() {
-		if res, ok := results[request.prefix]; ok {
-			results[request.prefix] = res.Get("imdata." + request.filter)
+	filters := make(map[string]string)
+	for _, request := range collector.Requests() {
+		filters[request.Prefix] = request.Filter
+	}
+	results := make(map[string]goaci.Res)
+	ingestErrors := goaci.Body{Str: "{}"}
+	for prefix, res := range raw {
+		if err := rawError(res); err != nil {
+			log.Warn().Err(err).Str("resource", prefix).Msg("skipping failed request")
+			ingestErrors = ingestErrors.Set(prefix, err.Error())
+			continue
+		}
+		filter, ok := filters[prefix]
+		if !ok {
+			// Unknown request, e.g. from a newer script; unwrap any class
+			log.Debug().Str("resource", prefix).Msg("no request for resource")
+			filter = "#.*.attributes"
 		}
+		results[prefix] = res.Get("imdata." + filter)
+		log.Info().Str("resource", prefix).Int("count", len(results[prefix].Array())).Msg("read resource")
 	}
 
-	// Write to DB
-	if err := writeToDB(results); err != nil {
-		return fmt.Errorf("error writing to DB: %v", err)
+	// Write to DB and create archive
+	meta := goaci.Body{}.
+		Set("source", "icurl").
+		SetRaw("ingestErrors", ingestErrors.Str)
+	if err := writeArchive(out, results, meta, archiveOptions{files: []string{logPath}}, log); err != nil {
+		return err
 	}
-	defer os.Remove(dbName)
 
-	// Create archive
-	log.Info().Msg("Creating archive")
-	os.Remove(out) // Remove any old archives and ignore errors
-	if err := archiver.Archive([]string{dbName}, out); err != nil {
-		return fmt.Errorf("cannot create archive: %v", err)
+	// Cleanup
+	separator()
+	if quiet() {
+		fmt.Println(out)
+	} else {
+		log.Info().Msgf("Please provide %s to Cisco Services for further analysis.", out)
 	}
+	return nil
+}
 
-	// Cleanup
-	fmt.Println(strings.Repeat("=", 30))
-	log.Info().Msgf("Please provide %s to Cisco Services for further analysis.", out)
+// rawError checks a raw response for an empty or invalid body, or an APIC
+// error, e.g. from an unsupported class.
+func rawError(res goaci.Res) error {
+	if !res.IsObject() || !res.Get("imdata").IsArray() {
+		return errors.New("invalid or empty response")
+	}
+	if text := res.Get("imdata.0.error.attributes.text").Str; text != "" {
+		return fmt.Errorf("APIC error: %s", text)
+	}
 	return nil
 }
 
 // Write results to db file.
-func writeToDB(responses map[string]goaci.Res) error {
+// Additional metadata fields can be provided in meta.
+func writeToDB(responses map[string]goaci.Res, meta goaci.Body, log Logger) error {
 	db, err := buntdb.Open(dbName)
 	if err != nil {
 		return fmt.Errorf("cannot open output file: %v", err)
 	}
 	defer db.Close()
+	return fillDB(db, responses, meta, log)
+}
 
-	for prefix, res := range responses {
-		if err := db.Update(func(tx *buntdb.Tx) error {
-			for _, record := range res.Array() {
-				key := fmt.Sprintf("%s:%s", prefix, record.Get("dn").Str)
-				if _, _, err := tx.Set(key, record.Raw, nil); err != nil {
-					return fmt.Errorf("cannot set key: %v", err)
-				}
-			}
-			return nil
-		}); err != nil {
-			return fmt.Errorf("cannot write to DB file: %v", err)
+// writeToMemory builds the db in memory and returns its contents, so that
+// it's only ever written to disk inside the archive.
+func writeToMemory(responses map[string]goaci.Res, meta goaci.Body, log Logger) ([]byte, error) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open in-memory db: %v", err)
+	}
+	defer db.Close()
+	if err := fillDB(db, responses, meta, log); err != nil {
+		return nil, err
+	}
+	return saveDB(db)
+}
+
+// saveDB returns the contents of an in-memory db.
+func saveDB(db *buntdb.DB) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := db.Save(&buf); err != nil {
+		return nil, fmt.Errorf("cannot save in-memory db: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// openCollection opens the db the records of a collection are written to as
+// they're fetched: data.db, or an in-memory db with --in-memory.
+func openCollection(inMemory bool) (*buntdb.DB, error) {
+	if inMemory {
+		db, err := buntdb.Open(":memory:")
+		if err != nil {
+			return nil, fmt.Errorf("cannot open in-memory db: %v", err)
 		}
+		return db, nil
+	}
+	// The records of an interrupted run would be added to the collection
+	if err := wipe(dbName); err != nil {
+		return nil, fmt.Errorf("cannot remove %s: %v", dbName, err)
+	}
+	db, err := buntdb.Open(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open output file: %v", err)
+	}
+	return db, nil
+}
+
+// closeCollection adds the metadata to the collection db and closes it,
+// returning its contents if it's in memory.
+func closeCollection(db *buntdb.DB, responses map[string]goaci.Res, meta goaci.Body, inMemory bool) ([]byte, error) {
+	defer db.Close()
+	if err := writeMeta(db, responses, meta); err != nil {
+		return nil, err
+	}
+	if inMemory {
+		return saveDB(db)
 	}
+	return nil, db.Close()
+}
 
-	// Add metadata
-	metadata := goaci.Body{}.
+// fillDB writes the records and metadata to a db.
+func fillDB(db *buntdb.DB, responses map[string]goaci.Res, meta goaci.Body, log Logger) error {
+	if err := collector.WriteRecords(db, responses, log); err != nil {
+		return err
+	}
+	return writeMeta(db, responses, meta)
+}
+
+// writeMeta writes the metadata and the summary of the responses to a db.
+func writeMeta(db *buntdb.DB, responses map[string]goaci.Res, meta goaci.Body) error {
+	metadata := meta.
 		Set("collectorVersion", version).
 		Set("timestamp", time.Now().String()).
+		SetRaw("standbyControllers", standbySummary(responses["infraSnNode"])).
 		Str
+	summary, err := buildSummary(responses, gjson.Get(meta.Str, "preset").Str)
+	if err != nil {
+		return fmt.Errorf("cannot build summary: %v", err)
+	}
 	if err := db.Update(func(tx *buntdb.Tx) error {
 		if _, _, err := tx.Set("meta", string(metadata), nil); err != nil {
 			return fmt.Errorf("cannot write metadata to db: %v", err)
 		}
+		if _, _, err := tx.Set("summary", summary, nil); err != nil {
+			return fmt.Errorf("cannot write summary to db: %v", err)
+		}
 		return nil
 	}); err != nil {
 		return err
@@ -163,120 +242,655 @@ func writeToDB(responses map[string]goaci.Res) error {
 	return nil
 }
 
-func fetch(client goaci.Client, reqs []*Request, log Logger) (map[string]goaci.Res, error) {
-	responses := make(map[string]goaci.Res)
-	var g errgroup.Group
-
-	for _, req := range reqs {
-		req := req
-
-		g.Go(func() error {
-			startTime := time.Now()
-			log.Debug().Time("start_time", startTime).Msgf("begin: %s", req.prefix)
-
-			log.Info().Str("resource", req.prefix).Msg("fetching resource...")
-			log.Debug().Str("url", req.path).Msg("requesting resource")
-
-			res, err := client.Get(req.path)
-			if err != nil {
-				return fmt.Errorf("failed to make request: %v", err)
-			}
-			responses[req.prefix] = res.Get("imdata." + req.filter)
-			log.Debug().
-				TimeDiff("elapsed_time", time.Now(), startTime).
-				Msgf("done: %s", req.prefix)
-			return nil
-		})
-	}
-
-	err := g.Wait()
-	return responses, err
-}
-
 // Fetch data via API.
-func fetchHttp(args Args, log zerolog.Logger) error {
-	client, err := goaci.NewClient(
-		args.APIC,
-		args.Username,
-		args.Password,
-		goaci.RequestTimeout(600),
+// Progress is tracked in state, which may be nil.
+func fetchHttp(args CollectCmd, state *runState, log zerolog.Logger) (err error) {
+	if args.Email != nil {
+		if err := args.Email.validate(); err != nil {
+			return err
+		}
+	}
+	var replay *replayer
+	if args.Replay != "" {
+		if replay, err = readRecording(args.Replay); err != nil {
+			return err
+		}
+		if args.APIC == "" {
+			args.APIC = replay.host
+		}
+	}
+	run := runReport{id: args.runID, apic: args.APIC, start: time.Now()}
+	if run.id == "" {
+		run.id = newRunID()
+	}
+	var output string
+	defer func() {
+		if !isPartial(err) {
+			run.err = err
+		}
+		if output == "" {
+			output = expandOutput(args.Output, args.APIC, nil, run.start)
+		}
+		if err := writeRunSummary(runSummaryPath(output), run); err != nil {
+			log.Warn().Err(err).Msg("cannot write run summary")
+		}
+		notify(args, run, log)
+	}()
+	for i := range args.FollowUp {
+		if err := args.FollowUp[i].validate(); err != nil {
+			return err
+		}
+	}
+	var (
+		previous       map[string]goaci.Res
+		previousFailed []string
 	)
+	if args.OnlyFailed {
+		if previous, previousFailed, err = readPrevious(args.DB); err != nil {
+			return err
+		}
+	}
+	var maxSize int64
+	if args.MaxArchiveSize != "" {
+		if maxSize, err = parseSize(args.MaxArchiveSize); err != nil {
+			return err
+		}
+	}
+	limits := collector.Limits{Requests: args.MaxRequests}
+	if args.MemoryBudget != "" {
+		budget, err := parseSize(args.MemoryBudget)
+		if err != nil {
+			return err
+		}
+		limits.Memory = uint64(budget)
+	}
+	ups, err := uploaders(args)
 	if err != nil {
-		return fmt.Errorf("failed to create ACI client: %v", err)
+		return err
 	}
+	hosts := splitHosts(args.APIC)
+	mods := args.Connection.clientMods(run.id)
+	switch {
+	case args.Record != "":
+		rec, err := newRecorder(args.Record)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+		mods = append(mods, rec.wrap)
+		log.Info().Str("file", args.Record).Msg("Recording requests and responses")
+	case replay != nil:
+		mods = append(mods, replay.wrap)
+		log.Info().Str("file", args.Replay).Msg("Replaying a recording rather than querying the APIC")
+	}
+	pool := collector.NewPool(hosts, args.Username, args.Password, log, mods...)
 
 	// Authenticate
-	log.Info().Str("host", args.APIC).Msg("APIC host")
+	log.Info().Strs("hosts", hosts).Msg("APIC host")
 	log.Info().Str("user", args.Username).Msg("APIC username")
+	log.Info().Str("run_id", run.id).Str("user_agent", userAgent()).Msg("Collection run")
 	log.Info().Msg("Authenticating to the APIC...")
-	if err := client.Login(); err != nil {
-		return fmt.Errorf("cannot authenticate to the APIC at %s: %v", args.APIC, err)
+	if err := pool.Login(); err != nil {
+		return exitError{exitAuth, fmt.Errorf("cannot authenticate to the APIC at %s: %v", args.APIC, err)}
+	}
+	log.Info().Str("host", pool.Host()).Msg("Authenticated to the APIC")
+	if err := verifyActive(pool, log); err != nil {
+		return err
+	}
+	meta := goaci.Body{}.Set("runId", run.id)
+	if args.Replay != "" {
+		meta = meta.Set("replay", filepath.Base(args.Replay))
+	}
+	set, err := buildRequests(pool, args, previousFailed, log)
+	if err != nil {
+		return err
+	}
+	run.reqs = set.reqs
+	if set.vendor != "" {
+		meta = meta.Set("cloud", set.vendor)
+	} else if args.Preset != "" {
+		meta = meta.Set("preset", args.Preset)
+	}
+	if plugins := collector.Plugins(); len(plugins) > 0 {
+		var names []string
+		for _, p := range plugins {
+			names = append(names, p.Name())
+		}
+		log.Info().Strs("plugins", names).Msg("Plugins")
+		b, _ := json.Marshal(names)
+		meta = meta.SetRaw("plugins", string(b))
+	}
+	if set.version != "" {
+		meta = meta.Set("apicVersion", set.version)
+		if len(set.excluded) > 0 {
+			b, _ := json.Marshal(set.excluded)
+			meta = meta.SetRaw("versionExcluded", string(b))
+		}
+	}
+	if len(set.history) > 0 {
+		window := args.History
+		if window == "" {
+			window = defaultHistory
+		}
+		meta = meta.Set("history", window)
+	}
+	if args.SkipStats {
+		meta = meta.SetRaw("skipStats", "true")
+	}
+	if args.FaultSeverity != "" {
+		meta = meta.Set("faultMinSeverity", args.FaultSeverity)
+	}
+	if args.SkipAcked {
+		meta = meta.SetRaw("skipAckedFaults", "true")
+	}
+	if args.Pod > 0 {
+		meta = meta.Set("pod", strconv.Itoa(args.Pod))
+	}
+	if len(args.Tenant) > 0 {
+		b, _ := json.Marshal(args.Tenant)
+		meta = meta.SetRaw("tenants", string(b))
 	}
 
 	// Fetch data from API
-	fmt.Println(strings.Repeat("=", 30))
+	separator()
 
-	responses, err := fetch(client, getRequests(), log)
+	if state == nil {
+		state = newRunState()
+	}
+	state.start()
+	if args.ControlAddr != "" {
+		ln, err := serveControl(args.ControlAddr, state, log)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+	}
+	client := pausable{Getter: pool, state: state}
+
+	// The records are written to the db as they're fetched
+	db, err := openCollection(args.InMemory)
+	if err != nil {
+		return err
+	}
+	w := collector.NewWriter(db, limits, log)
+	defer func() {
+		w.Close()
+		db.Close()
+		if !args.InMemory {
+			wipe(dbName)
+		}
+	}()
+	if err := collector.FetchTo(client, set.fetch, limits, w, log); err != nil {
+		return err
+	}
+	// The tenant subtrees and shards are those of the tenants and nodes
+	scopes, err := collector.ReadRecords(db, "fvTenant", "topSystem")
 	if err != nil {
 		return err
 	}
+	if len(set.tenant) > 0 {
+		// The tenants come from the tenant query; without it, query per class
+		if _, ok := w.Counts()["fvTenant"]; ok {
+			err = collector.FetchTenants(client, set.tenant, scopes["fvTenant"], limits, w, log)
+		} else {
+			log.Warn().Msg("no tenants collected; fetching tenant classes per class")
+			collector.FetchTo(client, collector.ForTenants(set.tenant, args.Tenant), limits, w, log)
+			err = w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Huge classes are split by the tenants and nodes collected
+	if err := collector.FetchShards(client, set.shard, scopes, limits, w, log); err != nil {
+		return err
+	}
 
-	if err := writeToDB(responses); err != nil {
-		return fmt.Errorf("error writing to DB: %v", err)
+	responses, err := readBack(db, args)
+	if err != nil {
+		return err
+	}
+	fetched := make(map[string]goaci.Res)
+	for prefix, res := range responses {
+		fetched[prefix] = res
+	}
+	if args.OnlyFailed {
+		// Follow-up queries and aggregates are kept from the previous run
+		if err := mergePrevious(w, previous); err != nil {
+			return err
+		}
+	} else {
+		followUps, err := fetchFollowUps(client, args.FollowUp, responses, limits, log)
+		run.reqs = append(run.reqs, followUps...)
+		if err != nil {
+			return err
+		}
+		// Cloud APIC has no leaves
+		if set.vendor == "" {
+			if err := fetchContractCounts(client, responses, log); err != nil {
+				log.Warn().Err(err).Msg("cannot count contracts per leaf")
+				run.warnings = append(run.warnings, fmt.Sprintf("cannot count contracts per leaf: %v", err))
+			} else {
+				run.reqs = append(run.reqs, derivedRequests(map[string]goaci.Res{
+					contractsPerLeaf: responses[contractsPerLeaf],
+				}, false)...)
+			}
+		}
+		for _, err := range collector.RunPlugins(client, responses, log) {
+			log.Warn().Err(err).Msg("plugin failed")
+			run.warnings = append(run.warnings, err.Error())
+		}
+		if args.NDO != "" {
+			ndo, errs, err := fetchNDO(args, run.id, log)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			for _, err := range errs {
+				log.Warn().Err(err).Msg("cannot collect NDO")
+				run.warnings = append(run.warnings, err.Error())
+			}
+			for prefix, res := range ndo {
+				responses[prefix] = res
+			}
+			run.reqs = append(run.reqs, derivedRequests(ndo, false)...)
+			meta = meta.Set("ndo", args.NDO)
+		}
+	}
+	if err := storeChanged(w, fetched, responses); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	counts := w.Counts()
+	run.fabric = fabricName(responses)
+	run.counts = counts
+
+	// The collection continues without failed classes; record what's missing
+	failed := collector.FailedClasses(run.reqs)
+	var missing []string
+	for prefix := range failed {
+		missing = append(missing, prefix)
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		b, _ := json.Marshal(failed)
+		meta = meta.SetRaw("errors", string(b))
+		run.warnings = append(run.warnings, fmt.Sprintf("%d classes failed: %s",
+			len(missing), strings.Join(missing, ", ")))
 	}
 
-	fmt.Println(strings.Repeat("=", 30))
+	separator()
+	reportTimings(classTimings(set.reqs), log)
+
+	// Write to DB and create archive
+	output = expandOutput(args.Output, pool.Host(), responses, time.Now())
+	state.setOutput(output)
+	outputs := []string{output}
+	opts := archiveOptions{
+		payloads:    append(payloads(args), runSummaryPayload(&run)),
+		compression: args.Compression,
+		inMemory:    args.InMemory,
+		keepDB:      args.KeepDB,
+	}
+	if skipped := collector.SkippedClasses(set.reqs); len(skipped) > 0 {
+		b, _ := json.Marshal(skipped)
+		meta = meta.SetRaw("skipped", string(b))
+	}
+	if args.SplitSensitive {
+		// The catalog has the tiers of the previous collection's classes,
+		// with --only-failed
+		tiers := append(append([]*collector.Request{}, set.catalog...), run.reqs...)
+		config, sensitive := splitTiers(responses, tiers)
+		// Each tier has its own db, built from the records read back
+		db.Close()
+		if !args.InMemory {
+			wipe(dbName)
+		}
+		if err := writeArchive(output, config, meta.Set("tier", configTier), opts, log); err != nil {
+			return exitError{exitArchive, err}
+		}
+		// The log is included with the sensitive data as it contains usernames
+		out := sensitiveOutput(output)
+		opts.files = []string{args.archiveLog()}
+		if err := writeArchive(out, sensitive, meta.Set("tier", sensitiveTier), opts, log); err != nil {
+			return exitError{exitArchive, err}
+		}
+		outputs = append(outputs, out)
+	} else {
+		opts.files = []string{args.archiveLog()}
+		opts.db, opts.counts = db, counts
+		if err := writeArchive(output, responses, meta, opts, log); err != nil {
+			return exitError{exitArchive, err}
+		}
+	}
 
-	// Create archive
-	log.Info().Msg("Creating archive")
-	os.Remove(args.Output) // Remove any old archives and ignore errors
-	if err := archiver.Archive([]string{dbName, logFile}, args.Output); err != nil {
-		return fmt.Errorf("cannot create archive: %v", err)
+	if maxSize > 0 {
+		var files []string
+		for _, out := range outputs {
+			split, err := splitArchive(out, maxSize, log)
+			if err != nil {
+				return exitError{exitArchive, fmt.Errorf("cannot split archive: %v", err)}
+			}
+			files = append(files, split...)
+		}
+		outputs = files
 	}
 
+	if len(ups) > 0 {
+		if err := uploadFiles(ups, outputs, log); err != nil {
+			return exitError{exitArchive, err}
+		}
+	}
+	run.outputs = outputs
+
 	// Cleanup
-	fmt.Println(strings.Repeat("=", 30))
-	log.Info().Msg("Collection complete.")
-	log.Info().Msgf("Please provide %s to Cisco Services for further analysis.", args.Output)
+	separator()
+	for _, prefix := range missing {
+		log.Error().Str("resource", prefix).Str("error", failed[prefix]).Msg("missing from the collection")
+	}
+	for _, prefix := range sortedKeys(counts) {
+		log.Debug().Str("resource", prefix).Int("records", counts[prefix]).Msg("records stored")
+	}
+	if textConsole() {
+		printCounts(os.Stdout, counts)
+		separator()
+	}
+	if len(missing) > 0 {
+		log.Warn().Msgf("Collection complete, but %d classes are missing.", len(missing))
+	} else {
+		log.Info().Msg("Collection complete.")
+	}
+	if quiet() {
+		fmt.Println(strings.Join(outputs, "\n"))
+	} else if len(ups) > 0 {
+		log.Info().Msgf("Uploaded %s.", strings.Join(outputs, " and "))
+	} else {
+		log.Info().Msgf("Please provide %s to Cisco Services for further analysis.",
+			strings.Join(outputs, " and "))
+	}
+	if len(run.warnings) > 0 {
+		return exitError{exitPartial, fmt.Errorf("collection completed with warnings: %s",
+			strings.Join(run.warnings, "; "))}
+	}
+	return nil
+}
+
+// writeArchive writes results to the db file and archives it along with any
+// additional files.
+func writeArchive(out string, responses map[string]goaci.Res, meta goaci.Body, opts archiveOptions, log Logger) error {
+	var inMemory map[string][]byte
+	counts := opts.counts
+	switch {
+	case opts.db != nil:
+		// The records are already in the db; it only lacks the metadata
+		b, err := closeCollection(opts.db, responses, meta, opts.inMemory)
+		if err != nil {
+			return fmt.Errorf("error writing to DB: %v", err)
+		}
+		if opts.inMemory {
+			inMemory = map[string][]byte{dbName: b}
+		} else {
+			defer wipe(dbName)
+		}
+	case opts.inMemory:
+		b, err := writeToMemory(responses, meta, log)
+		if err != nil {
+			return fmt.Errorf("error writing to DB: %v", err)
+		}
+		inMemory = map[string][]byte{dbName: b}
+	default:
+		if err := writeToDB(responses, meta, log); err != nil {
+			return fmt.Errorf("error writing to DB: %v", err)
+		}
+		defer wipe(dbName)
+	}
+	if counts == nil {
+		counts = responseCounts(responses)
+	}
+
+	members := []string{dbName}
+	for _, p := range opts.payloads {
+		written, err := p(responses)
+		for _, file := range written {
+			defer wipe(file)
+		}
+		if err != nil {
+			return err
+		}
+		members = append(members, written...)
+	}
+	for _, file := range opts.files {
+		if _, err := os.Stat(file); err != nil {
+			log.Warn().Err(err).Msgf("not adding %s to archive", file)
+			continue
+		}
+		members = append(members, file)
+	}
+
+	if _, err := collector.NewArchiver(out, opts.compression); err != nil {
+		return err
+	}
+	// Nothing may be logged between the manifest and the archive, as the log
+	// is one of the members
+	log.Info().Str("file", out).Msg("Creating archive")
+	if err := writeManifest(members, inMemory, counts, meta); err != nil {
+		return err
+	}
+	defer wipe(manifestName)
+	members = append(members, manifestName)
+	os.Remove(out) // Remove any old archives and ignore errors
+	if err := collector.CreateArchive(out, members, inMemory, opts.compression); err != nil {
+		return fmt.Errorf("cannot create archive: %v", err)
+	}
+	// Catch truncated archives, e.g. when the disk fills mid-write
+	n, err := verifyManifest(out)
+	if err != nil {
+		return fmt.Errorf("archive %s is incomplete: %v", out, err)
+	}
+	log.Debug().Str("file", out).Int("files", n).Msg("Verified archive")
+	if opts.keepDB {
+		kept := keptDBPath(out)
+		if err := os.Rename(dbName, kept); err != nil {
+			log.Warn().Err(err).Msgf("cannot keep %s", dbName)
+		} else {
+			log.Info().Str("file", kept).Msg("Kept raw database")
+		}
+	}
 	return nil
 }
 
+// keptDBPath returns the path of the raw database kept next to an archive
+// with --keep-db.
+func keptDBPath(out string) string {
+	base, _ := splitExt(out)
+	return base + ".db"
+}
+
 func main() {
-	log := newLogger()
+	args, err := newArgs()
+	// Before the log is opened, as services start in another directory
+	inService, serviceErr := enterService(args.Config)
+	if args.LogFile != "" {
+		logPath = args.LogFile
+	}
+	log, logErr := newLogger(logPath, args.logRotation)
 	defer func() {
+		code := exitCode(err)
 		if r := recover(); r != nil {
 			if err, ok := r.(error); ok {
 				log.Error().Err(err).Msg("unexpected error")
 			}
 			log.Error().Msg("Collection failed.")
-		} else {
+			code = exitFailure
+		} else if args.removeLog(err) {
 			// TODO move cleanup into the archive lib, e.g. zip -m
-			os.Remove(logFile)
+			os.Remove(logPath)
 		}
-		os.Remove(dbName)
-		fmt.Println("Press enter to exit.")
-		var throwaway string
-		fmt.Scanln(&throwaway)
+		wipe(dbName)
+		if args.interactive() && (args.Collect == nil || args.Collect.Schedule == "") {
+			fmt.Println("Press enter to exit.")
+			var throwaway string
+			fmt.Scanln(&throwaway)
+		}
+		os.Exit(code)
 	}()
-	args, err := newArgs()
 	if err != nil {
-		panic(err)
+		log.Error().Err(err).Msg("invalid arguments")
+		return
 	}
+	if logErr != nil {
+		log.Warn().Err(logErr).Msg("logging to the console only")
+	}
+	if serviceErr != nil {
+		err = serviceErr
+		log.Error().Err(err).Msg("cannot start service")
+		return
+	}
+	consoleJSON = args.LogFormat == "json"
+	if args.Syslog != "" {
+		hook, err := newSyslogHook(args.Syslog)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot forward log messages to syslog")
+		} else {
+			log = log.Hook(hook)
+		}
+	}
+	switch {
+	case args.Verbose || args.Debug:
+		consoleLevel = zerolog.DebugLevel
+	case args.Quiet:
+		consoleLevel = zerolog.WarnLevel
+	}
+	stopProfiling, perr := startProfiling(args, log)
+	if perr != nil {
+		log.Warn().Err(perr).Msg("cannot start profiling")
+	}
+	defer stopProfiling()
 	switch {
-	case args.WriteScript:
-		err := writeScript(log)
+	case args.Collect != nil:
+		cmd := *args.Collect
+		switch {
+		case inService:
+			err = runService(cmd, log)
+			if err != nil {
+				log.Error().Err(err).Msg("service failed")
+			}
+		case cmd.DryRun:
+			err = dryRun(cmd, log)
+			if err != nil {
+				log.Error().Err(err).Msg("cannot estimate collection impact")
+			}
+		case cmd.SSH:
+			err = sshCollect(cmd, log)
+			if err != nil {
+				log.Error().Err(err).Msg("cannot collect over SSH")
+			}
+		case cmd.Schedule != "":
+			err = runSchedule(cmd, nil, log)
+			if err != nil {
+				log.Error().Err(err).Msg("cannot run scheduled collection")
+			}
+		default:
+			err = fetchHttp(cmd, nil, log)
+			if isPartial(err) {
+				log.Warn().Err(err).Msg("collection incomplete")
+			} else if err != nil {
+				log.Error().Err(err).Msg("cannot fetch data from the API")
+			}
+		}
+	case args.ICurl != nil:
+		err = writeScript(*args.ICurl, log)
 		if err != nil {
 			log.Error().Err(err).Msg("cannot create script")
 		}
-	case args.ReadRaw != "":
-		err := readRaw(args.ReadRaw, args.Output, log)
+	case args.Check != nil:
+		err = check(args.Check.Connection, log)
+		if err != nil {
+			log.Error().Err(err).Msg("check failed")
+		}
+	case args.Ingest != nil && args.Ingest.ConfigExport != "":
+		err = readConfigExport(args.Ingest.ConfigExport, args.Ingest.Output, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot read config export")
+		}
+	case args.Ingest != nil:
+		err = readRaw(args.Ingest.Input, args.Ingest.Output, log)
 		if err != nil {
 			log.Error().Err(err).Msg("cannot read script output")
 		}
-	default:
-		err := fetchHttp(args, log)
+	case args.Inspect != nil:
+		err = inspect(args.Inspect.Path)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot inspect collection")
+		}
+	case args.Join != nil:
+		var out string
+		out, err = joinArchive(args.Join.Manifest, args.Join.Output)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot join archive")
+		} else {
+			log.Info().Msgf("Joined parts into %s", out)
+		}
+	case args.Merge != nil:
+		err = merge(args.Merge.Inputs, args.Merge.Output, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot merge collections")
+		}
+	case args.Query != nil:
+		err = query(*args.Query)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot query collection")
+		}
+	case args.Export != nil:
+		err = export(args.Export.Input, args.Export.Out, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot export collection")
+		}
+	case args.Diff != nil:
+		err = diff(args.Diff.Old, args.Diff.New, args.Diff.Keys)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot compare collections")
+		}
+	case args.Control != nil:
+		var res string
+		res, err = sendControl(args.Control.Addr, args.Control.Command)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot send control command")
+		} else {
+			fmt.Println(res)
+		}
+	case args.InstallService != nil:
+		err = installService(args.Config, args.InstallService.Schedule, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot install service")
+		}
+	case args.GUI != nil:
+		err = serveGUI(args.GUI.Port, args.GUI.Output, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot run web UI")
+		}
+	case args.Subscribe != nil:
+		err = subscribe(*args.Subscribe, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot subscribe to changes")
+		}
+	case args.Generate != nil:
+		err = generate(*args.Generate, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot generate collection")
+		}
+	case args.MockAPIC != nil:
+		err = serveMockAPIC(*args.MockAPIC, log)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot run mock APIC")
+		}
+	case args.Serve != nil:
+		err = serveAPI(*args.Serve, log)
 		if err != nil {
-			log.Error().Err(err).Msg("cannot fetch data from the API")
+			log.Error().Err(err).Msg("cannot run API server")
 		}
+	case args.VersionCmd != nil:
+		fmt.Println(args.Version())
 	}
 }
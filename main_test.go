@@ -1,28 +1,77 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
-	"time"
 
-	"github.com/brightpuddle/goaci"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
-	"gopkg.in/h2non/gock.v1"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
 )
 
+// rawFixture is the icurl script output of a small fabric, by file name.
+var rawFixture = map[string]string{
+	"fvTenant.json":  `{"totalCount":"2","imdata":[{"fvTenant":{"attributes":{"dn":"uni/tn-common","name":"common"}}},{"fvTenant":{"attributes":{"dn":"uni/tn-infra","name":"infra"}}}]}`,
+	"fvBD.json":      `{"totalCount":"1","imdata":[{"fvBD":{"attributes":{"dn":"uni/tn-common/BD-default","name":"default"}}}]}`,
+	"topSystem.json": `{"totalCount":"1","imdata":[{"topSystem":{"attributes":{"dn":"topology/pod-1/node-1/sys","name":"apic1","role":"controller","address":"10.0.0.1"}}}]}`,
+}
+
+// writeRawArchive writes a raw archive as created by the icurl script.
+func writeRawArchive(path string, files map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, body := range files {
+		fw, err := w.Create("aci-vetr-collections/" + name)
+		if err != nil {
+			return err
+		}
+		fw.Write([]byte(body))
+	}
+	return w.Close()
+}
+
+// writeRawFixture writes the raw archive of the fixture to the directory.
+func writeRawFixture(dir string) (string, error) {
+	path := filepath.Join(dir, "aci-vetr-raw.zip")
+	return path, writeRawArchive(path, rawFixture)
+}
+
+// readRawFixture reads the raw archive of the fixture into an archive.
+func readRawFixture(dir, out string, log Logger) error {
+	raw, err := writeRawFixture(dir)
+	if err != nil {
+		return err
+	}
+	return readRaw(raw, out, log)
+}
+
 func TestWriteScript(t *testing.T) {
 	a := assert.New(t)
 	log := zerolog.New(&bytes.Buffer{})
 
-	err := writeScript(log)
+	err := writeScript(ICurlCmd{}, log)
 	a.NoError(err)
 	defer os.Remove(logFile)
-	fs, err := os.Stat("vetr-collect.sh")
+	defer os.Remove("vetr-collect.sh")
+	b, err := ioutil.ReadFile("vetr-collect.sh")
 	if a.NoError(err) {
-		a.True(fs.Size() > 300)
+		a.Contains(string(b), "fetch fvTenant /api/class/fvTenant.json -d 'order-by=fvTenant.dn'")
+		a.Contains(string(b), "-d page-size=10000 -d page=$page")
+		// Counts aren't paged
+		a.Contains(string(b), "\ncount fvCEp /api/class/fvCEp.json -d 'rsp-subtree-include=count'\n")
+		a.Contains(string(b), fmt.Sprintf("classes=%d\n", len(collector.Requests())))
 	}
 }
 
@@ -30,42 +79,67 @@ func TestReadRaw(t *testing.T) {
 	a := assert.New(t)
 	log := zerolog.New(&bytes.Buffer{})
 
-	inPath := filepath.Join("testdata", "aci-vetr-raw.zip")
-	outPath := filepath.Join("testdata", "script-data.zip")
-	err := readRaw(inPath, outPath, log)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	inPath, err := writeRawFixture(dir)
+	if !a.NoError(err) {
+		return
+	}
+	outPath := filepath.Join(dir, "script-data.zip")
+	err = readRaw(inPath, outPath, log)
 	a.NoError(err)
-	defer os.Remove(outPath)
 	fs, err := os.Stat(outPath)
 	if a.NoError(err) {
 		a.True(fs.Size() > 300)
 	}
 }
 
-func TestFetch(t *testing.T) {
+func TestReadRawErrors(t *testing.T) {
 	a := assert.New(t)
-	defer gock.Off()
+	log := zerolog.New(&bytes.Buffer{})
 
-	gock.New("https://apic").
-		Get("/api/class/fvTenant.json").
-		Reply(200).
-		BodyString(goaci.Body{}.
-			Set("imdata.0.fvTenant.attributes.dn", "uni/tn-zero").
-			Set("imdata.1.fvTenant.attributes.dn", "uni/tn-one").
-			Str)
-	client, _ := goaci.NewClient("apic", "usr", "pwd")
-	client.LastRefresh = time.Now()
-	gock.InterceptClient(client.HttpClient)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
 
-	log := zerolog.New(&bytes.Buffer{})
-	reqs := []*Request{{
-		class:  "fvTenant",
-		path:   "/api/class/fvTenant",
-		filter: "#.fvTenant.attribute",
-	}}
-	results, err := fetch(client, reqs, log)
-	a.NoError(err)
-	if tenants, ok := results["fvTenant"]; ok {
-		a.Equal("uni/tn-zero", tenants.Get("0.dn").Str)
-		a.Equal("uni/tn-one", tenants.Get("1.dn").Str)
+	inPath := filepath.Join(dir, "aci-vetr-raw.zip")
+	a.NoError(writeRawArchive(inPath, map[string]string{
+		"fvTenant.json":               `{"imdata":[{"fvTenant":{"attributes":{"dn":"uni/tn-a"}}}]}`,
+		"newClass.json":               `{"imdata":[{"newClass":{"attributes":{"dn":"uni/new-1"}}}]}`,
+		"fvBD.json":                   ``,
+		"pkiExportEncryptionKey.json": `{"imdata":[{"error":{"attributes":{"code":"400","text":"Unknown class"}}}]}`,
+		"fvAEPg.0.json":               `{"totalCount":"3","imdata":[{"fvAEPg":{"attributes":{"dn":"uni/tn-a/ap-a/epg-1"}}},{"fvAEPg":{"attributes":{"dn":"uni/tn-a/ap-a/epg-2"}}}]}`,
+		"fvAEPg.1.json":               `{"totalCount":"3","imdata":[{"fvAEPg":{"attributes":{"dn":"uni/tn-a/ap-a/epg-3"}}}]}`,
+		"fvSubnet.0.json":             `{"totalCount":"3","imdata":[{"fvSubnet":{"attributes":{"dn":"uni/tn-a/BD-a/subnet-[10.0.0.1/24]"}}}]}`,
+		"fvSubnet.1.json":             `{"imdata":[{"error":{"attributes":{"code":"503","text":"Request timed out"}}}]}`,
+	}))
+
+	outPath := filepath.Join(dir, "aci-vetr-data.zip")
+	a.NoError(readRaw(inPath, outPath, log))
+	db, closeDB, err := openDB(outPath)
+	if !a.NoError(err) {
+		return
 	}
+	defer closeDB()
+	records, err := readRecords(db)
+	a.NoError(err)
+	a.Contains(records, "fvTenant:uni/tn-a")
+	a.Contains(records, "newClass:uni/new-1")
+	a.Contains(records, "fvAEPg:uni/tn-a/ap-a/epg-3")
+	a.NotContains(records, "fvSubnet:uni/tn-a/BD-a/subnet-[10.0.0.1/24]")
+	a.Len(records, 5)
+	db.View(func(tx *buntdb.Tx) error {
+		meta, err := tx.Get("meta")
+		a.NoError(err)
+		a.Equal("icurl", gjson.Get(meta, "source").Str)
+		a.Contains(gjson.Get(meta, "ingestErrors.pkiExportEncryptionKey").Str, "Unknown class")
+		a.True(gjson.Get(meta, "ingestErrors.fvBD").Exists())
+		a.Contains(gjson.Get(meta, "ingestErrors.fvSubnet").Str, "timed out")
+		return nil
+	})
 }
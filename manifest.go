@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/mholt/archiver/v3"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// Archive manifest file.
+const manifestName = "manifest.json"
+
+// manifestFile is a file in the archive.
+type manifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest lists the contents of an archive, so recipients can verify it
+// wasn't truncated or corrupted in transit.
+type manifest struct {
+	CollectorVersion string            `json:"collectorVersion"`
+	Timestamp        string            `json:"timestamp"`
+	Files            []manifestFile    `json:"files"`
+	Records          map[string]int    `json:"records"`          // Records per class
+	Errors           map[string]string `json:"errors,omitempty"` // Per-class collection errors
+}
+
+// checksum returns the SHA-256 checksum and size of a stream.
+func checksum(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	return hex.EncodeToString(h.Sum(nil)), n, err
+}
+
+// writeManifest writes the manifest for the archive members, reading those
+// in inMemory from memory, with the records per class.
+func writeManifest(members []string, inMemory map[string][]byte, counts map[string]int, meta goaci.Body) error {
+	m := manifest{
+		CollectorVersion: version,
+		Timestamp:        time.Now().Format(time.RFC3339),
+		Records:          make(map[string]int),
+		Errors:           make(map[string]string),
+	}
+	for _, member := range members {
+		f, _, err := collector.OpenMember(member, inMemory)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", member, err)
+		}
+		sum, size, err := checksum(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", member, err)
+		}
+		m.Files = append(m.Files, manifestFile{Name: filepath.Base(member), Size: size, SHA256: sum})
+	}
+	for prefix, n := range counts {
+		m.Records[prefix] = n
+	}
+	for _, field := range errorFields {
+		gjson.Get(meta.Str, field).ForEach(func(prefix, err gjson.Result) bool {
+			m.Errors[prefix.Str] = err.String()
+			return true
+		})
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode manifest: %v", err)
+	}
+	return ioutil.WriteFile(manifestName, b, 0644)
+}
+
+// verifyManifest checks the files in an archive against its manifest,
+// returning the number of files verified.
+func verifyManifest(path string) (int, error) {
+	var m *manifest
+	sums := make(map[string]manifestFile)
+	err := archiver.Walk(path, func(f archiver.File) error {
+		if f.IsDir() {
+			return nil
+		}
+		if f.Name() == manifestName {
+			m = &manifest{}
+			return json.NewDecoder(f).Decode(m)
+		}
+		sum, size, err := checksum(f)
+		if err != nil {
+			return err
+		}
+		sums[f.Name()] = manifestFile{Name: f.Name(), Size: size, SHA256: sum}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot read archive: %v", err)
+	}
+	if m == nil {
+		return 0, fmt.Errorf("%s not found in %s", manifestName, path)
+	}
+	for _, file := range m.Files {
+		actual, ok := sums[file.Name]
+		if !ok {
+			return 0, fmt.Errorf("%s is missing from the archive", file.Name)
+		}
+		if actual != file {
+			return 0, fmt.Errorf("%s does not match the manifest; the archive may be corrupt", file.Name)
+		}
+	}
+	return len(m.Files), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/mholt/archiver/v3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestManifest(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, out, log)) {
+		return
+	}
+	n, err := verifyManifest(out)
+	a.NoError(err)
+	a.Equal(1, n)
+
+	// Archive with a file that doesn't match the manifest
+	file := filepath.Join(dir, "fvTenant.json")
+	a.NoError(ioutil.WriteFile(file, []byte("[]"), 0644))
+	responses := map[string]goaci.Res{"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}]`)}
+	meta := goaci.Body{}.Set("ingestErrors.fvBD", "empty response")
+	if !a.NoError(writeManifest([]string{file}, nil, responseCounts(responses), meta)) {
+		return
+	}
+	defer os.Remove(manifestName)
+	b, err := ioutil.ReadFile(manifestName)
+	a.NoError(err)
+	a.Equal(1, int(gjson.GetBytes(b, "records.fvTenant").Int()))
+	a.Equal("empty response", gjson.GetBytes(b, "errors.fvBD").Str)
+
+	a.NoError(ioutil.WriteFile(file, []byte("[{}]"), 0644))
+	corrupt := filepath.Join(dir, "corrupt.zip")
+	a.NoError(archiver.Archive([]string{file, manifestName}, corrupt))
+	_, err = verifyManifest(corrupt)
+	a.Error(err)
+}
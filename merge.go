@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+)
+
+// collection is the records and metadata of a collection archive or db file.
+type collection struct {
+	path    string
+	meta    gjson.Result
+	records map[string]string
+}
+
+// readCollection reads all records and the metadata of a collection.
+func readCollection(path string) (collection, error) {
+	db, closeDB, err := openDB(path)
+	if err != nil {
+		return collection{}, fmt.Errorf("cannot open %s: %v", path, err)
+	}
+	defer closeDB()
+	meta, err := readMeta(db)
+	if err != nil {
+		return collection{}, fmt.Errorf("%s: %v", path, err)
+	}
+	records, err := readRecords(db)
+	if err != nil {
+		return collection{}, fmt.Errorf("cannot read records from %s: %v", path, err)
+	}
+	return collection{path: path, meta: meta, records: records}, nil
+}
+
+// responsesFrom groups records by prefix, as collected from the APIC.
+func responsesFrom(records map[string]string) (map[string]goaci.Res, error) {
+	responses := make(map[string]goaci.Res)
+	for prefix, class := range groupRecords(records) {
+		b, err := json.Marshal(class)
+		if err != nil {
+			return nil, err
+		}
+		responses[prefix] = gjson.ParseBytes(b)
+	}
+	return responses, nil
+}
+
+// collected returns the collection time from the metadata, written with
+// time.Time.String, e.g. 2024-05-01 02:00:00.123 +0000 UTC m=+1.5
+func (c collection) collected() time.Time {
+	s := c.meta.Get("timestamp").Str
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	t, _ := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+	return t
+}
+
+// mergeCollections unions the records of collections; on duplicate keys the
+// record from the newest collection wins. Collection errors are kept for the
+// classes no collection has records for.
+func mergeCollections(collections []collection) (map[string]goaci.Res, map[string]string, error) {
+	sorted := append([]collection{}, collections...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].collected().Before(sorted[j].collected())
+	})
+	records := make(map[string]string)
+	errs := make(map[string]string)
+	for _, c := range sorted {
+		for key, value := range c.records {
+			records[key] = value
+		}
+		c.meta.Get("errors").ForEach(func(prefix, err gjson.Result) bool {
+			errs[prefix.Str] = err.String()
+			return true
+		})
+	}
+
+	responses, err := responsesFrom(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	for prefix := range responses {
+		delete(errs, prefix)
+	}
+	return responses, errs, nil
+}
+
+// merge combines collections into a new archive.
+func merge(inputs []string, out string, log Logger) error {
+	var collections []collection
+	for _, input := range inputs {
+		c, err := readCollection(input)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("file", input).Int("records", len(c.records)).Msg("Read collection")
+		collections = append(collections, c)
+	}
+	responses, errs, err := mergeCollections(collections)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	meta := goaci.Body{}.
+		Set("source", "merge").
+		SetRaw("mergedFrom", string(b))
+	if len(errs) > 0 {
+		b, err := json.Marshal(errs)
+		if err != nil {
+			return err
+		}
+		meta = meta.SetRaw("errors", string(b))
+	}
+	if err := writeArchive(out, responses, meta, archiveOptions{}, log); err != nil {
+		return err
+	}
+	log.Info().Msgf("Merged %d collections into %s", len(inputs), out)
+	return nil
+}
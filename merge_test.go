@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestMerge(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	older := filepath.Join(dir, "older.zip")
+	a.NoError(writeArchive(older, map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a", "descr": "old"}, {"dn": "uni/tn-b"}]`),
+	}, goaci.Body{}.SetRaw("errors", `{"faultInst": "timeout", "fvBD": "timeout"}`), archiveOptions{}, log))
+	newer := filepath.Join(dir, "newer.zip")
+	a.NoError(writeArchive(newer, map[string]goaci.Res{
+		"fvTenant":  gjson.Parse(`[{"dn": "uni/tn-a", "descr": "new"}]`),
+		"faultInst": gjson.Parse(`[{"dn": "topology/pod-1/node-101/fault-F0001"}]`),
+	}, goaci.Body{}, archiveOptions{}, log))
+
+	// Input order doesn't matter; the newest collection wins
+	out := filepath.Join(dir, "combined.zip")
+	if !a.NoError(merge([]string{newer, older}, out, log)) {
+		return
+	}
+	c, err := readCollection(out)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(c.records, 3)
+	a.Equal("new", gjson.Get(c.records["fvTenant:uni/tn-a"], "descr").Str)
+	a.Contains(c.records, "fvTenant:uni/tn-b")
+	a.Equal("merge", c.meta.Get("source").Str)
+	a.Equal(`{"fvBD":"timeout"}`, c.meta.Get("errors").Raw)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// Filters that select the attributes of a class, e.g. #.fvBD.attributes
+var attributesFilter = regexp.MustCompile(`^#\.([\w*]+)\.attributes$`)
+
+// Digits in query values, e.g. the timestamps of event record filters.
+var digits = regexp.MustCompile(`[0-9]+`)
+
+// Filters of sharded requests, e.g. wcard(faultInst.dn,"^topology/pod-1/")
+// or not(wcard(faultInst.dn,"^topology/pod-[0-9]+/")) for the remainder.
+var shardFilter = regexp.MustCompile(`^(not\()?wcard\(\w+\.dn,"([^"]+)"\)\)?$`)
+
+// mockAPIC serves canned class responses, as an APIC would return them.
+type mockAPIC struct {
+	responses map[string]string // Raw APIC responses by prefix
+	reqs      []*collector.Request
+	usr, pwd  string // Required credentials, if any
+	token     string
+	log       Logger
+}
+
+// readMockResponses reads the raw responses of a directory of {prefix}.json
+// files, or their pages, e.g. the extracted output of the icurl script.
+func readMockResponses(dir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	responses := make(map[string]string)
+	pages := make(map[string]map[int]goaci.Res)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(file)
+		if m := pageFile.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			if pages[m[1]] == nil {
+				pages[m[1]] = make(map[int]goaci.Res)
+			}
+			pages[m[1]][n] = gjson.ParseBytes(b)
+			continue
+		}
+		responses[strings.TrimSuffix(name, ".json")] = string(b)
+	}
+	for prefix, p := range pages {
+		responses[prefix] = joinPages(p).Raw
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no responses in %s", dir)
+	}
+	return responses, nil
+}
+
+// wrapRecords rebuilds the raw APIC response of stored records; the inverse
+// of the request filter.
+func wrapRecords(records goaci.Res, req *collector.Request) string {
+	class := req.Class
+	if m := attributesFilter.FindStringSubmatch(req.Filter); m != nil && m[1] != "*" {
+		class = m[1]
+	}
+	var b strings.Builder
+	array := records.Array()
+	fmt.Fprintf(&b, `{"totalCount":"%d","imdata":[`, len(array))
+	for i, record := range array {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{%q:{"attributes":%s}}`, class, record.Raw)
+	}
+	b.WriteString("]}")
+	return b.String()
+}
+
+// mockResponsesFrom rebuilds the raw APIC responses of a collection.
+func mockResponsesFrom(path string, reqs []*collector.Request) (map[string]string, error) {
+	c, err := readCollection(path)
+	if err != nil {
+		return nil, err
+	}
+	collected, err := responsesFrom(c.records)
+	if err != nil {
+		return nil, err
+	}
+	byPrefix := make(map[string]*collector.Request)
+	for _, req := range reqs {
+		byPrefix[req.Prefix] = req
+	}
+	responses := make(map[string]string)
+	for prefix, records := range collected {
+		req, ok := byPrefix[prefix]
+		if !ok {
+			// Follow-up queries and aggregates have no request to replay
+			req = &collector.Request{Class: prefix}
+		}
+		responses[prefix] = wrapRecords(records, req)
+	}
+	return responses, nil
+}
+
+func newMockAPIC(data, usr, pwd string, log Logger) (*mockAPIC, error) {
+	reqs, err := collectRequests(upgradeReadiness)
+	if err != nil {
+		return nil, err
+	}
+	var responses map[string]string
+	if info, serr := os.Stat(data); serr == nil && info.IsDir() {
+		responses, err = readMockResponses(data)
+	} else {
+		responses, err = mockResponsesFrom(data, reqs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("cannot generate token: %v", err)
+	}
+	return &mockAPIC{
+		responses: responses,
+		reqs:      reqs,
+		usr:       usr,
+		pwd:       pwd,
+		token:     hex.EncodeToString(b),
+		log:       log,
+	}, nil
+}
+
+// matchQuery scores how closely a request's query matches a catalog
+// request's, ignoring digits, e.g. timestamps, if not an exact match.
+func matchQuery(got, want map[string][]string) int {
+	if len(got) != len(want) {
+		return -1
+	}
+	score := 0
+	for key, values := range want {
+		switch v := strings.Join(got[key], ","); {
+		case v == strings.Join(values, ","):
+			score += 2
+		case digits.ReplaceAllString(v, "") == digits.ReplaceAllString(strings.Join(values, ","), ""):
+			score++
+		default:
+			return -1
+		}
+	}
+	return score
+}
+
+// lookup returns the prefix of the response for a request.
+func (m *mockAPIC) lookup(r *http.Request) (string, bool) {
+	path := strings.TrimSuffix(r.URL.Path, ".json")
+	best, prefix := -1, ""
+	client := goaci.Client{}
+	for _, req := range m.reqs {
+		if req.Path != path {
+			continue
+		}
+		want := client.NewReq("GET", req.Path, nil, req.Mods...).HttpReq.URL.Query()
+		if score := matchQuery(r.URL.Query(), want); score > best {
+			best, prefix = score, req.Prefix
+		}
+	}
+	if _, ok := m.responses[prefix]; ok {
+		return prefix, true
+	}
+	// Classes outside the catalog, e.g. follow-up queries, by class name
+	prefix = strings.TrimPrefix(path, "/api/class/")
+	_, ok := m.responses[prefix]
+	return prefix, ok
+}
+
+func (m *mockAPIC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/aaaLogin.json":
+		m.handleLogin(w, r)
+		return
+	case "/api/aaaRefresh.json":
+		if !m.authenticated(r) {
+			m.error(w, http.StatusForbidden, "Token was invalid")
+			return
+		}
+		m.writeToken(w)
+		return
+	}
+	if !m.authenticated(r) {
+		m.error(w, http.StatusForbidden, "Token was invalid")
+		return
+	}
+	if r.Method != http.MethodGet {
+		m.error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	prefix, ok := m.lookup(r)
+	m.log.Debug().Str("url", r.URL.String()).Str("prefix", prefix).Bool("found", ok).Msg("mock request")
+	if !ok {
+		w.Write([]byte(`{"totalCount":"0","imdata":[]}`))
+		return
+	}
+	res := m.responses[prefix]
+	if f := shardFilter.FindStringSubmatch(r.URL.Query().Get("query-target-filter")); f != nil {
+		res = shardResponse(res, f[2], f[1] != "")
+	}
+	w.Write([]byte(res))
+}
+
+// shardResponse keeps the records of a response whose DN matches, or with
+// not doesn't match, the pattern of a shard.
+func shardResponse(raw, pattern string, not bool) string {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return raw
+	}
+	var records []string
+	for _, mo := range gjson.Get(raw, "imdata").Array() {
+		if re.MatchString(mo.Get("*.attributes.dn").Str) != not {
+			records = append(records, mo.Raw)
+		}
+	}
+	return fmt.Sprintf(`{"totalCount":"%d","imdata":[%s]}`, len(records), strings.Join(records, ","))
+}
+
+func (m *mockAPIC) handleLogin(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	attrs := gjson.GetBytes(b, "aaaUser.attributes")
+	if m.usr != "" && (attrs.Get("name").Str != m.usr || attrs.Get("pwd").Str != m.pwd) {
+		m.error(w, http.StatusUnauthorized, "Username or password is incorrect")
+		return
+	}
+	m.writeToken(w)
+}
+
+// writeToken sets the session cookie, as the APIC does on login and refresh.
+func (m *mockAPIC) writeToken(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "APIC-cookie", Value: m.token, Path: "/"})
+	w.Write([]byte(goaci.Body{}.
+		Set("imdata.0.aaaLogin.attributes.token", m.token).
+		Set("imdata.0.aaaLogin.attributes.refreshTimeoutSeconds", "600").
+		Str))
+}
+
+func (m *mockAPIC) authenticated(r *http.Request) bool {
+	c, err := r.Cookie("APIC-cookie")
+	return err == nil && c.Value == m.token
+}
+
+// error writes an APIC error response.
+func (m *mockAPIC) error(w http.ResponseWriter, code int, text string) {
+	w.WriteHeader(code)
+	w.Write([]byte(goaci.Body{}.
+		Set("imdata.0.error.attributes.code", fmt.Sprint(code)).
+		Set("imdata.0.error.attributes.text", text).
+		Str))
+}
+
+// selfSignedCert creates a certificate for the mock APIC, valid for a day.
+func selfSignedCert(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "aci-vetr-c mock APIC"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// serveMockAPIC serves canned responses over HTTPS until interrupted.
+func serveMockAPIC(cmd MockAPICCmd, log Logger) error {
+	m, err := newMockAPIC(cmd.Data, cmd.Username, cmd.Password, log)
+	if err != nil {
+		return err
+	}
+	var cert tls.Certificate
+	if cmd.TLSCert != "" {
+		cert, err = tls.LoadX509KeyPair(cmd.TLSCert, cmd.TLSKey)
+	} else {
+		cert, err = selfSignedCert("localhost", "127.0.0.1", "::1")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %v", err)
+	}
+	ln, err := net.Listen("tcp", cmd.Addr)
+	if err != nil {
+		return fmt.Errorf("cannot start mock APIC: %v", err)
+	}
+	srv := &http.Server{
+		Handler:   m,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	go srv.ServeTLS(ln, "", "")
+	log.Info().Int("classes", len(m.responses)).Str("data", cmd.Data).
+		Msgf("Mock APIC running at https://%s", ln.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	srv.Close()
+	log.Info().Msg("Mock APIC stopped.")
+	return nil
+}
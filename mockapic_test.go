@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestMockAPIC(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, in, log)) {
+		return
+	}
+
+	m, err := newMockAPIC(in, "admin", "secret", log)
+	if !a.NoError(err) {
+		return
+	}
+	srv := httptest.NewTLSServer(m)
+	defer srv.Close()
+
+	pool := collector.NewPool([]string{srv.URL}, "admin", "wrong", log)
+	a.Error(pool.Login())
+
+	pool = collector.NewPool([]string{srv.URL}, "admin", "secret", log)
+	if !a.NoError(pool.Login()) {
+		return
+	}
+	reqs := collector.WithDefaults([]*collector.Request{
+		{Class: "fvTenant"},
+		{Class: "topSystem"},
+		{Class: "fvCtx"},
+	})
+	responses, err := collector.Fetch(pool, reqs, collector.Limits{}, log)
+	a.NoError(err)
+	a.Len(responses["fvTenant"].Array(), 2)
+	a.Equal("uni/tn-common", responses["fvTenant"].Get("0.dn").Str)
+	a.NotEmpty(responses["topSystem"].Array())
+	a.Empty(responses["fvCtx"].Array())
+}
+
+func TestMockAPICLookup(t *testing.T) {
+	a := assert.New(t)
+	m := &mockAPIC{
+		responses: map[string]string{"epRogue": "{}", "epMove": "{}", "fvCEp": "{}", "custom": "{}"},
+		reqs:      collector.Requests(),
+	}
+	lookup := func(path string, mods ...func(*goaci.Req)) string {
+		req := goaci.Client{}.NewReq("GET", path, nil, mods...)
+		prefix, _ := m.lookup(req.HttpReq)
+		return prefix
+	}
+	// Event record filters have a timestamp, which differs between runs
+	a.Equal("epMove", lookup("/api/class/eventRecord",
+		goaci.Query("query-target-filter", `and(gt(eventRecord.created,"2020-01-01T00:00:00"),wcard(eventRecord.descr,"moved"))`)))
+	a.Equal("epRogue", lookup("/api/class/eventRecord",
+		goaci.Query("query-target-filter", `and(gt(eventRecord.created,"2020-01-01T00:00:00"),wcard(eventRecord.descr,"rogue"))`)))
+	a.Equal("fvCEp", lookup("/api/class/fvCEp", goaci.Query("rsp-subtree-include", "count")))
+	a.Equal("custom", lookup("/api/class/custom"))
+}
+
+func TestMockAPICShards(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	m := &mockAPIC{
+		responses: map[string]string{"faultInst": `{"totalCount":"3","imdata":[
+			{"faultInst":{"attributes":{"dn":"topology/pod-1/node-101/sys/fault-F0532"}}},
+			{"faultInst":{"attributes":{"dn":"topology/pod-1/node-102/sys/fault-F0532"}}},
+			{"faultInst":{"attributes":{"dn":"uni/tn-common/fault-F0956"}}}
+		]}`},
+		reqs:  collector.Requests(),
+		token: "token",
+		log:   log,
+	}
+	srv := httptest.NewTLSServer(m)
+	defer srv.Close()
+	pool := collector.NewPool([]string{srv.URL}, "admin", "", log)
+	if !a.NoError(pool.Login()) {
+		return
+	}
+
+	// Each shard gets its own records, once
+	nodes := goaci.Body{}.
+		Set("0.dn", "topology/pod-1/node-101/sys").
+		Set("1.dn", "topology/pod-1/node-102/sys").Str
+	reqs := collector.WithDefaults([]*collector.Request{{Class: "faultInst", Shard: collector.ShardNode}})
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	defer db.Close()
+	w := collector.NewWriter(db, collector.Limits{}, log)
+	defer w.Close()
+	a.NoError(collector.FetchShards(pool, reqs, map[string]goaci.Res{"topSystem": gjson.Parse(nodes)}, collector.Limits{}, w, log))
+	responses, err := collector.ReadRecords(db)
+	a.NoError(err)
+	var dns []string
+	for _, record := range responses["faultInst"].Array() {
+		dns = append(dns, record.Get("dn").Str)
+	}
+	a.ElementsMatch([]string{
+		"topology/pod-1/node-101/sys/fault-F0532",
+		"topology/pod-1/node-102/sys/fault-F0532",
+		"uni/tn-common/fault-F0956",
+	}, dns)
+	a.Empty(collector.FailedClasses(reqs))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+)
+
+// Default Nexus Dashboard login domain.
+const defaultNDDomain = "DefaultAuth"
+
+// Default path of a site's proxied APIC API on Nexus Dashboard.
+const defaultNDProxyPath = "/proxy/site/{site}"
+
+// ndLogin logs in to Nexus Dashboard, returning the session token and the
+// HTTP status of the login.
+func ndLogin(client *http.Client, base, usr, pwd, domain string) (string, int, error) {
+	if domain == "" {
+		domain = defaultNDDomain
+	}
+	b, _ := json.Marshal(map[string]string{
+		"userName":   usr,
+		"userPasswd": pwd,
+		"domain":     domain,
+	})
+	res, err := client.Post(base+"/login", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	b, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", res.StatusCode, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", res.StatusCode, fmt.Errorf("HTTP status %s", res.Status)
+	}
+	token := gjson.GetBytes(b, "jwttoken").Str
+	if token == "" {
+		return "", res.StatusCode, errors.New("no token in login response")
+	}
+	return token, res.StatusCode, nil
+}
+
+// ndGateway sends APIC API requests through the Nexus Dashboard API
+// gateway. APIC logins and refreshes become Nexus Dashboard logins, and
+// every other request goes to the site's proxy path with the Nexus
+// Dashboard token.
+type ndGateway struct {
+	base   http.RoundTripper
+	prefix string // Proxy path of the site, e.g. /proxy/site/dc1
+	domain string
+
+	mu    sync.Mutex
+	usr   string
+	pwd   string
+	token string
+}
+
+// ndGateway returns a client modifier sending the client's requests through
+// the Nexus Dashboard API gateway, if connecting to a site.
+func (c Connection) ndGateway() func(*goaci.Client) {
+	return func(client *goaci.Client) {
+		if c.NDSite == "" {
+			return
+		}
+		base := client.HttpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		path := c.NDProxyPath
+		if path == "" {
+			path = defaultNDProxyPath
+		}
+		client.HttpClient.Transport = &ndGateway{
+			base:   base,
+			prefix: strings.TrimSuffix(strings.Replace(path, "{site}", c.NDSite, -1), "/"),
+			domain: c.NDDomain,
+		}
+	}
+}
+
+func (g *ndGateway) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Path {
+	case "/api/aaaLogin.json":
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		attrs := gjson.GetBytes(b, "aaaUser.attributes")
+		g.mu.Lock()
+		g.usr, g.pwd = attrs.Get("name").Str, attrs.Get("pwd").Str
+		g.mu.Unlock()
+		return g.login(req)
+	case "/api/aaaRefresh.json":
+		// Nexus Dashboard tokens are renewed by logging in again
+		return g.login(req)
+	}
+	g.mu.Lock()
+	token := g.token
+	g.mu.Unlock()
+	req = req.Clone(req.Context())
+	req.URL.Path = g.prefix + req.URL.Path
+	req.URL.RawPath = ""
+	req.Header.Set("Authorization", "Bearer "+token)
+	return g.base.RoundTrip(req)
+}
+
+// login logs in to Nexus Dashboard, answering as the APIC would.
+func (g *ndGateway) login(req *http.Request) (*http.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	base := req.URL.Scheme + "://" + req.URL.Host
+	token, status, err := ndLogin(&http.Client{Transport: g.base}, base, g.usr, g.pwd, g.domain)
+	if err != nil && status == 0 {
+		return nil, err
+	}
+	body := goaci.Body{}.
+		Set("imdata.0.aaaLogin.attributes.token", token).Str
+	if err != nil {
+		body = goaci.Body{}.
+			Set("imdata.0.error.attributes.text", fmt.Sprintf("Nexus Dashboard login failed: %v", err)).Str
+	} else {
+		g.token = token
+		status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
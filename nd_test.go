@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestNDGateway(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	logins := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			b := new(bytes.Buffer)
+			b.ReadFrom(r.Body)
+			if gjson.Get(b.String(), "userPasswd").Str != "secret" || gjson.Get(b.String(), "domain").Str != "radius" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			w.Write([]byte(`{"jwttoken":"nd-token"}`))
+		case "/proxy/site/dc1/api/class/fvTenant.json":
+			if r.Header.Get("Authorization") != "Bearer nd-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"imdata":[{"fvTenant":{"attributes":{"dn":"uni/tn-common"}}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	conn := Connection{NDSite: "dc1", NDDomain: "radius"}
+
+	pool := collector.NewPool([]string{srv.URL}, "admin", "wrong", log, conn.clientMods("run")...)
+	a.Error(pool.Login())
+
+	pool = collector.NewPool([]string{srv.URL}, "admin", "secret", log, conn.clientMods("run")...)
+	if !a.NoError(pool.Login()) {
+		return
+	}
+	res, err := pool.Get("/api/class/fvTenant")
+	a.NoError(err)
+	a.Equal("uni/tn-common", res.Get("imdata.0.fvTenant.attributes.dn").Str)
+	a.NoError(pool.Client().Refresh())
+	a.Equal(2, logins)
+}
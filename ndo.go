@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+)
+
+// NDO API requests and the key of the records in their responses.
+var ndoRequests = []struct {
+	prefix, path, key string
+}{
+	{"ndoSites", "/api/v1/sites", "sites"},
+	{"ndoTenants", "/api/v1/tenants", "tenants"},
+	{"ndoSchemas", "/api/v1/schemas", "schemas"},
+}
+
+// ndoClient queries the Nexus Dashboard Orchestrator, formerly Multi-Site
+// Orchestrator (MSO), API.
+type ndoClient struct {
+	url    string // API base, e.g. https://nd/mso on Nexus Dashboard
+	token  string
+	client *http.Client
+}
+
+func newNDOClient(host, runID string) *ndoClient {
+	headers := http.Header{}
+	headers.Set("User-Agent", userAgent())
+	headers.Set(runIDHeader, runID)
+	base := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return &ndoClient{
+		url: strings.TrimSuffix(host, "/"),
+		client: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: headerTransport{base: base, headers: headers},
+		},
+	}
+}
+
+// do sends a request, returning the response body of a successful request.
+func (c *ndoClient) do(method, u string, body interface{}) ([]byte, int, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+	if res.StatusCode/100 != 2 {
+		return b, res.StatusCode, fmt.Errorf("HTTP status %s", res.Status)
+	}
+	return b, res.StatusCode, nil
+}
+
+// login authenticates to NDO on Nexus Dashboard or, failing that, to a
+// standalone MSO.
+func (c *ndoClient) login(usr, pwd, domain string) error {
+	token, status, err := ndLogin(c.client, c.url, usr, pwd, domain)
+	switch {
+	case err == nil:
+		c.token = token
+		c.url += "/mso"
+		return nil
+	case status != http.StatusNotFound && status != http.StatusMethodNotAllowed:
+		return err
+	}
+	b, _, err := c.do("POST", c.url+"/api/v1/auth/login", map[string]string{
+		"username": usr,
+		"password": pwd,
+	})
+	if err != nil {
+		return err
+	}
+	c.token = gjson.GetBytes(b, "token").Str
+	if c.token == "" {
+		return errors.New("no token in login response")
+	}
+	return nil
+}
+
+// get queries an API path relative to the NDO API base.
+func (c *ndoClient) get(path string) (gjson.Result, error) {
+	b, _, err := c.do("GET", c.url+path, nil)
+	if err != nil {
+		return gjson.Result{}, fmt.Errorf("cannot query %s: %v", path, err)
+	}
+	return gjson.ParseBytes(b), nil
+}
+
+// ndoTemplates flattens the templates of the schemas, adding the schema
+// they belong to.
+func ndoTemplates(schemas goaci.Res) goaci.Res {
+	var templates []string
+	for _, schema := range schemas.Array() {
+		for _, template := range schema.Get("templates").Array() {
+			templates = append(templates, goaci.Body{Str: template.Raw}.
+				Set("schemaId", schema.Get("id").Str).
+				Set("schema", schema.Get("displayName").Str).Str)
+		}
+	}
+	return gjson.Parse("[" + strings.Join(templates, ",") + "]")
+}
+
+// fetchNDO collects the sites, tenants, schemas and templates and the
+// deployment status of each schema from NDO. The collection continues
+// without the deployment status of schemas that fail.
+func fetchNDO(args CollectCmd, runID string, log Logger) (map[string]goaci.Res, []error, error) {
+	client := newNDOClient(args.NDO, runID)
+	usr, pwd := args.NDOUsername, args.NDOPassword
+	if usr == "" {
+		usr, pwd = args.Username, args.Password
+	}
+	log.Info().Str("host", args.NDO).Msg("Authenticating to NDO...")
+	if err := client.login(usr, pwd, args.NDODomain); err != nil {
+		return nil, nil, fmt.Errorf("cannot authenticate to NDO at %s: %v", args.NDO, err)
+	}
+	responses := make(map[string]goaci.Res)
+	for _, req := range ndoRequests {
+		log.Info().Str("resource", req.prefix).Msg("fetching resource...")
+		res, err := client.get(req.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		responses[req.prefix] = res.Get(req.key)
+	}
+	responses["ndoTemplates"] = ndoTemplates(responses["ndoSchemas"])
+
+	var (
+		deployments []string
+		errs        []error
+	)
+	log.Info().Str("resource", "ndoDeployments").Msg("fetching resource...")
+	for _, schema := range responses["ndoSchemas"].Array() {
+		id := schema.Get("id").Str
+		res, err := client.get("/api/v1/status/schema/" + url.PathEscape(id))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot fetch deployment status of schema %s: %v",
+				schema.Get("displayName").Str, err))
+			continue
+		}
+		deployments = append(deployments, goaci.Body{Str: res.Raw}.Set("schemaId", id).Str)
+	}
+	responses["ndoDeployments"] = gjson.Parse("[" + strings.Join(deployments, ",") + "]")
+	return responses, errs, nil
+}
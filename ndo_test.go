@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// ndoServer serves the NDO API, on Nexus Dashboard under /mso or standalone.
+func ndoServer(prefix string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case prefix == "/mso" && r.URL.Path == "/login":
+			w.Write([]byte(`{"jwttoken":"nd-token"}`))
+			return
+		case prefix == "" && r.URL.Path == "/api/v1/auth/login":
+			w.Write([]byte(`{"token":"mso-token"}`))
+			return
+		case r.Header.Get("Authorization") == "":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "/api/v1/sites":
+			w.Write([]byte(`{"sites":[{"id":"s1","name":"dc1"},{"id":"s2","name":"dc2"}]}`))
+		case "/api/v1/tenants":
+			w.Write([]byte(`{"tenants":[{"id":"t1","name":"prod"}]}`))
+		case "/api/v1/schemas":
+			w.Write([]byte(`{"schemas":[
+				{"id":"a","displayName":"app","templates":[{"name":"t1"},{"name":"t2"}]},
+				{"id":"b","displayName":"broken","templates":[]}]}`))
+		case "/api/v1/status/schema/a":
+			w.Write([]byte(`{"statuses":[{"templateName":"t1","status":"deployed"}]}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+}
+
+func TestFetchNDO(t *testing.T) {
+	for _, prefix := range []string{"/mso", ""} {
+		a := assert.New(t)
+		log := zerolog.New(&bytes.Buffer{})
+		srv := ndoServer(prefix)
+		args := CollectCmd{NDO: srv.URL}
+		args.Username = "admin"
+		responses, errs, err := fetchNDO(args, "run", log)
+		srv.Close()
+		if !a.NoError(err, prefix) {
+			continue
+		}
+		a.Len(responses["ndoSites"].Array(), 2)
+		a.Equal("prod", responses["ndoTenants"].Get("0.name").Str)
+		a.Len(responses["ndoSchemas"].Array(), 2)
+		a.Len(responses["ndoTemplates"].Array(), 2)
+		a.Equal("a", responses["ndoTemplates"].Get("1.schemaId").Str)
+		a.Equal("app", responses["ndoTemplates"].Get("1.schema").Str)
+		a.Equal("deployed", responses["ndoDeployments"].Get("0.statuses.0.status").Str)
+		a.Len(errs, 1)
+	}
+}
+
+func TestFetchNDOLoginFailure(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	_, _, err := fetchNDO(CollectCmd{NDO: srv.URL}, "run", zerolog.New(&bytes.Buffer{}))
+	a.Error(err)
+}
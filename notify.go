@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"aci-vetr-c/collector"
+)
+
+// runReport is the outcome of a collection, for notifications and the run
+// summary.
+type runReport struct {
+	id       string // Run ID sent with every request
+	apic     string
+	start    time.Time
+	reqs     []*collector.Request
+	fabric   string         // Fabric name, once the records are fetched
+	counts   map[string]int // Records per class
+	outputs  []string
+	warnings []string
+	err      error
+}
+
+// message summarizes the run for a chat channel.
+func (r runReport) message(now time.Time) string {
+	duration := now.Sub(r.start).Round(time.Second)
+	if r.err != nil {
+		return fmt.Sprintf("ACI vetR collection from %s failed after %s: %v", r.apic, duration, r.err)
+	}
+	records := 0
+	for _, n := range r.counts {
+		records += n
+	}
+	lines := []string{fmt.Sprintf(
+		"ACI vetR collection for fabric %s (%s) completed in %s: %d classes, %d records.",
+		r.fabric, r.apic, duration, len(r.counts), records)}
+	if len(r.outputs) > 0 {
+		lines = append(lines, "Output: "+strings.Join(r.outputs, ", "))
+	}
+	for _, warning := range r.warnings {
+		lines = append(lines, "Warning: "+warning)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notify sends the configured notifications for a run.
+func notify(args CollectCmd, r runReport, log Logger) {
+	if args.NotifyWebhook != "" {
+		if err := notifyWebhook(args.NotifyWebhook, r); err != nil {
+			log.Warn().Err(err).Msg("cannot send webhook notification")
+		}
+	}
+	if args.Email != nil {
+		if err := sendEmail(args.Email, r); err != nil {
+			log.Warn().Err(err).Msg("cannot send email notification")
+		}
+	}
+}
+
+// notifyWebhook posts the run summary to a Slack or Microsoft Teams incoming
+// webhook. Both accept a JSON object with a text field.
+func notifyWebhook(url string, r runReport) error {
+	body, err := json.Marshal(map[string]string{"text": r.message(time.Now())})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("HTTP status %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReportMessage(t *testing.T) {
+	a := assert.New(t)
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	r := runReport{
+		apic:     "10.0.0.1",
+		start:    start,
+		fabric:   "prod",
+		counts:   map[string]int{"topSystem": 1, "fvTenant": 2},
+		outputs:  []string{"aci-vetr-data.zip"},
+		warnings: []string{"cannot count contracts per leaf"},
+	}
+	a.Equal("ACI vetR collection for fabric prod (10.0.0.1) completed in 1m30s: 2 classes, 3 records.\n"+
+		"Output: aci-vetr-data.zip\n"+
+		"Warning: cannot count contracts per leaf",
+		r.message(start.Add(90*time.Second)))
+
+	r.err = errors.New("cannot authenticate")
+	a.Equal("ACI vetR collection from 10.0.0.1 failed after 5s: cannot authenticate",
+		r.message(start.Add(5*time.Second)))
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	a := assert.New(t)
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		text = body["text"]
+	}))
+	defer server.Close()
+
+	a.NoError(notifyWebhook(server.URL, runReport{apic: "10.0.0.1", start: time.Now(), err: errors.New("timeout")}))
+	a.Contains(text, "failed")
+	a.Contains(text, "timeout")
+
+	server.Config.Handler = http.NotFoundHandler()
+	a.Error(notifyWebhook(server.URL, runReport{start: time.Now()}))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// Output filename template variables, e.g. {fabric}_{date}.zip
+var (
+	templateVar   = regexp.MustCompile(`\{(\w+)\}`)
+	templateVars  = []string{"fabric", "apic", "date", "time"}
+	unsafeInNames = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// isTemplate reports whether an output path contains template variables.
+func isTemplate(path string) bool {
+	return templateVar.MatchString(path)
+}
+
+// validateTemplate checks an output path for unknown template variables.
+func validateTemplate(path string) error {
+	for _, match := range templateVar.FindAllStringSubmatch(path, -1) {
+		known := false
+		for _, v := range templateVars {
+			if match[1] == v {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown output variable %s, expected one of {%s}",
+				match[0], strings.Join(templateVars, "}, {"))
+		}
+	}
+	return nil
+}
+
+// fabricName returns the fabric name from the collected devices.
+func fabricName(responses map[string]goaci.Res) string {
+	for _, device := range responses["topSystem"].Array() {
+		if name := device.Get("fabricDomain").Str; name != "" {
+			return name
+		}
+	}
+	return "fabric"
+}
+
+// expandOutput replaces the template variables in an output path. Values
+// are made safe for use in a filename.
+func expandOutput(path, apic string, responses map[string]goaci.Res, t time.Time) string {
+	if !isTemplate(path) {
+		return path
+	}
+	safe := func(s string) string { return unsafeInNames.ReplaceAllString(s, "-") }
+	return strings.NewReplacer(
+		"{fabric}", safe(fabricName(responses)),
+		"{apic}", safe(hostname(apic)),
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+	).Replace(path)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestExpandOutput(t *testing.T) {
+	a := assert.New(t)
+	ts := time.Date(2024, 5, 1, 2, 3, 4, 0, time.UTC)
+	responses := map[string]goaci.Res{
+		"topSystem": gjson.Parse(`[{"dn": "topology/pod-1/node-1", "fabricDomain": "prod fabric"}]`),
+	}
+	a.Equal("prod-fabric_2024-05-01.zip",
+		expandOutput("{fabric}_{date}.zip", "https://10.0.0.1", responses, ts))
+	a.Equal("out/10.0.0.1_020304.zip",
+		expandOutput("out/{apic}_{time}.zip", "https://10.0.0.1:443", responses, ts))
+	a.Equal("fabric.zip", expandOutput("{fabric}.zip", "apic", nil, ts))
+	a.Equal("aci-vetr-data.zip", expandOutput("aci-vetr-data.zip", "apic", responses, ts))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(validateTemplate("aci-vetr-data.zip"))
+	a.NoError(validateTemplate("{fabric}_{apic}_{date}_{time}.zip"))
+	a.Error(validateTemplate("{site}.zip"))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// NDJSON payload file.
+const ndjsonName = "records.ndjson"
+
+// payload writes an additional file format to include in the archive,
+// returning the names of the files written.
+type payload func(responses map[string]goaci.Res) ([]string, error)
+
+// payloads returns the additional payloads selected for a collection.
+func payloads(args CollectCmd) []payload {
+	var p []payload
+	if args.NDJSON {
+		p = append(p, writeNDJSON)
+	}
+	if len(args.CSV) > 0 {
+		p = append(p, csvPayload(args.CSV))
+	}
+	if args.Parquet {
+		p = append(p, writeParquet)
+	}
+	return p
+}
+
+// sortedPrefixes returns the prefixes of the responses in sorted order.
+func sortedPrefixes(responses map[string]goaci.Res) []string {
+	var prefixes []string
+	for prefix := range responses {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// ndjsonRecord is a single line of the NDJSON payload.
+type ndjsonRecord struct {
+	Class      string          `json:"class"` // DB prefix
+	Dn         string          `json:"dn"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+// writeNDJSON writes all records as newline-delimited JSON, one record per
+// line, for bulk loading into Elasticsearch, Splunk, etc.
+func writeNDJSON(responses map[string]goaci.Res) ([]string, error) {
+	f, err := os.Create(ndjsonName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s: %v", ndjsonName, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, prefix := range sortedPrefixes(responses) {
+		for _, record := range responses[prefix].Array() {
+			if err := enc.Encode(ndjsonRecord{
+				Class:      prefix,
+				Dn:         record.Get("dn").Str,
+				Attributes: json.RawMessage(record.Raw),
+			}); err != nil {
+				return nil, fmt.Errorf("cannot write %s: %v", ndjsonName, err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot write %s: %v", ndjsonName, err)
+	}
+	return []string{ndjsonName}, nil
+}
+
+// recordColumns returns the attributes of the records, dn first and the
+// rest in sorted order.
+func recordColumns(res goaci.Res) []string {
+	seen := map[string]bool{"dn": true}
+	var attrs []string
+	for _, record := range res.Array() {
+		record.ForEach(func(key, _ gjson.Result) bool {
+			if !seen[key.Str] {
+				seen[key.Str] = true
+				attrs = append(attrs, key.Str)
+			}
+			return true
+		})
+	}
+	sort.Strings(attrs)
+	return append([]string{"dn"}, attrs...)
+}
+
+// writeCSV writes the attributes of a class as a CSV file, one row per record.
+func writeCSV(name string, res goaci.Res) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %v", name, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	columns := recordColumns(res)
+	w.Write(columns)
+	for _, record := range res.Array() {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = record.Get(column).String()
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("cannot write %s: %v", name, err)
+	}
+	return nil
+}
+
+// csvPayload writes a CSV file for each of the classes, e.g. fabricNode.csv,
+// for review in a spreadsheet.
+func csvPayload(classes []string) payload {
+	return func(responses map[string]goaci.Res) ([]string, error) {
+		var files []string
+		for _, class := range classes {
+			res, ok := responses[class]
+			if !ok {
+				continue
+			}
+			name := class + ".csv"
+			files = append(files, name)
+			if err := writeCSV(name, res); err != nil {
+				return files, err
+			}
+		}
+		return files, nil
+	}
+}
+
+// writeParquetFile writes the attributes of a class as a Parquet file, with a
+// string column per attribute.
+func writeParquetFile(name string, res goaci.Res) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %v", name, err)
+	}
+	defer f.Close()
+	columns := recordColumns(res)
+	var schema []string
+	for _, column := range columns {
+		schema = append(schema, fmt.Sprintf("name=%s, type=UTF8", column))
+	}
+	pw, err := writer.NewCSVWriterFromWriter(schema, f, 1)
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %v", name, err)
+	}
+	for _, record := range res.Array() {
+		row := make([]*string, len(columns))
+		for i, column := range columns {
+			if value := record.Get(column); value.Exists() {
+				s := value.String()
+				row[i] = &s
+			}
+		}
+		if err := pw.WriteString(row); err != nil {
+			return fmt.Errorf("cannot write %s: %v", name, err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("cannot write %s: %v", name, err)
+	}
+	return nil
+}
+
+// writeParquet writes a Parquet file for each class, e.g. fvBD.parquet, for
+// loading into a data lake.
+func writeParquet(responses map[string]goaci.Res) ([]string, error) {
+	var files []string
+	for _, prefix := range sortedPrefixes(responses) {
+		name := prefix + ".parquet"
+		files = append(files, name)
+		if err := writeParquetFile(name, responses[prefix]); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
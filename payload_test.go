@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestWriteNDJSON(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a", "name": "a"}, {"dn": "uni/tn-b", "name": "b"}]`),
+		"fvBD":     gjson.Parse(`[{"dn": "uni/tn-a/BD-c", "name": "c"}]`),
+	}
+	files, err := writeNDJSON(responses)
+	defer os.Remove(ndjsonName)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]string{ndjsonName}, files)
+
+	f, err := os.Open(ndjsonName)
+	if !a.NoError(err) {
+		return
+	}
+	defer f.Close()
+	var lines []gjson.Result
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, gjson.Parse(scanner.Text()))
+	}
+	if a.Len(lines, 3) {
+		a.Equal("fvBD", lines[0].Get("class").Str)
+		a.Equal("uni/tn-a/BD-c", lines[0].Get("dn").Str)
+		a.Equal("c", lines[0].Get("attributes.name").Str)
+		a.Equal("fvTenant", lines[2].Get("class").Str)
+	}
+}
+
+func TestCSVPayload(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fabricNode": gjson.Parse(`[
+			{"dn": "topology/pod-1/node-101", "name": "leaf101", "role": "leaf"},
+			{"dn": "topology/pod-1/node-1", "name": "apic1", "model": "APIC-SERVER-M2"}
+		]`),
+	}
+	files, err := csvPayload([]string{"fabricNode", "faultInst"})(responses)
+	for _, file := range files {
+		defer os.Remove(file)
+	}
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]string{"fabricNode.csv"}, files)
+
+	f, err := os.Open("fabricNode.csv")
+	if !a.NoError(err) {
+		return
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	a.NoError(err)
+	a.Equal([][]string{
+		{"dn", "model", "name", "role"},
+		{"topology/pod-1/node-101", "", "leaf101", "leaf"},
+		{"topology/pod-1/node-1", "APIC-SERVER-M2", "apic1", ""},
+	}, rows)
+}
+
+func TestPayloads(t *testing.T) {
+	a := assert.New(t)
+	a.Len(payloads(CollectCmd{}), 0)
+	a.Len(payloads(CollectCmd{NDJSON: true}), 1)
+	a.Len(payloads(CollectCmd{NDJSON: true, CSV: []string{"fabricNode"}}), 2)
+}
+
+func TestWriteParquet(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fabricNode": gjson.Parse(`[
+			{"dn": "topology/pod-1/node-101", "name": "leaf101", "role": "leaf"},
+			{"dn": "topology/pod-1/node-1", "name": "apic1", "model": "APIC-SERVER-M2"}
+		]`),
+	}
+	files, err := writeParquet(responses)
+	for _, file := range files {
+		defer os.Remove(file)
+	}
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]string{"fabricNode.parquet"}, files)
+
+	pf, err := local.NewLocalFileReader("fabricNode.parquet")
+	if !a.NoError(err) {
+		return
+	}
+	defer pf.Close()
+	pr, err := reader.NewParquetColumnReader(pf, 1)
+	if !a.NoError(err) {
+		return
+	}
+	defer pr.ReadStop()
+	a.Equal(int64(2), pr.GetNumRows())
+	values, _, _, err := pr.ReadColumnByPath("parquet_go_root.name", 2)
+	a.NoError(err)
+	a.Equal([]interface{}{"leaf101", "apic1"}, values)
+}
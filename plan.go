@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// Relative APIC cost of returning one object of a class.
+// Classes not listed have a cost of 1. Record and stats classes are served
+// from the APIC's history store and are considerably more expensive to query.
+var queryCost = map[string]float64{
+	"faultInst":   2,
+	"faultRecord": 4,
+	"eventRecord": 4,
+	"aaaModLR":    4,
+	"fvRsPathAtt": 2,
+	"fvCEp":       2,
+	"fvIp":        2,
+	"topSystem":   1.5,
+}
+
+const (
+	requestOverhead = 500 * time.Millisecond // Fixed cost per request
+	objectsPerSec   = 2000                   // APIC throughput for cost 1 objects
+)
+
+// planItem is the estimated impact of a single request.
+type planItem struct {
+	req     *collector.Request
+	url     string
+	objects int
+	score   float64
+	elapsed time.Duration
+}
+
+// requestURL is the full URL for a request, including query parameters.
+func requestURL(client goaci.Client, req *collector.Request) string {
+	r := client.NewReq("GET", req.Path, nil, req.Mods...)
+	return r.HttpReq.URL.String()
+}
+
+// isCount reports whether the request only returns object counts.
+func isCount(req *collector.Request) bool {
+	return strings.HasPrefix(req.Filter, "#.moCount.")
+}
+
+// estimate scores a request from the number of objects it will return.
+func estimate(req *collector.Request, objects int) (float64, time.Duration) {
+	cost, ok := queryCost[req.Class]
+	if !ok {
+		cost = 1
+	}
+	if isCount(req) {
+		// Count queries are resolved in the APIC without serializing objects
+		cost = cost / 10
+	}
+	score := float64(objects) * cost
+	elapsed := requestOverhead + time.Duration(score/objectsPerSec*float64(time.Second))
+	return score, elapsed
+}
+
+// countObjects queries the number of objects a request will return.
+func countObjects(client collector.Getter, req *collector.Request) (int, error) {
+	mods := append([]collector.Mod{}, req.Mods...)
+	if !isCount(req) {
+		// Replacing any rsp-subtree-include of the request, e.g. health
+		mods = append(mods, func(r *goaci.Req) {
+			q := r.HttpReq.URL.Query()
+			q.Set("rsp-subtree-include", "count")
+			r.HttpReq.URL.RawQuery = q.Encode()
+		})
+	}
+	res, err := client.Get(req.Path, mods...)
+	if err != nil {
+		return 0, err
+	}
+	count := res.Get("imdata.0.moCount.attributes.count").Str
+	if count == "" {
+		return 0, fmt.Errorf("no count returned for %s", req.Path)
+	}
+	return strconv.Atoi(count)
+}
+
+// plan estimates the impact of each request on the APIC.
+func plan(client collector.Getter, reqs []*collector.Request, log Logger) []planItem {
+	var items []planItem
+	urlClient := goaci.Client{}
+	for _, req := range reqs {
+		objects, err := countObjects(client, req)
+		if err != nil {
+			log.Warn().Err(err).Str("resource", req.Prefix).Msg("cannot count objects")
+		}
+		score, elapsed := estimate(req, objects)
+		items = append(items, planItem{
+			req:     req,
+			url:     requestURL(urlClient, req),
+			objects: objects,
+			score:   score,
+			elapsed: elapsed,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].score > items[j].score
+	})
+	return items
+}
+
+// printPlan writes the plan as a table. Requests run concurrently, so the
+// expected runtime is that of the most expensive request.
+func printPlan(items []planItem) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tOBJECTS\tSCORE\tEST. TIME\tURL")
+	var (
+		total   float64
+		runtime time.Duration
+	)
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%s\t%s\n",
+			item.req.Prefix,
+			item.objects,
+			item.score,
+			item.elapsed.Round(100*time.Millisecond),
+			item.url,
+		)
+		total += item.score
+		if item.elapsed > runtime {
+			runtime = item.elapsed
+		}
+	}
+	w.Flush()
+	fmt.Println(strings.Repeat("=", 30))
+	fmt.Printf("Requests: %d\n", len(items))
+	fmt.Printf("Total load score: %.0f\n", total)
+	fmt.Printf("Expected runtime: %s\n", runtime.Round(time.Second))
+}
+
+// dryRun reports the requests that would be made and their expected impact
+// without collecting any data. The tenant subtrees and shards are planned
+// with the tenants and nodes, which are fetched.
+func dryRun(args CollectCmd, log Logger) error {
+	var failed []string
+	if args.OnlyFailed {
+		var err error
+		if _, failed, err = readPrevious(args.DB); err != nil {
+			return err
+		}
+	}
+	hosts := splitHosts(args.APIC)
+	runID := newRunID()
+	pool := collector.NewPool(hosts, args.Username, args.Password, log, args.Connection.clientMods(runID)...)
+	log.Info().Str("run_id", runID).Str("user_agent", userAgent()).Msg("Dry run")
+	log.Info().Msg("Authenticating to the APIC...")
+	if err := pool.Login(); err != nil {
+		return fmt.Errorf("cannot authenticate to the APIC at %s: %v", args.APIC, err)
+	}
+	if err := verifyActive(pool, log); err != nil {
+		return err
+	}
+	set, err := buildRequests(pool, args, failed, log)
+	if err != nil {
+		return err
+	}
+	reqs := set.fetch
+	if len(set.tenant) > 0 || len(set.shard) > 0 {
+		var scopes []*collector.Request
+		for _, req := range set.fetch {
+			if req.Prefix == "fvTenant" || req.Prefix == "topSystem" {
+				scopes = append(scopes, req)
+			}
+		}
+		log.Info().Msg("Fetching tenants and nodes...")
+		responses, _ := collector.Fetch(pool, scopes, collector.Limits{Requests: args.MaxRequests}, log)
+		if tenants, ok := responses["fvTenant"]; ok {
+			reqs = append(reqs, collector.TenantSubtrees(set.tenant, tenants)...)
+		} else {
+			reqs = append(reqs, collector.ForTenants(set.tenant, args.Tenant)...)
+		}
+		reqs = append(reqs, collector.Shards(set.shard, responses)...)
+	}
+	log.Info().Msg("Counting objects...")
+	printPlan(plan(pool, reqs, log))
+	return nil
+}
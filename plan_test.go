@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gopkg.in/h2non/gock.v1"
+
+	"aci-vetr-c/collector"
+)
+
+func TestEstimate(t *testing.T) {
+	a := assert.New(t)
+
+	score, elapsed := estimate(&collector.Request{Class: "fvTenant"}, 4000)
+	a.Equal(4000.0, score)
+	a.Equal(requestOverhead+2*time.Second, elapsed)
+
+	score, _ = estimate(&collector.Request{Class: "faultInst"}, 4000)
+	a.Equal(8000.0, score)
+
+	score, _ = estimate(&collector.Request{Class: "fvCEp", Filter: "#.moCount.attributes"}, 4000)
+	a.Equal(800.0, score)
+}
+
+func TestPlan(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		MatchParam("rsp-subtree-include", "count").
+		Reply(200).
+		BodyString(goaci.Body{}.
+			Set("imdata.0.moCount.attributes.count", "3").
+			Str)
+	gock.New("https://apic").
+		Get("/api/class/faultInst.json").
+		MatchParam("rsp-subtree-include", "count").
+		Reply(200).
+		BodyString(goaci.Body{}.
+			Set("imdata.0.moCount.attributes.count", "10").
+			Str)
+	client, _ := goaci.NewClient("apic", "usr", "pwd")
+	client.LastRefresh = time.Now()
+	gock.InterceptClient(client.HttpClient)
+
+	log := zerolog.New(&bytes.Buffer{})
+	reqs := []*collector.Request{
+		{Class: "fvTenant", Prefix: "fvTenant", Path: "/api/class/fvTenant"},
+		{Class: "faultInst", Prefix: "faultInst", Path: "/api/class/faultInst"},
+	}
+	items := plan(&client, reqs, log)
+	if a.Len(items, 2) {
+		a.Equal("faultInst", items[0].req.Prefix)
+		a.Equal(10, items[0].objects)
+		a.Equal(3, items[1].objects)
+	}
+}
+
+// urlGetter records the URL of the last request.
+type urlGetter struct {
+	url *string
+}
+
+func (g urlGetter) Get(path string, mods ...collector.Mod) (gjson.Result, error) {
+	*g.url = requestURL(goaci.Client{}, &collector.Request{Path: path, Mods: mods})
+	return gjson.Parse(`{"imdata": [{"moCount": {"attributes": {"count": "5"}}}]}`), nil
+}
+
+func TestCountObjects(t *testing.T) {
+	a := assert.New(t)
+	var url string
+	req := &collector.Request{
+		Path: "/api/class/topSystem",
+		Mods: []collector.Mod{goaci.Query("rsp-subtree-include", "health,no-scoped")},
+	}
+	n, err := countObjects(urlGetter{&url}, req)
+	a.NoError(err)
+	a.Equal(5, n)
+	a.Equal("/api/class/topSystem.json?rsp-subtree-include=count", strings.TrimPrefix(url, "https://"))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Postman collection format, also imported by Insomnia.
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Login test script, keeping the session token for the other requests.
+const postmanLoginScript = `pm.collectionVariables.set("token", pm.response.json().imdata[0].aaaLogin.attributes.token);`
+
+// postmanCollection is a Postman collection, v2.1.
+type postmanCollection struct {
+	Info struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Schema      string `json:"schema"`
+	} `json:"info"`
+	Variable []postmanValue `json:"variable"`
+	Item     []postmanItem  `json:"item"`
+}
+
+// postmanValue is a variable, header or query parameter.
+type postmanValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Event   []postmanEvent `json:"event,omitempty"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanEvent struct {
+	Listen string `json:"listen"`
+	Script struct {
+		Type string   `json:"type"`
+		Exec []string `json:"exec"`
+	} `json:"script"`
+}
+
+type postmanRequest struct {
+	Method string         `json:"method"`
+	Header []postmanValue `json:"header"`
+	Body   *postmanBody   `json:"body,omitempty"`
+	URL    postmanURL     `json:"url"`
+}
+
+type postmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+type postmanURL struct {
+	Raw      string         `json:"raw"`
+	Protocol string         `json:"protocol"`
+	Host     []string       `json:"host"`
+	Path     []string       `json:"path"`
+	Query    []postmanValue `json:"query,omitempty"`
+}
+
+// newPostmanURL returns the URL of an APIC API path and query parameters.
+func newPostmanURL(path string, query []postmanValue) postmanURL {
+	raw := "https://{{apic}}" + path
+	var params []string
+	for _, q := range query {
+		params = append(params, q.Key+"="+q.Value)
+	}
+	if len(params) > 0 {
+		raw += "?" + strings.Join(params, "&")
+	}
+	return postmanURL{
+		Raw:      raw,
+		Protocol: "https",
+		Host:     []string{"{{apic}}"},
+		Path:     strings.Split(strings.TrimPrefix(path, "/"), "/"),
+		Query:    query,
+	}
+}
+
+// postmanScript returns a Postman collection of the requests, for checking
+// individual classes by hand. Logging in sets the token variable, which can
+// also be set by hand, e.g. in Insomnia. Paged classes fetch the first page.
+func postmanScript(pageSize int) (string, error) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	c := postmanCollection{
+		Variable: []postmanValue{
+			{Key: "apic", Value: ""},
+			{Key: "username", Value: "admin"},
+			{Key: "password", Value: ""},
+			{Key: "token", Value: ""},
+		},
+	}
+	c.Info.Name = "ACI vetR collector"
+	c.Info.Description = "Requests of the ACI vetR collector. Set the apic, username and password variables and send Login first."
+	c.Info.Schema = postmanSchema
+
+	login := postmanItem{
+		Name: "Login",
+		Request: postmanRequest{
+			Method: "POST",
+			Header: []postmanValue{{Key: "Content-Type", Value: "application/json"}},
+			Body: &postmanBody{
+				Mode: "raw",
+				Raw:  `{"aaaUser":{"attributes":{"name":"{{username}}","pwd":"{{password}}"}}}`,
+			},
+			URL: newPostmanURL("/api/aaaLogin.json", nil),
+		},
+	}
+	event := postmanEvent{Listen: "test"}
+	event.Script.Type = "text/javascript"
+	event.Script.Exec = []string{postmanLoginScript}
+	login.Event = []postmanEvent{event}
+	c.Item = append(c.Item, login)
+
+	for _, req := range scriptRequests() {
+		var query []postmanValue
+		for key, values := range req.query {
+			for _, value := range values {
+				query = append(query, postmanValue{Key: key, Value: value})
+			}
+		}
+		sort.Slice(query, func(i, j int) bool { return query[i].Key < query[j].Key })
+		if req.fn == "fetch" {
+			query = append(query,
+				postmanValue{Key: "page-size", Value: strconv.Itoa(pageSize)},
+				postmanValue{Key: "page", Value: "0"})
+		}
+		c.Item = append(c.Item, postmanItem{
+			Name: req.prefix,
+			Request: postmanRequest{
+				Method: "GET",
+				Header: []postmanValue{{Key: "Cookie", Value: "APIC-cookie={{token}}"}},
+				URL:    newPostmanURL(req.path, query),
+			},
+		})
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
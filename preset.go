@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// Preset collecting the data needed for pre-upgrade checks.
+const upgradeReadiness = "upgrade-readiness"
+
+// presetRequests returns the requests a preset adds to the default set.
+func presetRequests(preset string) ([]*collector.Request, error) {
+	switch preset {
+	case "":
+		return nil, nil
+	case upgradeReadiness:
+		return collector.WithDefaults([]*collector.Request{
+			// Maintenance groups
+			{Class: "maintMaintGrp"}, // Maintenance group
+			{Class: "maintMaintP"},   // Maintenance policy
+			{Class: "maintRsMgrpp"},  // Maintenance group --> policy
+			{Class: "maintUpgJob"},   // Upgrade job status
+
+			// Firmware
+			{Class: "firmwareCtrlrFwP"}, // Controller firmware policy
+			{Class: "firmwareFwP"},      // Switch firmware policy
+			{Class: "firmwareFirmware"}, // Images in the firmware repository
+
+			// APIC cluster
+			{Class: "infraCont"}, // Cluster size
+
+			// Hardware
+			{Class: "eqptCh"},   // Chassis
+			{Class: "eqptLC"},   // Line cards
+			{Class: "eqptFC"},   // Fabric cards
+			{Class: "eqptSupC"}, // Supervisors
+
+			// Backups
+			{Class: "configExportP"}, // Config export policy
+			{Class: "configJob"},     // Config export and import jobs
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown preset %q, expected %s", preset, upgradeReadiness)
+	}
+}
+
+// collectRequests returns the default requests plus those of the preset and
+// the registered plugins.
+func collectRequests(preset string) ([]*collector.Request, error) {
+	extra, err := presetRequests(preset)
+	if err != nil {
+		return nil, err
+	}
+	reqs := collector.Requests()
+	seen := make(map[string]bool)
+	for _, req := range reqs {
+		seen[req.Prefix] = true
+	}
+	for _, req := range extra {
+		if !seen[req.Prefix] {
+			reqs = append(reqs, req)
+		}
+	}
+	return append(reqs, collector.PluginRequests(reqs)...), nil
+}
+
+// Default window of the record history, without --history.
+const defaultHistory = "7d"
+
+// historyWindow returns the window of the record history, from --history.
+func historyWindow(args CollectCmd) (time.Duration, error) {
+	history := args.History
+	if history == "" {
+		history = defaultHistory
+	}
+	return parseWindow(history)
+}
+
+// historyRequests returns the requests for the fault, event and audit
+// records of the history window, as selected by --history, --events and
+// --audit-log.
+func historyRequests(args CollectCmd) ([]*collector.Request, error) {
+	window, err := historyWindow(args)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []*collector.Request
+	if args.History != "" {
+		reqs = append(reqs, collector.FaultHistory(window))
+	}
+	if args.Events {
+		reqs = append(reqs, collector.EventHistory(window))
+	}
+	if args.AuditLog {
+		reqs = append(reqs, collector.AuditHistory(window))
+	}
+	return reqs, nil
+}
+
+// fabricRequests returns the requests for the optional fabric data selected
+// by flags, e.g. the endpoint tables with --endpoints.
+func fabricRequests(args CollectCmd) []*collector.Request {
+	var reqs []*collector.Request
+	if args.Endpoints {
+		reqs = append(reqs, collector.EndpointRequests()...)
+	}
+	if args.Coop {
+		reqs = append(reqs, collector.CoopRequest())
+	}
+	if args.Adjacencies {
+		reqs = append(reqs, collector.AdjacencyRequests()...)
+	}
+	return reqs
+}
+
+// fabricFlags returns the flags set for the fabric tables, which Cloud APIC
+// doesn't have.
+func fabricFlags(args CollectCmd) []string {
+	var flags []string
+	if args.Endpoints {
+		flags = append(flags, "--endpoints")
+	}
+	if args.Coop {
+		flags = append(flags, "--coop")
+	}
+	if args.Adjacencies {
+		flags = append(flags, "--adjacencies")
+	}
+	return flags
+}
+
+// maintGroup is a maintenance group and the number of nodes in it.
+type maintGroup struct {
+	Name  string `json:"name"`
+	Nodes int    `json:"nodes"`
+}
+
+// readinessSummary is the upgrade readiness section of the summary.
+type readinessSummary struct {
+	Faults             map[string]int `json:"faults"`             // By severity
+	ControllerVersions map[string]int `json:"controllerVersions"` // Controllers per version
+	SwitchVersions     map[string]int `json:"switchVersions"`     // Switches per version
+	ClusterHealth      map[string]int `json:"clusterHealth"`      // Controllers per health state
+	MaintenanceGroups  []maintGroup   `json:"maintenanceGroups"`
+	HardwareModels     map[string]int `json:"hardwareModels"`   // Nodes, line cards, etc. per model
+	Capacity           map[string]int `json:"capacity"`         // Highest switch usage per resource, in percent
+	FirstGenHardware   map[string]int `json:"firstGenHardware"` // First generation models, unsupported from ACI 5.0
+}
+
+// Usage and capacity attributes of the switch capacity classes, per resource.
+var capacityStats = map[string][3]string{
+	"tcam":      {"eqptcapacityPolUsage5min", "polUsageCum", "polUsageCapCum"},
+	"vlan":      {"eqptcapacityVlanUsage5min", "totalCum", "totalCapCum"},
+	"l2":        {"eqptcapacityL2Usage5min", "localEpCum", "localEpCapCum"},
+	"l3":        {"eqptcapacityL3Usage5min", "localEpCum", "localEpCapCum"},
+	"multicast": {"eqptcapacityMcastUsage5min", "localEpCum", "localEpCapCum"},
+}
+
+// First generation Nexus 9000 switches and modules, which ACI 5.0 and later
+// don't support.
+var firstGenModels = map[string]bool{
+	"N9K-C9332PQ":   true,
+	"N9K-C9336PQ":   true,
+	"N9K-C9372PX":   true,
+	"N9K-C9372PX-E": true,
+	"N9K-C9372TX":   true,
+	"N9K-C9372TX-E": true,
+	"N9K-C9396PX":   true,
+	"N9K-C9396TX":   true,
+	"N9K-C93120TX":  true,
+	"N9K-C93128TX":  true,
+	"N9K-X9736PQ":   true,
+}
+
+// capacityUsage returns the highest usage of each resource across the
+// switches, in percent of the capacity.
+func capacityUsage(responses map[string]goaci.Res) map[string]int {
+	usage := make(map[string]int)
+	for resource, stat := range capacityStats {
+		for _, record := range responses[stat[0]].Array() {
+			used, capacity := record.Get(stat[1]).Float(), record.Get(stat[2]).Float()
+			if capacity <= 0 {
+				continue
+			}
+			pct := int(used * 100 / capacity)
+			if max, ok := usage[resource]; !ok || pct > max {
+				usage[resource] = pct
+			}
+		}
+	}
+	return usage
+}
+
+// countBy counts records by the value of an attribute.
+func countBy(res goaci.Res, attr string) map[string]int {
+	counts := make(map[string]int)
+	for _, record := range res.Array() {
+		if value := record.Get(attr).Str; value != "" {
+			counts[value]++
+		}
+	}
+	return counts
+}
+
+// maintGroups counts nodes per maintenance group from the node blocks, e.g.
+// uni/fabric/maintgrp-even/nodeblk-blk101-101
+func maintGroups(groups, blocks goaci.Res) []maintGroup {
+	nodes := make(map[string]int)
+	for _, block := range blocks.Array() {
+		dn := block.Get("dn").Str
+		if !strings.Contains(dn, "/maintgrp-") {
+			continue
+		}
+		var from, to int
+		fmt.Sscan(block.Get("from_").Str, &from)
+		fmt.Sscan(block.Get("to_").Str, &to)
+		if to >= from {
+			nodes[relationParent(dn)] += to - from + 1
+		}
+	}
+	var result []maintGroup
+	for _, group := range groups.Array() {
+		result = append(result, maintGroup{
+			Name:  group.Get("name").Str,
+			Nodes: nodes[group.Get("dn").Str],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// upgradeReadinessSummary summarizes the data relevant to pre-upgrade checks.
+func upgradeReadinessSummary(responses map[string]goaci.Res) readinessSummary {
+	hardware := countBy(responses["fabricNode"], "model")
+	for _, class := range []string{"eqptLC", "eqptFC", "eqptSupC"} {
+		for model, n := range countBy(responses[class], "model") {
+			hardware[model] += n
+		}
+	}
+	firstGen := make(map[string]int)
+	for model, n := range hardware {
+		if firstGenModels[model] {
+			firstGen[model] = n
+		}
+	}
+	return readinessSummary{
+		Faults:             countBy(responses["faultInst"], "severity"),
+		ControllerVersions: countBy(responses["firmwareCtrlrRunning"], "version"),
+		SwitchVersions:     countBy(responses["firmwareRunning"], "version"),
+		ClusterHealth:      countBy(responses["infraWiNode"], "health"),
+		MaintenanceGroups:  maintGroups(responses["maintMaintGrp"], responses["fabricNodeBlk"]),
+		HardwareModels:     hardware,
+		Capacity:           capacityUsage(responses),
+		FirstGenHardware:   firstGen,
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestCollectRequests(t *testing.T) {
+	a := assert.New(t)
+
+	reqs, err := collectRequests("")
+	a.NoError(err)
+	a.Len(reqs, len(collector.Requests()))
+
+	reqs, err = collectRequests(upgradeReadiness)
+	a.NoError(err)
+	prefixes := make(map[string]int)
+	for _, req := range reqs {
+		prefixes[req.Prefix]++
+	}
+	a.Equal(1, prefixes["maintMaintGrp"])
+	a.Equal(1, prefixes["faultInst"])
+	for _, req := range reqs {
+		if req.Prefix == "maintMaintGrp" {
+			a.Equal("/api/class/maintMaintGrp", req.Path)
+			a.Equal("#.maintMaintGrp.attributes", req.Filter)
+		}
+	}
+
+	_, err = collectRequests("unknown")
+	a.Error(err)
+}
+
+func TestHistoryRequests(t *testing.T) {
+	a := assert.New(t)
+	prefixes := func(args CollectCmd) []string {
+		reqs, err := historyRequests(args)
+		a.NoError(err)
+		var prefixes []string
+		for _, req := range reqs {
+			prefixes = append(prefixes, req.Prefix)
+		}
+		return prefixes
+	}
+	a.Empty(prefixes(CollectCmd{}))
+	a.Equal([]string{"faultRecord"}, prefixes(CollectCmd{History: "1d"}))
+	a.Equal([]string{"eventRecord"}, prefixes(CollectCmd{Events: true}))
+	a.Equal([]string{"faultRecord", "eventRecord"}, prefixes(CollectCmd{History: "12h", Events: true}))
+	a.Equal([]string{"aaaModLR"}, prefixes(CollectCmd{AuditLog: true}))
+
+	_, err := historyRequests(CollectCmd{History: "week"})
+	a.Error(err)
+}
+
+func TestUpgradeReadinessSummary(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]gjson.Result{
+		"faultInst": gjson.Parse(`[
+			{"dn": "f1", "severity": "critical"},
+			{"dn": "f2", "severity": "major"},
+			{"dn": "f3", "severity": "major"}
+		]`),
+		"firmwareCtrlrRunning": gjson.Parse(`[{"version": "4.2(3l)"}, {"version": "4.2(3l)"}]`),
+		"firmwareRunning":      gjson.Parse(`[{"version": "n9000-14.2(3l)"}]`),
+		"infraWiNode":          gjson.Parse(`[{"health": "fully-fit"}, {"health": "data-layer-partially-diverged"}]`),
+		"fabricNode":           gjson.Parse(`[{"model": "N9K-C93180YC-EX"}, {"model": "N9K-C9504"}]`),
+		"eqptLC":               gjson.Parse(`[{"model": "N9K-X9736C-FX"}, {"model": "N9K-X9736PQ"}]`),
+		"eqptcapacityPolUsage5min": gjson.Parse(`[
+			{"polUsageCum": "6100", "polUsageCapCum": "61000"},
+			{"polUsageCum": "30500", "polUsageCapCum": "61000"},
+			{"polUsageCum": "0", "polUsageCapCum": "0"}
+		]`),
+		"eqptcapacityVlanUsage5min": gjson.Parse(`[{"totalCum": "0", "totalCapCum": "3960"}]`),
+		"maintMaintGrp": gjson.Parse(`[
+			{"dn": "uni/fabric/maintgrp-odd", "name": "odd"},
+			{"dn": "uni/fabric/maintgrp-even", "name": "even"}
+		]`),
+		"fabricNodeBlk": gjson.Parse(`[
+			{"dn": "uni/fabric/maintgrp-even/nodeblk-a", "from_": "102", "to_": "104"},
+			{"dn": "uni/fabric/maintgrp-odd/nodeblk-a", "from_": "101", "to_": "101"},
+			{"dn": "uni/fabric/leprof-a/leaves-a-typ-range/nodeblk-a", "from_": "101", "to_": "104"}
+		]`),
+	}
+	s := upgradeReadinessSummary(responses)
+	a.Equal(map[string]int{"critical": 1, "major": 2}, s.Faults)
+	a.Equal(map[string]int{"4.2(3l)": 2}, s.ControllerVersions)
+	a.Equal(map[string]int{"n9000-14.2(3l)": 1}, s.SwitchVersions)
+	a.Equal(map[string]int{"fully-fit": 1, "data-layer-partially-diverged": 1}, s.ClusterHealth)
+	a.Equal([]maintGroup{{"even", 3}, {"odd", 1}}, s.MaintenanceGroups)
+	a.Equal(4, len(s.HardwareModels))
+	a.Equal(map[string]int{"tcam": 50, "vlan": 0}, s.Capacity)
+	a.Equal(map[string]int{"N9K-X9736PQ": 1}, s.FirstGenHardware)
+
+	summary, err := buildSummary(responses, upgradeReadiness)
+	a.NoError(err)
+	a.True(gjson.Get(summary, "upgradeReadiness.faults.major").Exists())
+	summary, err = buildSummary(responses, "")
+	a.NoError(err)
+	a.False(gjson.Get(summary, "upgradeReadiness").Exists())
+}
+
+func TestFabricRequests(t *testing.T) {
+	a := assert.New(t)
+	a.Empty(fabricRequests(CollectCmd{}))
+	reqs := fabricRequests(CollectCmd{Endpoints: true})
+	a.Len(reqs, 2)
+	for _, req := range reqs {
+		a.True(req.Sensitive)
+		a.Equal(collector.ShardTenant, req.Shard)
+	}
+	reqs = fabricRequests(CollectCmd{Endpoints: true, Coop: true})
+	a.Equal("coopEpRec", reqs[2].Prefix)
+	a.Equal(collector.ShardSpine, reqs[2].Shard)
+
+	reqs = fabricRequests(CollectCmd{Adjacencies: true})
+	a.Equal("arpAdjEp", reqs[0].Prefix)
+	a.Equal("ndAdjEp", reqs[1].Prefix)
+}
+
+func TestFabricFlags(t *testing.T) {
+	a := assert.New(t)
+	a.Empty(fabricFlags(CollectCmd{}))
+	a.Equal([]string{"--endpoints"}, fabricFlags(CollectCmd{Endpoints: true}))
+	a.Equal([]string{"--endpoints", "--coop"}, fabricFlags(CollectCmd{Endpoints: true, Coop: true}))
+	a.Equal([]string{"--adjacencies"}, fabricFlags(CollectCmd{Adjacencies: true}))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+)
+
+// startProfiling starts the profiles requested by the pprof flags, for
+// troubleshooting memory and CPU use on large fabrics. The returned func
+// stops them and writes the heap profile.
+func startProfiling(args Args, log Logger) (func(), error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	if args.PprofCPU != "" {
+		f, err := os.Create(args.PprofCPU)
+		if err != nil {
+			return stop, fmt.Errorf("cannot create CPU profile: %v", err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return stop, fmt.Errorf("cannot start CPU profile: %v", err)
+		}
+		stops = append(stops, func() {
+			runtimepprof.StopCPUProfile()
+			f.Close()
+			log.Info().Str("file", args.PprofCPU).Msg("Wrote CPU profile")
+		})
+	}
+	if args.PprofMem != "" {
+		stops = append(stops, func() {
+			if err := writeHeapProfile(args.PprofMem); err != nil {
+				log.Warn().Err(err).Msg("cannot write heap profile")
+				return
+			}
+			log.Info().Str("file", args.PprofMem).Msg("Wrote heap profile")
+		})
+	}
+	if args.PprofAddr != "" {
+		ln, err := net.Listen("tcp", args.PprofAddr)
+		if err != nil {
+			return stop, fmt.Errorf("cannot listen for pprof: %v", err)
+		}
+		// Not http.DefaultServeMux, so the profiles are only served here
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		go http.Serve(ln, mux)
+		log.Info().Msgf("Serving profiles on http://%s/debug/pprof/", ln.Addr())
+		stops = append(stops, func() { ln.Close() })
+	}
+	return stop, nil
+}
+
+// writeHeapProfile writes the heap profile after a garbage collection, so it
+// reflects the live objects.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
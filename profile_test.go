@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartProfiling(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	args := Args{PprofCPU: filepath.Join(dir, "cpu.prof"), PprofMem: filepath.Join(dir, "mem.prof")}
+	stop, err := startProfiling(args, log)
+	if !a.NoError(err) {
+		return
+	}
+	stop()
+	for _, path := range []string{args.PprofCPU, args.PprofMem} {
+		info, err := os.Stat(path)
+		if a.NoError(err) {
+			a.NotZero(info.Size(), path)
+		}
+	}
+
+	_, err = startProfiling(Args{PprofCPU: filepath.Join(dir, "missing", "cpu.prof")}, log)
+	a.Error(err)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/match"
+)
+
+// matchDn checks a DN against a filter. Filters containing * or ? are
+// wildcard patterns matching the full DN; other filters match a substring.
+func matchDn(dn, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	if strings.ContainsAny(filter, "*?") {
+		return match.Match(dn, filter)
+	}
+	return strings.Contains(dn, filter)
+}
+
+// queryRecords returns the records for a prefix, optionally filtered by DN.
+func queryRecords(db *buntdb.DB, prefix, dnFilter string) ([]gjson.Result, error) {
+	var records []gjson.Result
+	err := db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(prefix+":*", func(key, value string) bool {
+			if _, dn := splitKey(key); matchDn(dn, dnFilter) {
+				records = append(records, gjson.Parse(value))
+			}
+			return true
+		})
+	})
+	return records, err
+}
+
+// selectAttrs reduces a record to the given attributes.
+func selectAttrs(record gjson.Result, attrs []string) map[string]interface{} {
+	if len(attrs) == 0 {
+		if m, ok := record.Value().(map[string]interface{}); ok {
+			return m
+		}
+		return map[string]interface{}{}
+	}
+	selected := make(map[string]interface{})
+	for _, attr := range attrs {
+		selected[attr] = record.Get(attr).Value()
+	}
+	return selected
+}
+
+// printRecords writes records as indented JSON or a table.
+func printRecords(w io.Writer, records []gjson.Result, attrs []string, format string) error {
+	switch format {
+	case "", "json":
+		out := make([]map[string]interface{}, 0, len(records))
+		for _, record := range records {
+			out = append(out, selectAttrs(record, attrs))
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "table":
+		if len(attrs) == 0 {
+			attrs = []string{"dn", "name"}
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(attrs, "\t"))
+		for _, record := range records {
+			var row []string
+			for _, attr := range attrs {
+				row = append(row, record.Get(attr).String())
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q, expected json or table", format)
+	}
+}
+
+// query prints the records of a class from a collection.
+func query(cmd QueryCmd) error {
+	db, closeDB, err := openDB(cmd.DB)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", cmd.DB, err)
+	}
+	defer closeDB()
+	records, err := queryRecords(db, cmd.Class, cmd.DnFilter)
+	if err != nil {
+		return fmt.Errorf("cannot read records: %v", err)
+	}
+	return printRecords(os.Stdout, records, cmd.Attr, cmd.Format)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestMatchDn(t *testing.T) {
+	a := assert.New(t)
+	a.True(matchDn("uni/tn-common", ""))
+	a.True(matchDn("uni/tn-common", "tn-com"))
+	a.False(matchDn("uni/tn-common", "tn-infra"))
+	a.True(matchDn("uni/tn-common/BD-default", "uni/tn-common/*"))
+	a.False(matchDn("uni/tn-infra/BD-default", "uni/tn-common/*"))
+}
+
+func TestQueryRecords(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, out, log)) {
+		return
+	}
+	db, closeDB, err := openDB(out)
+	if !a.NoError(err) {
+		return
+	}
+	defer closeDB()
+
+	records, err := queryRecords(db, "fvTenant", "")
+	a.NoError(err)
+	a.Len(records, 2)
+	records, err = queryRecords(db, "fvTenant", "uni/tn-c*")
+	a.NoError(err)
+	if a.Len(records, 1) {
+		a.Equal("common", records[0].Get("name").Str)
+	}
+}
+
+func TestPrintRecords(t *testing.T) {
+	a := assert.New(t)
+	records := []gjson.Result{gjson.Parse(`{"dn":"uni/tn-a","name":"a","descr":"x"}`)}
+
+	var buf bytes.Buffer
+	a.NoError(printRecords(&buf, records, []string{"name"}, "json"))
+	a.JSONEq(`[{"name":"a"}]`, buf.String())
+
+	buf.Reset()
+	a.NoError(printRecords(&buf, records, nil, "table"))
+	a.Equal("dn        name\nuni/tn-a  a\n", buf.String())
+
+	a.Error(printRecords(&buf, records, nil, "xml"))
+}
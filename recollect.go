@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// readPrevious reads the records and failed classes of an earlier
+// collection, for re-collecting the failed classes.
+func readPrevious(path string) (map[string]goaci.Res, []string, error) {
+	c, err := readCollection(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	responses, err := responsesFrom(c.records)
+	if err != nil {
+		return nil, nil, err
+	}
+	var failed []string
+	c.meta.Get("errors").ForEach(func(prefix, _ gjson.Result) bool {
+		failed = append(failed, prefix.Str)
+		return true
+	})
+	return responses, failed, nil
+}
+
+// onlyClasses returns the requests for the given classes, and the classes
+// without a request, e.g. follow-up queries.
+func onlyClasses(reqs []*collector.Request, classes []string) ([]*collector.Request, []string) {
+	wanted := make(map[string]bool)
+	for _, class := range classes {
+		wanted[class] = true
+	}
+	found := make(map[string]bool)
+	var selected []*collector.Request
+	for _, req := range reqs {
+		if wanted[req.Prefix] {
+			selected = append(selected, req)
+			found[req.Prefix] = true
+		}
+	}
+	var unknown []string
+	for _, class := range classes {
+		if !found[class] {
+			unknown = append(unknown, class)
+		}
+	}
+	return selected, unknown
+}
+
+// mergePrevious writes the records of an earlier collection for the classes
+// that weren't re-collected to the collection db.
+func mergePrevious(w *collector.Writer, previous map[string]goaci.Res) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	collected := w.Counts()
+	for prefix, res := range previous {
+		if _, ok := collected[prefix]; ok {
+			continue
+		}
+		if err := w.Write(prefix, res.Array()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
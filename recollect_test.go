@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestReadPrevious(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	defer os.Remove(dbName)
+
+	responses := map[string]goaci.Res{
+		"fvTenant": gjson.Parse(`[{"dn": "uni/tn-a"}, {"dn": "uni/tn-b"}]`),
+	}
+	meta := goaci.Body{}.SetRaw("errors", `{"faultInst": "timeout", "fvRsPathAtt": "timeout"}`)
+	if !a.NoError(writeToDB(responses, meta, log)) {
+		return
+	}
+	previous, failed, err := readPrevious(dbName)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]string{"faultInst", "fvRsPathAtt"}, failed)
+	a.Len(previous["fvTenant"].Array(), 2)
+
+	reqs, unknown := onlyClasses(collector.WithDefaults([]*collector.Request{{Class: "fvTenant"}, {Class: "faultInst"}}), failed)
+	a.Len(reqs, 1)
+	a.Equal("faultInst", reqs[0].Prefix)
+	a.Equal([]string{"fvRsPathAtt"}, unknown)
+
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	defer db.Close()
+	w := collector.NewWriter(db, collector.Limits{}, log)
+	a.NoError(w.Write("faultInst", gjson.Parse(`[{"dn": "topology/pod-1/node-101/fault-F0001"}]`).Array()))
+	previous["faultInst"] = gjson.Parse(`[{"dn": "topology/pod-1/node-101/fault-F0002"}, {"dn": "topology/pod-1/node-101/fault-F0003"}]`)
+	a.NoError(mergePrevious(w, previous))
+	a.NoError(w.Close())
+	a.Equal(map[string]int{"fvTenant": 2, "faultInst": 1}, w.Counts())
+}
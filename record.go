@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// exchange is a recorded APIC request and response. Request bodies, i.e.
+// the login credentials, and session cookies are not recorded.
+type exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Responses that contain the session token.
+var tokenPaths = map[string]bool{
+	"/api/aaaLogin.json":   true,
+	"/api/aaaRefresh.json": true,
+}
+
+// recorder appends every request and response to a recording, one exchange
+// per line. Responses are buffered in memory to be recorded.
+type recorder struct {
+	mu   sync.Mutex
+	base http.RoundTripper
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recording: %v", err)
+	}
+	return &recorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// wrap is a client modifier recording the client's requests.
+func (r *recorder) wrap(client *goaci.Client) {
+	r.base = client.HttpClient.Transport
+	if r.base == nil {
+		r.base = http.DefaultTransport
+	}
+	client.HttpClient.Transport = r
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	if tokenPaths[req.URL.Path] {
+		body = []byte(goaci.Body{Str: string(body)}.
+			Set("imdata.0.aaaLogin.attributes.token", "redacted").Str)
+	}
+	b, err := json.Marshal(exchange{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: res.StatusCode,
+		Header: header,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(b, '\n'))
+	return res, nil
+}
+
+// Close flushes and closes the recording.
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// replayer answers requests from a recording rather than the APIC.
+type replayer struct {
+	mu        sync.Mutex
+	host      string                 // APIC of the recording
+	exchanges map[string][]*exchange // By method and path, in recorded order
+	used      map[*exchange]bool
+}
+
+func readRecording(path string) (*replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open recording: %v", err)
+	}
+	defer f.Close()
+	r := &replayer{
+		exchanges: make(map[string][]*exchange),
+		used:      make(map[*exchange]bool),
+	}
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e exchange
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %v", path, err)
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %v", path, err)
+		}
+		if r.host == "" {
+			r.host = u.Host
+		}
+		key := e.Method + " " + u.Path
+		r.exchanges[key] = append(r.exchanges[key], &e)
+	}
+	if r.host == "" {
+		return nil, fmt.Errorf("empty recording %s", path)
+	}
+	return r, nil
+}
+
+// wrap is a client modifier answering the client's requests from the
+// recording.
+func (r *replayer) wrap(client *goaci.Client) {
+	client.HttpClient.Transport = r
+}
+
+// match returns the recorded exchange for a request: the first unused one
+// with the closest query, e.g. ignoring the timestamps of event record
+// filters, or the last used one for requests made more often than recorded.
+func (r *replayer) match(req *http.Request) *exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best, reused *exchange
+	bestScore, reusedScore := -1, -1
+	for _, e := range r.exchanges[req.Method+" "+req.URL.Path] {
+		u, _ := url.Parse(e.URL)
+		score := matchQuery(req.URL.Query(), u.Query())
+		if score < 0 {
+			continue
+		}
+		if !r.used[e] && score > bestScore {
+			best, bestScore = e, score
+		}
+		if score >= reusedScore {
+			reused, reusedScore = e, score
+		}
+	}
+	if best == nil {
+		return reused
+	}
+	r.used[best] = true
+	return best
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	e := r.match(req)
+	if e == nil {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL.RequestURI())
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}, nil
+}
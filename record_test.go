@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"aci-vetr-c/collector"
+)
+
+func TestRecordReplay(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.ndjson")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/aaaLogin.json":
+			http.SetCookie(w, &http.Cookie{Name: "APIC-cookie", Value: "secret-token"})
+			w.Write([]byte(`{"imdata":[{"aaaLogin":{"attributes":{"token":"secret-token"}}}]}`))
+		case "/api/class/eventRecord.json":
+			w.Write([]byte(`{"imdata":[{"eventRecord":{"attributes":{"dn":"` + r.URL.Query().Get("query-target-filter") + `"}}}]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"imdata":[{"error":{"attributes":{"code":"400","text":"Request failed, unresolved class for fvTenant"}}}]}`))
+		}
+	}))
+	rec, err := newRecorder(path)
+	if !a.NoError(err) {
+		return
+	}
+	pool := collector.NewPool([]string{srv.URL}, "admin", "password", log, rec.wrap)
+	a.NoError(pool.Login())
+	reqs := collector.WithDefaults([]*collector.Request{
+		{Class: "eventRecord", Prefix: "a", Mods: []collector.Mod{goaci.Query("query-target-filter", "a-2024")}},
+		{Class: "eventRecord", Prefix: "b", Mods: []collector.Mod{goaci.Query("query-target-filter", "b-2024")}},
+		{Class: "fvTenant"},
+	})
+	recorded, err := collector.Fetch(pool, reqs, collector.Limits{Requests: 1}, log)
+	a.NoError(err)
+	a.NoError(rec.Close())
+	srv.Close()
+
+	b, err := ioutil.ReadFile(path)
+	a.NoError(err)
+	a.NotContains(string(b), "password")
+	a.NotContains(string(b), "secret-token")
+
+	// Replay with different timestamps, in a different order
+	replay, err := readRecording(path)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(srv.Listener.Addr().String(), replay.host)
+	pool = collector.NewPool([]string{"apic"}, "", "", log, replay.wrap)
+	a.NoError(pool.Login())
+	reqs = collector.WithDefaults([]*collector.Request{
+		{Class: "fvTenant"},
+		{Class: "eventRecord", Prefix: "b", Mods: []collector.Mod{goaci.Query("query-target-filter", "b-2025")}},
+		{Class: "eventRecord", Prefix: "a", Mods: []collector.Mod{goaci.Query("query-target-filter", "a-2025")}},
+	})
+	replayed, err := collector.Fetch(pool, reqs, collector.Limits{Requests: 1}, log)
+	a.NoError(err)
+	a.Equal(recorded["a"].Raw, replayed["a"].Raw)
+	a.Equal(recorded["b"].Raw, replayed["b"].Raw)
+	a.True(reqs[0].Skipped)
+
+	_, err = replay.RoundTrip(httptest.NewRequest("GET", "/api/class/fvBD.json", nil))
+	a.EqualError(err, "no recorded response for GET /api/class/fvBD.json")
+}
@@ -3,170 +3,112 @@ package main
 import (
 	"fmt"
 
-	"github.com/brightpuddle/goaci"
+	"aci-vetr-c/collector"
 )
 
-type Mod = func(*goaci.Req)
-
-// Request is an HTTP request.
-type Request struct {
-	class  string // MO class
-	path   string // Request path
-	prefix string // Prefix for the DB
-	mods   []Mod  // Request modifiers, e.g. query parameters
-	filter string // Result filter (default to #.{class}.attributes)
+// requestSet is the requests of a collection, adjusted to the APIC.
+type requestSet struct {
+	catalog  []*collector.Request // The requests before --only-failed, for the tiers
+	reqs     []*collector.Request // Every request, as reported for the run
+	history  []*collector.Request // The record history, with --history, --events or --audit-log
+	fetch    []*collector.Request // Class queries
+	tenant   []*collector.Request // Queried per tenant subtree, with --tenant-subtree
+	shard    []*collector.Request // Split by tenant or node
+	vendor   string               // Cloud APIC vendor; empty on premises
+	version  string               // APIC version; empty if unknown
+	excluded []string             // Classes the APIC version doesn't support
+	skipped  []string             // Stats classes skipped with --skip-stats
 }
 
-func getRequests() []*Request {
-	reqs := []*Request{
-		/************************************************************
-		Infrastructure
-		************************************************************/
-		{class: "topSystem"},    // All devices
-		{class: "eqptBoard"},    // APIC hardware
-		{class: "fabricNode"},   // Switch hardware
-		{class: "fabricSetupP"}, // Pods (fabric setup policy)
-
-		/************************************************************
-		Fabric-wide settings
-		************************************************************/
-		{class: "epLoopProtectP"},    // EP loop protection policy
-		{class: "epControlP"},        // Rogue EP control policy
-		{class: "epIpAgingP"},        // IP aging policy
-		{class: "infraSetPol"},       // Fabric-wide settings
-		{class: "infraPortTrackPol"}, // Port tracking policy
-		{class: "coopPol"},           // COOP group policy
-
-		/************************************************************
-		Tenants
-		************************************************************/
-		// Primary constructs
-		{class: "fvAEPg"},   // EPG
-		{class: "fvRsBd"},   // EPG --> BD
-		{class: "fvBD"},     // BD
-		{class: "fvCtx"},    // VRF
-		{class: "fvTenant"}, // Tenant
-		{class: "fvSubnet"}, // Subnet
-
-		// Contracts
-		{class: "vzBrCP"},          // Contract
-		{class: "vzFilter"},        // Filter
-		{class: "vzSubj"},          // Subject
-		{class: "vzRsSubjFiltAtt"}, // Subject --> filter
-		{class: "fvRsProv"},        // EPG --> contract provided
-		{class: "fvRsCons"},        // EPG --> contract consumed
-
-		// L3outs
-		{class: "l3extOut"},            // L3out
-		{class: "l3extLNodeP"},         // L3 node profile
-		{class: "l3extRsNodeL3OutAtt"}, // Node profile --> Node
-		{class: "l3extLIfP"},           // L3 interface profile
-		{class: "l3extInstP"},          // External EPG
-
-		/************************************************************
-		Fabric Policies
-		************************************************************/
-		{class: "isisDomPol"},         // ISIS policy
-		{class: "bgpRRNodePEp"},       // BGP route reflector nodes
-		{class: "l3IfPol"},            // L3 interface policy
-		{class: "fabricNodeControl"},  // node control (Dom, netflow,etc)
-		{class: "fabricRsNodeCtrl"},   // node policy group --> node control
-		{class: "fabricRsLeNodePGrp"}, // leaf --> leaf node policy group
-		{class: "fabricNodeBlk"},      // Node block
-
-		/************************************************************
-		Fabric Access
-		************************************************************/
-		// MCP
-		{class: "mcpIfPol"},          // MCP inteface policy
-		{class: "infraRsMcpIfPol"},   // MCP pol --> policy group
-		{class: "infraRsAccBaseGrp"}, // policy group --> host port selector
-		{class: "infraRsAccPortP"},   // int profile --> node profile
-
-		{class: "mcpInstPol"}, // MCP global policy
-
-		// AEP/domain/VLANs
-		{class: "infraAttEntityP"}, // AEP
-		{class: "infraRsDomP"},     // AEP --> domain
-		{class: "infraRsVlanNs"},   // Domain --> VLAN pool
-		{class: "fvnsEncapBlk"},    // VLAN encap block
-
-		/************************************************************
-		Admin/Operations
-		************************************************************/
-		{class: "firmwareRunning"},        // Switch firmware
-		{class: "firmwareCtrlrRunning"},   // Controller firmware
-		{class: "pkiExportEncryptionKey"}, // Crypto key
-
-		/************************************************************
-		Live State
-		************************************************************/
-		{class: "faultInst"}, // Faults
-		{class: "fvcapRule"}, // Capacity rules
-
-		{ // Endpoint count
-			class:  "fvCEp",
-			filter: "#.moCount.attributes",
-			mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
-		},
-		{ // IP count
-			class:  "fvIp",
-			filter: "#.moCount.attributes",
-			mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
-		},
-
-		{ // L4-L7 container count
-			class:  "vnsCDev",
-			filter: "#.moCount.attributes",
-			mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
-		},
-
-		{ // L4-L7 service graph count
-			class:  "vnsGraphInst",
-			filter: "#.moCount.attributes",
-			mods:   []Mod{goaci.Query("rsp-subtree-include", "count")},
-		},
-
-		{ // MO count by node
-			class:  "ctxClassCnt",
-			filter: "#.moCount.attributes",
-			mods:   []Mod{goaci.Query("rsp-subtree-class", "l2BD,fvEpP,l3Dom")},
-		},
-
-		// Fabric health
-		{class: "fabricHealthTotal"}, // Total and per-pod health scores
-		{ // Per-device health stats
-			class:  "topSystem",
-			prefix: "heatlhInst",
-			mods:   []Mod{goaci.Query("rsp-subtree-include", "health,no-scoped")},
-			filter: "#.attributes.healthInst",
-		},
-
-		// Switch capacity
-		{class: "eqptcapacityVlanUsage5min"},        // VLAN
-		{class: "eqptcapacityPolUsage5min"},         // TCAM
-		{class: "eqptcapacityL2Usage5min"},          // L2 local
-		{class: "eqptcapacityL2RemoteUsage5min"},    // L2 remote
-		{class: "eqptcapacityL2TotalUsage5min"},     // L2 total
-		{class: "eqptcapacityL3Usage5min"},          // L3 local
-		{class: "eqptcapacityL3UsageCap5min"},       // L3 local cap
-		{class: "eqptcapacityL3RemoteUsage5min"},    // L3 remote
-		{class: "eqptcapacityL3RemoteUsageCap5min"}, // L3 remote cap
-		{class: "eqptcapacityL3TotalUsage5min"},     // L3 total
-		{class: "eqptcapacityL3TotalUsageCap5min"},  // L3 total cap
-		{class: "eqptcapacityMcastUsage5min"},       // Multicast
+// buildRequests returns the requests of a collection, both to collect and
+// to preview it with --dry-run: those of the preset, the history and the
+// optional fabric data, or of Cloud APIC, without the classes the APIC
+// version doesn't support, and filtered by the collect flags. With
+// --only-failed, only the failed classes are requested.
+func buildRequests(client collector.Getter, args CollectCmd, failed []string, log Logger) (requestSet, error) {
+	var set requestSet
+	reqs, err := collectRequests(args.Preset)
+	if err != nil {
+		return set, err
 	}
-
-	for _, req := range reqs {
-		if req.filter == "" {
-			req.filter = fmt.Sprintf("#.%s.attributes", req.class)
+	if set.history, err = historyRequests(args); err != nil {
+		return set, err
+	}
+	window, err := historyWindow(args)
+	if err != nil {
+		return set, err
+	}
+	reqs = collector.ForHistory(reqs, window)
+	reqs = append(reqs, set.history...)
+	reqs = append(reqs, fabricRequests(args)...)
+
+	// Cloud APIC has its own object model
+	vendor, err := cloudVendor(client)
+	if err != nil {
+		// Releases before Cloud APIC don't have the class
+		log.Debug().Err(err).Msg("cannot detect Cloud APIC")
+	}
+	if vendor != "" {
+		if args.Preset != "" {
+			log.Warn().Str("preset", args.Preset).Msg("presets are not supported on Cloud APIC")
 		}
-		if req.path == "" {
-			req.path = "/api/class/" + req.class
+		for _, flag := range fabricFlags(args) {
+			log.Warn().Str("flag", flag).Msg("fabric tables are not collected on Cloud APIC")
 		}
-		if req.prefix == "" {
-			req.prefix = req.class
+		reqs = append(cloudRequests(), set.history...)
+		log.Info().Str("vendor", vendor).Msg("Cloud APIC")
+		set.vendor = vendor
+	}
+	set.catalog = reqs
+	if args.OnlyFailed {
+		var unknown []string
+		reqs, unknown = onlyClasses(reqs, failed)
+		if len(unknown) > 0 {
+			log.Warn().Strs("classes", unknown).Msg("cannot re-collect classes without a request, e.g. follow-up queries")
 		}
+		if len(reqs) == 0 {
+			return set, fmt.Errorf("no failed classes to re-collect in %s", args.DB)
+		}
+		log.Info().Int("classes", len(reqs)).Str("db", args.DB).Msg("Re-collecting failed classes")
+	}
+
+	// Adjust the requests to the APIC version
+	if name, running, err := controllerVersion(client); err != nil {
+		log.Warn().Err(err).Msg("cannot determine the APIC version; requesting all classes")
+	} else {
+		reqs, set.excluded = forVersion(reqs, running)
+		log.Info().Str("version", name).Strs("excluded", set.excluded).Msg("APIC version")
+		set.version = name
+	}
+
+	if args.SkipStats {
+		reqs, set.skipped = collector.WithoutStats(reqs)
+		log.Info().Strs("skipped", set.skipped).Msg("Skipping health and capacity stats")
+	}
+	if args.FaultSeverity != "" {
+		reqs = collector.ForFaultSeverity(reqs, args.FaultSeverity)
+		log.Info().Str("severity", args.FaultSeverity).Msg("Collecting faults of this severity or more severe")
+	}
+	if args.SkipAcked {
+		reqs = collector.WithoutAckedFaults(reqs)
+		log.Info().Msg("Skipping acknowledged and delegated faults")
+	}
+	if args.Pod > 0 {
+		reqs = collector.ForPod(reqs, args.Pod)
+		log.Info().Int("pod", args.Pod).Msg("Collecting a single pod")
+	}
+	if len(args.Tenant) > 0 {
+		log.Info().Strs("tenants", args.Tenant).Msg("Collecting selected tenants")
+	}
+	set.reqs = reqs
+
+	set.shard, set.fetch = collector.ShardedRequests(reqs)
+	if args.TenantSubtree {
+		set.tenant, set.fetch = collector.TenantRequests(set.fetch)
+	}
+	if len(args.Tenant) > 0 {
+		// The tenant subtrees are those of the tenants collected
+		set.fetch = collector.ForTenants(set.fetch, args.Tenant)
 	}
-	return reqs
+	return set, nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// apicGetter answers the queries made to build the requests, by path.
+type apicGetter map[string]string
+
+func (g apicGetter) Get(path string, mods ...collector.Mod) (gjson.Result, error) {
+	body, ok := g[path]
+	if !ok {
+		return gjson.Result{}, errors.New("unexpected request")
+	}
+	return gjson.Parse(body), nil
+}
+
+// requestURLs returns the URLs of the requests by prefix.
+func requestURLs(reqs []*collector.Request) map[string]string {
+	urls := make(map[string]string)
+	for _, req := range reqs {
+		urls[req.Prefix] = requestURL(goaci.Client{}, req)
+	}
+	return urls
+}
+
+func TestBuildRequests(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	apic := apicGetter{
+		"/api/class/cloudProvP":           `{"imdata": []}`,
+		"/api/class/firmwareCtrlrRunning": `{"imdata": [{"firmwareCtrlrRunning": {"attributes": {"version": "3.1(2m)"}}}]}`,
+	}
+
+	set, err := buildRequests(apic, CollectCmd{Pod: 2, Tenant: []string{"a"}, TenantSubtree: true}, nil, log)
+	a.NoError(err)
+	a.Equal("3.1(2m)", set.version)
+	a.Contains(set.excluded, "eqptcapacityL2TotalUsage5min")
+	fetch := requestURLs(set.fetch)
+	a.Contains(fetch["fvTenant"], "uni%2Ftn-a")
+	a.Contains(fetch["topSystem"], "pod-2")
+	a.NotContains(fetch, "fvBD")
+	a.Contains(requestURLs(set.tenant), "fvBD")
+	a.Contains(requestURLs(set.shard), "faultInst")
+	a.Len(set.reqs, len(set.fetch)+len(set.tenant)+len(set.shard))
+
+	set, err = buildRequests(apic, CollectCmd{SkipStats: true}, nil, log)
+	a.NoError(err)
+	a.Contains(set.skipped, "fabricHealthTotal")
+	a.NotContains(requestURLs(set.reqs), "fabricHealthTotal")
+
+	// --only-failed re-collects the failed classes of the catalog
+	set, err = buildRequests(apic, CollectCmd{OnlyFailed: true}, []string{"fvBD", "fvCEpFollowUp"}, log)
+	a.NoError(err)
+	a.Equal([]string{"fvBD"}, prefixes(set.reqs))
+	a.True(len(set.catalog) > 1)
+	_, err = buildRequests(apic, CollectCmd{OnlyFailed: true, DB: "vetr.db"}, []string{"fvCEpFollowUp"}, log)
+	a.EqualError(err, "no failed classes to re-collect in vetr.db")
+
+	// Cloud APIC has its own requests
+	apic["/api/class/cloudProvP"] = `{"imdata": [{"cloudProvP": {"attributes": {"vendor": "aws"}}}]}`
+	set, err = buildRequests(apic, CollectCmd{}, nil, log)
+	a.NoError(err)
+	a.Equal("aws", set.vendor)
+	urls := requestURLs(set.reqs)
+	a.Contains(urls, "cloudEPg")
+	a.NotContains(urls, "fvBD")
+}
+
+// prefixes returns the prefixes of the requests.
+func prefixes(reqs []*collector.Request) []string {
+	var p []string
+	for _, req := range reqs {
+		p = append(p, req.Prefix)
+	}
+	return p
+}
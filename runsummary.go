@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// Run summary file in the archive. A copy is written next to the archive as
+// {name}.summary.json.
+const runSummaryName = "summary.json"
+
+// classSummary is the collection result of a class.
+type classSummary struct {
+	Status   string  `json:"status"` // ok, empty, skipped or error
+	Objects  int     `json:"objects"`
+	Duration float64 `json:"durationSeconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// runSummary is the machine-readable outcome of a collection, so automation
+// can decide whether the collection is usable without parsing the log.
+type runSummary struct {
+	Status           string                  `json:"status"` // success, partial or failed
+	RunID            string                  `json:"runId"`
+	CollectorVersion string                  `json:"collectorVersion"`
+	APIC             string                  `json:"apic"`
+	Fabric           string                  `json:"fabric,omitempty"`
+	Start            string                  `json:"start"`
+	End              string                  `json:"end"`
+	Duration         float64                 `json:"durationSeconds"`
+	Classes          map[string]classSummary `json:"classes"`
+	Outputs          []string                `json:"outputs,omitempty"`
+	Warnings         []string                `json:"warnings,omitempty"`
+	Error            string                  `json:"error,omitempty"`
+}
+
+// summarize builds the run summary. Classes without a request, e.g.
+// follow-up queries and aggregates, are reported without a duration.
+func (r runReport) summarize(now time.Time) runSummary {
+	s := runSummary{
+		Status:           "success",
+		RunID:            r.id,
+		CollectorVersion: version,
+		APIC:             r.apic,
+		Start:            r.start.Format(time.RFC3339),
+		End:              now.Format(time.RFC3339),
+		Duration:         now.Sub(r.start).Seconds(),
+		Fabric:           r.fabric,
+		Classes:          make(map[string]classSummary),
+		Outputs:          r.outputs,
+		Warnings:         r.warnings,
+	}
+	for _, req := range r.reqs {
+		c := s.Classes[req.Prefix]
+		c.Duration += req.Elapsed.Seconds()
+		switch {
+		case req.Err != nil:
+			c.Status = "error"
+			c.Error = req.Err.Error()
+		case req.Skipped:
+			c.Status = "skipped"
+		}
+		s.Classes[req.Prefix] = c
+	}
+	for prefix, n := range r.counts {
+		c := s.Classes[prefix]
+		c.Objects = n
+		s.Classes[prefix] = c
+	}
+	for prefix, c := range s.Classes {
+		if c.Status == "" {
+			c.Status = "ok"
+			if c.Objects == 0 {
+				c.Status = "empty"
+			}
+			s.Classes[prefix] = c
+		}
+	}
+	switch {
+	case r.err != nil:
+		s.Status = "failed"
+		s.Error = r.err.Error()
+	case len(r.warnings) > 0:
+		s.Status = "partial"
+	}
+	return s
+}
+
+// writeRunSummary writes the run summary as indented JSON.
+func writeRunSummary(path string, r runReport) error {
+	b, err := json.MarshalIndent(r.summarize(time.Now()), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// runSummaryPayload adds the run summary, as of archive creation, to the
+// archive.
+func runSummaryPayload(r *runReport) payload {
+	return func(map[string]goaci.Res) ([]string, error) {
+		if err := writeRunSummary(runSummaryName, *r); err != nil {
+			return nil, err
+		}
+		return []string{runSummaryName}, nil
+	}
+}
+
+// runSummaryPath returns the path of the run summary next to an archive.
+func runSummaryPath(output string) string {
+	base, _ := splitExt(output)
+	return base + ".summary.json"
+}
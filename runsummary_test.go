@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aci-vetr-c/collector"
+)
+
+func TestRunSummary(t *testing.T) {
+	a := assert.New(t)
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	r := runReport{
+		apic:  "10.0.0.1",
+		start: start,
+		reqs: []*collector.Request{
+			{Prefix: "topSystem", Elapsed: 2 * time.Second},
+			{Prefix: "fvTenant", Elapsed: time.Second},
+			{Prefix: "faultInst", Elapsed: time.Second, Err: errors.New("timeout")},
+		},
+		fabric: "prod",
+		counts: map[string]int{"topSystem": 1, "fvTenant": 0, "contractsPerLeaf": 1},
+	}
+	s := r.summarize(start.Add(90 * time.Second))
+	a.Equal("success", s.Status)
+	a.Equal("prod", s.Fabric)
+	a.Equal(90.0, s.Duration)
+	a.Equal(classSummary{Status: "ok", Objects: 1, Duration: 2}, s.Classes["topSystem"])
+	a.Equal(classSummary{Status: "empty", Duration: 1}, s.Classes["fvTenant"])
+	a.Equal(classSummary{Status: "error", Duration: 1, Error: "timeout"}, s.Classes["faultInst"])
+	a.Equal(classSummary{Status: "ok", Objects: 1}, s.Classes["contractsPerLeaf"])
+
+	r.warnings = []string{"cannot count contracts per leaf"}
+	a.Equal("partial", r.summarize(start).Status)
+
+	r.err = errors.New("failed to make request: timeout")
+	s = r.summarize(start)
+	a.Equal("failed", s.Status)
+	a.Equal("failed to make request: timeout", s.Error)
+}
+
+func TestWriteRunSummary(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := runSummaryPath(filepath.Join(dir, "aci-vetr-data.tar.gz"))
+	a.Equal(filepath.Join(dir, "aci-vetr-data.summary.json"), path)
+	a.NoError(writeRunSummary(path, runReport{apic: "10.0.0.1", start: time.Now()}))
+
+	b, err := ioutil.ReadFile(path)
+	a.NoError(err)
+	var s runSummary
+	a.NoError(json.Unmarshal(b, &s))
+	a.Equal("success", s.Status)
+	a.Equal("10.0.0.1", s.APIC)
+}
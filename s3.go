@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Credentials are AWS credentials, read from the standard environment
+// variables.
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Uploader uploads files to an S3 bucket, or an S3-compatible store such
+// as MinIO.
+type s3Uploader struct {
+	bucket    string
+	prefix    string
+	endpoint  string // Custom endpoint, e.g. https://minio.local:9000
+	region    string
+	sse       string // Server-side encryption: AES256 or aws:kms
+	kmsKey    string // KMS key ID for aws:kms
+	creds     s3Credentials
+	client    *http.Client
+	pathStyle bool // Bucket in the path rather than the hostname
+}
+
+func newS3Uploader(u *url.URL, args CollectCmd) (*s3Uploader, error) {
+	if u.Host == "" {
+		return nil, errors.New("S3 upload destination requires a bucket, e.g. s3://bucket/prefix")
+	}
+	s := &s3Uploader{
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		endpoint: strings.TrimSuffix(args.S3Endpoint, "/"),
+		region:   os.Getenv("AWS_REGION"),
+		sse:      args.S3SSE,
+		kmsKey:   args.S3KMSKey,
+		creds: s3Credentials{
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		client: &http.Client{Timeout: 30 * time.Minute},
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.endpoint == "" {
+		s.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.bucket, s.region)
+	} else {
+		s.pathStyle = true
+	}
+	if s.creds.accessKey == "" || s.creds.secretKey == "" {
+		return nil, errors.New("S3 upload requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	switch s.sse {
+	case "", "AES256", "aws:kms":
+	default:
+		return nil, fmt.Errorf("unknown server-side encryption %q, expected AES256 or aws:kms", s.sse)
+	}
+	if s.kmsKey != "" && s.sse != "aws:kms" {
+		return nil, errors.New("--s3-kms-key requires --s3-sse aws:kms")
+	}
+	return s, nil
+}
+
+// objectURL returns the URL for an object key.
+func (s *s3Uploader) objectURL(key string) string {
+	if s.pathStyle {
+		return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+	}
+	return fmt.Sprintf("%s/%s", s.endpoint, key)
+}
+
+// upload puts a file to the bucket under the prefix.
+func (s *s3Uploader) upload(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum, size, err := checksum(f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	key := path.Join(s.prefix, filepath.Base(file))
+	req, err := http.NewRequest("PUT", s.objectURL(key), f)
+	if err != nil {
+		return err
+	}
+	req.URL.RawPath = uriEncode(req.URL.Path)
+	req.ContentLength = size
+	req.Header.Set("x-amz-content-sha256", sum)
+	if s.sse != "" {
+		req.Header.Set("x-amz-server-side-encryption", s.sse)
+	}
+	if s.kmsKey != "" {
+		req.Header.Set("x-amz-server-side-encryption-aws-kms-key-id", s.kmsKey)
+	}
+	signV4(req, s.creds, s.region, "s3", time.Now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("HTTP status %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes a path per the SigV4 rules, escaping everything but
+// unreserved characters and slashes.
+func uriEncode(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signV4 signs a request with AWS Signature Version 4, signing the host and
+// all headers set on the request. The request must have the
+// x-amz-content-sha256 header set to the hash of the payload.
+func signV4(req *http.Request, creds s3Credentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// schedule determines the next run of a recurring collection.
+type schedule interface {
+	Next(time.Time) time.Time
+}
+
+// interval runs a collection at a fixed interval.
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// parseSchedule parses an interval, e.g. 24h, or a standard five field cron
+// expression, e.g. "0 2 * * *".
+func parseSchedule(s string) (schedule, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("schedule interval %s is less than one minute", d)
+		}
+		return interval(d), nil
+	}
+	sched, err := cron.ParseStandard(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: not an interval or cron expression: %v", s, err)
+	}
+	return sched, nil
+}
+
+// firstRun returns the time of the first collection: straight away on an
+// interval, and at the next time of a cron schedule, so that collections only
+// run in the window chosen.
+func firstRun(sched schedule, now time.Time) time.Time {
+	if _, ok := sched.(interval); ok {
+		return now
+	}
+	return sched.Next(now)
+}
+
+// timestamped adds a timestamp to the output filename, so that recurring
+// collections don't overwrite each other, e.g. aci-vetr-data_20190601T020000.zip
+func timestamped(path string, t time.Time) string {
+	base, ext := splitExt(path)
+	return fmt.Sprintf("%s_%s%s", base, t.Format("20060102T150405"), ext)
+}
+
+// runSchedule performs recurring collections until interrupted or the stop
+// channel is closed.
+func runSchedule(args CollectCmd, stop <-chan struct{}, log Logger) error {
+	sched, err := parseSchedule(args.Schedule)
+	if err != nil {
+		return err
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	// The control socket is kept open between the collections
+	state := newRunState()
+	if args.ControlAddr != "" {
+		ln, err := serveControl(args.ControlAddr, state, log)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		args.ControlAddr = ""
+	}
+
+	log.Info().Str("schedule", args.Schedule).Msg("Starting scheduled collection")
+	next := firstRun(sched, time.Now())
+	for {
+		if wait := time.Until(next); wait > 0 {
+			log.Info().Time("next_run", next).Msg("Waiting for next collection")
+			select {
+			case <-time.After(wait):
+			case <-sig:
+				log.Info().Msg("Scheduled collection stopped.")
+				return nil
+			case <-stop:
+				log.Info().Msg("Scheduled collection stopped.")
+				return nil
+			}
+			// Each archive only has the log of its own collection
+			if err := rotateLog(); err != nil {
+				log.Warn().Err(err).Msg("cannot start a new log file")
+			}
+		}
+		runArgs := args
+		if !isTemplate(args.Output) {
+			runArgs.Output = timestamped(args.Output, time.Now())
+		}
+		if err := fetchHttp(runArgs, state, log); isPartial(err) {
+			log.Warn().Err(err).Msg("scheduled collection incomplete")
+		} else if err != nil {
+			log.Error().Err(err).Msg("scheduled collection failed")
+		}
+
+		next = sched.Next(time.Now())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2019, 6, 1, 12, 30, 0, 0, time.Local)
+
+	sched, err := parseSchedule("6h")
+	a.NoError(err)
+	a.Equal(now.Add(6*time.Hour), sched.Next(now))
+
+	sched, err = parseSchedule("0 2 * * *")
+	a.NoError(err)
+	a.Equal(time.Date(2019, 6, 2, 2, 0, 0, 0, time.Local), sched.Next(now))
+
+	_, err = parseSchedule("10s")
+	a.Error(err)
+	_, err = parseSchedule("every day")
+	a.Error(err)
+}
+
+func TestTimestamped(t *testing.T) {
+	ts := time.Date(2019, 6, 1, 2, 0, 0, 0, time.UTC)
+	assert.Equal(t, "aci-vetr-data_20190601T020000.zip", timestamped("aci-vetr-data.zip", ts))
+	assert.Equal(t, "aci-vetr-data_20190601T020000.tar.zst", timestamped("aci-vetr-data.tar.zst", ts))
+}
+
+func TestFirstRun(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2019, 6, 1, 12, 30, 0, 0, time.Local)
+	sched, _ := parseSchedule("6h")
+	a.Equal(now, firstRun(sched, now))
+	// Cron schedules wait for their window rather than collecting on start
+	sched, _ = parseSchedule("0 2 * * *")
+	a.Equal(time.Date(2019, 6, 2, 2, 0, 0, 0, time.Local), firstRun(sched, now))
+}
+
+func TestRunScheduleCron(t *testing.T) {
+	a := assert.New(t)
+	var buf bytes.Buffer
+	stop := make(chan struct{})
+	close(stop)
+	a.NoError(runSchedule(CollectCmd{Schedule: "0 2 * * *"}, stop, zerolog.New(&buf)))
+	a.Contains(buf.String(), "Waiting for next collection")
+	// No collection was attempted
+	a.NotContains(buf.String(), "scheduled collection failed")
+	a.NotContains(buf.String(), "scheduled collection incomplete")
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// Collection script formats.
+const (
+	icurlFormat      = "icurl"
+	curlFormat       = "curl"
+	powershellFormat = "powershell"
+	ansibleFormat    = "ansible"
+	postmanFormat    = "postman"
+)
+
+// Collection script names by format.
+var scriptNames = map[string]string{
+	icurlFormat:      "vetr-collect.sh",
+	curlFormat:       "vetr-collect-curl.sh",
+	powershellFormat: "vetr-collect.ps1",
+	ansibleFormat:    "vetr-collect.yml",
+	postmanFormat:    "vetr-requests.postman_collection.json",
+}
+
+// Default objects per page in the collection scripts.
+const defaultPageSize = 10000
+
+// Attempts of each request in the collection scripts.
+const scriptAttempts = 3
+
+// Exit status of the collection scripts when some classes failed.
+const scriptPartial = 2
+
+// Shell functions of the bash scripts. Every request is checked and retried,
+// and a failed class is reported rather than leaving an empty file.
+const scriptFunctions = `set -o pipefail
+
+{setup}
+classes={classes}
+n=0
+failed=()
+
+# get <file> <path> [curl args]: a single request, retried on failure.
+# Fails on curl, HTTP and APIC errors.
+get() {
+  local file=$1 path=$2 attempt status
+  shift 2
+  for attempt in $(seq {attempts}); do
+    {prepare}
+    status=$({request} "$@" -o "$file" -w '%{http_code}')
+    if [ $? -eq 0 ] && [ "$status" = 200 ]; then
+      return 0
+    fi
+    # Client errors, e.g. classes the APIC version doesn't support, are final
+    case "$status" in 4*) break ;; esac
+    [ "$attempt" -lt {attempts} ] || break
+    echo "  request failed (HTTP ${status:-error}), retrying..." >&2
+    sleep $((attempt * 5))
+  done
+  # Keep the APIC error, or an empty file, for ingest to report
+  [ -f "$file" ] || : > "$file"
+  return 1
+}
+
+progress() {
+  n=$((n + 1))
+  echo "[$n/$classes] $1"
+}
+
+fail() {
+  failed+=("$1")
+  echo "  $1 failed" >&2
+}
+
+# fetch <prefix> <path> [curl args]: a class in pages, so that large classes
+# stay within the APIC's response limits.
+fetch() {
+  local prefix=$1 path=$2 page=0 total
+  shift 2
+  progress "$prefix"
+  while :; do
+    if ! get "$dir/$prefix.$page.json" "$path" "$@" -d page-size={pageSize} -d page=$page; then
+      fail "$prefix"
+      return
+    fi
+    total=$(head -c 100 "$dir/$prefix.$page.json" | sed -n 's/.*"totalCount":"\([0-9]*\)".*/\1/p')
+    page=$((page + 1))
+    [ -n "$total" ] && [ $((page * {pageSize})) -lt "$total" ] || break
+  done
+}
+
+# count <prefix> <path> [curl args]: a request for a single object, e.g. a
+# count.
+count() {
+  local prefix=$1 path=$2
+  shift 2
+  progress "$prefix"
+  get "$dir/$prefix.json" "$path" "$@" || fail "$prefix"
+}`
+
+// Setup of the curl script: the APIC and credentials, and logging in again
+// before the session expires.
+const curlSetup = `apic=${1:?usage: $0 <apic> [username]}
+user=${2:-admin}
+read -rsp "Password for $user@$apic: " pwd
+echo
+dir=$(mktemp -d) || exit 1
+cookies="$dir/cookies"
+
+# json <value>: escapes a JSON string value
+json() {
+  local s=${1//\\/\\\\}
+  printf '%s' "${s//\"/\\\"}"
+}
+
+# login: logs in to the APIC, keeping the session cookie
+login() {
+  local status
+  status=$(printf '{"aaaUser":{"attributes":{"name":"%s","pwd":"%s"}}}' "$(json "$user")" "$(json "$pwd")" |
+    curl -s -k -c "$cookies" -o /dev/null -w '%{http_code}' --data-binary @- "https://$apic/api/aaaLogin.json")
+  if [ "$status" != 200 ]; then
+    echo "Cannot log in to $apic (HTTP ${status:-error})" >&2
+    exit 1
+  fi
+  session=$SECONDS
+}
+login`
+
+// PowerShell script, for Windows PowerShell 5.1 and PowerShell 6 and later.
+// Every request is checked and retried, and a failed class is reported
+// rather than leaving an empty file.
+const powershellScript = `param(
+  [Parameter(Mandatory = $true)][string]$Apic,
+  [string]$Username = "admin"
+)
+$ErrorActionPreference = "Stop"
+$ProgressPreference = "SilentlyContinue"
+
+# The APIC's certificate is usually self-signed
+$tls = @{}
+if ($PSVersionTable.PSVersion.Major -ge 6) {
+  $tls = @{ SkipCertificateCheck = $true }
+} else {
+  Add-Type @"
+using System.Net;
+using System.Security.Cryptography.X509Certificates;
+public class TrustAllCertificates : ICertificatePolicy {
+  public bool CheckValidationResult(ServicePoint s, X509Certificate c, WebRequest r, int p) { return true; }
+}
+"@
+  [Net.ServicePointManager]::CertificatePolicy = New-Object TrustAllCertificates
+  [Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12
+}
+
+$credential = Get-Credential -UserName $Username -Message "APIC password"
+$dir = Join-Path ([IO.Path]::GetTempPath()) ("aci-vetr-" + [guid]::NewGuid())
+New-Item -ItemType Directory -Path $dir | Out-Null
+$classes = {classes}
+$n = 0
+$failed = @()
+
+# Login logs in to the APIC, keeping the session
+function Login {
+  $body = @{ aaaUser = @{ attributes = @{
+    name = $credential.UserName
+    pwd = $credential.GetNetworkCredential().Password
+  } } } | ConvertTo-Json -Depth 3
+  try {
+    Invoke-WebRequest -Uri "https://$Apic/api/aaaLogin.json" -Method Post -Body $body -SessionVariable s -UseBasicParsing @tls | Out-Null
+  } catch {
+    Write-Error "Cannot log in to ${Apic}: $($_.Exception.Message)"
+  }
+  $script:session = $s
+  $script:loginTime = Get-Date
+}
+
+# Get makes a single request, retried on failure. Fails on HTTP and APIC
+# errors.
+function Get($file, $path, $query) {
+  for ($attempt = 1; $attempt -le {attempts}; $attempt++) {
+    if (((Get-Date) - $script:loginTime).TotalSeconds -gt 300) { Login }
+    try {
+      Invoke-WebRequest -Uri "https://$Apic${path}?$query" -WebSession $script:session -OutFile $file -UseBasicParsing @tls
+      return $true
+    } catch {
+      $status = 0
+      if ($_.Exception.Response) { $status = [int]$_.Exception.Response.StatusCode }
+      # Keep the APIC error for ingest to report
+      if ($_.ErrorDetails.Message) { Set-Content -Path $file -Value $_.ErrorDetails.Message }
+      # Client errors, e.g. classes the APIC version doesn't support, are final
+      if ($status -ge 400 -and $status -lt 500) { break }
+      if ($attempt -lt {attempts}) {
+        Write-Warning "  request failed ($($_.Exception.Message)), retrying..."
+        Start-Sleep -Seconds ($attempt * 5)
+      }
+    }
+  }
+  if (-not (Test-Path $file)) { New-Item -ItemType File -Path $file | Out-Null }
+  return $false
+}
+
+function Progress($prefix) {
+  $script:n++
+  Write-Host "[$script:n/$classes] $prefix"
+}
+
+function Fail($prefix) {
+  $script:failed += $prefix
+  Write-Warning "  $prefix failed"
+}
+
+# Fetch gets a class in pages, so that large classes stay within the APIC's
+# response limits.
+function Fetch($prefix, $path, $query) {
+  Progress $prefix
+  for ($page = 0; ; $page++) {
+    $file = Join-Path $dir "$prefix.$page.json"
+    $params = "page-size={pageSize}&page=$page"
+    if ($query) { $params = "$query&$params" }
+    if (-not (Get $file $path $params)) {
+      Fail $prefix
+      return
+    }
+    $reader = New-Object IO.StreamReader($file)
+    $head = New-Object char[] 100
+    $read = $reader.Read($head, 0, 100)
+    $reader.Close()
+    if (-not ((-join $head[0..($read - 1)]) -match '"totalCount":"(\d+)"')) { return }
+    if (($page + 1) * {pageSize} -ge [int]$Matches[1]) { return }
+  }
+}
+
+# Count gets a single object, e.g. a count.
+function Count($prefix, $path, $query) {
+  Progress $prefix
+  if (-not (Get (Join-Path $dir "$prefix.json") $path $query)) { Fail $prefix }
+}
+
+Login
+
+# Fetch data from API
+{requests}
+
+# Zip result
+$final = Join-Path (Get-Location) "{final}"
+Remove-Item -Path $final -ErrorAction SilentlyContinue
+Compress-Archive -Path (Join-Path $dir "*.json") -DestinationPath $final
+
+# Cleanup
+Remove-Item -Recurse -Force -Path $dir
+
+if ($failed.Count -gt 0) {
+  Write-Host "Collection complete; $($failed.Count) of $classes classes failed: $($failed -join ' ')"
+  Write-Host "Provide Cisco Services the $final file, noting the failed classes."
+  exit {partial}
+}
+Write-Host "Collection complete."
+Write-Host "Provide Cisco Services the $final file."
+`
+
+// Ansible playbook collecting with uri tasks, for scheduling from Ansible
+// Tower or AWX. Failed requests are retried and reported as a failed play.
+const ansiblePlaybook = `# ACI vetR collection playbook.
+#
+#   ansible-playbook vetr-collect.yml -e apic=<apic> -e apic_username=<username> -e apic_password=<password>
+#
+# The password is best given from a vault or a Tower/AWX credential. The
+# results are zipped to vetr_output, aci-vetr-raw.zip next to the playbook
+# unless set, for aci-vetr-c ingest.
+- name: ACI vetR collection
+  hosts: localhost
+  connection: local
+  gather_facts: false
+  vars:
+    apic_username: admin
+    vetr_output: "{{ playbook_dir }}/aci-vetr-raw.zip"
+    vetr_page_size: {pageSize}
+    vetr_requests:
+{requests}
+  tasks:
+    - name: Check the APIC and credentials are set
+      assert:
+        that:
+          - apic is defined
+          - apic_password is defined
+        fail_msg: Set apic and apic_password, e.g. with -e
+
+    - name: Create a folder for the results
+      tempfile:
+        state: directory
+        prefix: aci-vetr-
+      register: vetr_dir
+
+{login}
+    - name: Fetch data from API
+      uri:
+        url: "https://{{ apic }}{{ item.path }}?{{ item.query }}{% if item.paged %}&page-size={{ vetr_page_size }}&page=0{% endif %}"
+        dest: "{{ vetr_dir.path }}/{{ item.prefix }}{{ '.0' if item.paged else '' }}.json"
+        headers:
+          Cookie: "APIC-cookie={{ vetr_token }}"
+        validate_certs: false
+        timeout: 300
+      register: vetr_fetch
+      # Client errors, e.g. classes the APIC version doesn't support, are final
+      until: vetr_fetch.status == 200 or (vetr_fetch.status >= 400 and vetr_fetch.status < 500)
+      retries: {attempts}
+      delay: 5
+      failed_when: false
+      loop: "{{ vetr_requests }}"
+      loop_control:
+        label: "{{ item.prefix }}"
+
+    - name: Read object counts
+      command: head -c 100 "{{ vetr_dir.path }}/{{ item.item.prefix }}.0.json"
+      register: vetr_heads
+      changed_when: false
+      loop: "{{ vetr_fetch.results | selectattr('status', 'equalto', 200) | selectattr('item.paged') | list }}"
+      loop_control:
+        label: "{{ item.item.prefix }}"
+
+    # Large classes are fetched in pages, so that they stay within the APIC's
+    # response limits
+    - name: Plan remaining pages
+      set_fact:
+        vetr_pages: "{{ vetr_pages | default([]) + [item.item.item] | product(range(1, (total | int + vetr_page_size | int - 1) // vetr_page_size | int)) | list }}"
+      vars:
+        total: "{{ item.stdout | regex_search('\"totalCount\":\"[0-9]+\"') | default('', true) | regex_replace('[^0-9]', '') }}"
+      loop: "{{ vetr_heads.results }}"
+      loop_control:
+        label: "{{ item.item.item.prefix }}"
+
+{login}
+    - name: Fetch remaining pages
+      uri:
+        url: "https://{{ apic }}{{ item.0.path }}?{{ item.0.query }}&page-size={{ vetr_page_size }}&page={{ item.1 }}"
+        dest: "{{ vetr_dir.path }}/{{ item.0.prefix }}.{{ item.1 }}.json"
+        headers:
+          Cookie: "APIC-cookie={{ vetr_token }}"
+        validate_certs: false
+        timeout: 300
+      register: vetr_fetch_pages
+      until: vetr_fetch_pages.status == 200 or (vetr_fetch_pages.status >= 400 and vetr_fetch_pages.status < 500)
+      retries: {attempts}
+      delay: 5
+      failed_when: false
+      loop: "{{ vetr_pages | default([]) }}"
+      loop_control:
+        label: "{{ item.0.prefix }} page {{ item.1 }}"
+
+    # Keep the APIC error, or an empty file, for ingest to report
+    - name: Record failed requests
+      copy:
+        content: ""
+        dest: "{{ vetr_dir.path }}/{{ item.prefix }}{{ '.0' if item.paged else '' }}.json"
+        force: false
+      loop: "{{ vetr_fetch.results | rejectattr('status', 'equalto', 200) | map(attribute='item') | list }}"
+      loop_control:
+        label: "{{ item.prefix }}"
+
+    - name: Record failed pages
+      copy:
+        content: ""
+        dest: "{{ vetr_dir.path }}/{{ item.0.prefix }}.{{ item.1 }}.json"
+        force: false
+      loop: "{{ vetr_fetch_pages.results | rejectattr('status', 'equalto', 200) | map(attribute='item') | list }}"
+      loop_control:
+        label: "{{ item.0.prefix }} page {{ item.1 }}"
+
+    - name: Zip result
+      archive:
+        path: "{{ vetr_dir.path }}/*.json"
+        dest: "{{ vetr_output }}"
+        format: zip
+
+    - name: Cleanup
+      file:
+        path: "{{ vetr_dir.path }}"
+        state: absent
+
+    - name: Report failed classes
+      fail:
+        msg: >-
+          Collection complete; {{ vetr_failed | length }} of {{ vetr_requests | length }} classes failed:
+          {{ vetr_failed | join(' ') }}. Provide Cisco Services the {{ vetr_output }} file, noting the failed classes.
+      vars:
+        vetr_failed: "{{ ((vetr_fetch.results | rejectattr('status', 'equalto', 200) | map(attribute='item.prefix') | list) + (vetr_fetch_pages.results | rejectattr('status', 'equalto', 200) | map(attribute='item.0.prefix') | list)) | unique }}"
+      when: vetr_failed | length > 0
+
+    - name: Collection complete
+      debug:
+        msg: Collection complete. Provide Cisco Services the {{ vetr_output }} file.
+`
+
+// Ansible task logging in to the APIC, before each set of requests so that
+// long collections don't outlive the session.
+const ansibleLogin = `    - name: Log in to the APIC
+      uri:
+        url: "https://{{ apic }}/api/aaaLogin.json"
+        method: POST
+        body_format: json
+        body:
+          aaaUser:
+            attributes:
+              name: "{{ apic_username }}"
+              pwd: "{{ apic_password }}"
+        validate_certs: false
+      register: vetr_login
+      no_log: true
+
+    - name: Keep the session token
+      set_fact:
+        vetr_token: "{{ vetr_login.json.imdata[0].aaaLogin.attributes.token }}"
+      no_log: true
+`
+
+// scriptRequest is a request of a collection script.
+type scriptRequest struct {
+	fn     string // Script function, i.e. fetch for paged requests or count
+	prefix string
+	path   string
+	query  url.Values
+}
+
+// scriptRequests returns the requests of the collection scripts. Counts are
+// a single object; anything else is ordered by DN for stable pages.
+func scriptRequests() []scriptRequest {
+	client := goaci.Client{}
+	var reqs []scriptRequest
+	for _, request := range collector.Requests() {
+		req := client.NewReq("GET", request.Path, nil, request.Mods...)
+		query := req.HttpReq.URL.Query()
+		fn := "count"
+		if request.Filter != "#.moCount.attributes" {
+			fn = "fetch"
+			query.Set("order-by", request.Class+".dn")
+		}
+		reqs = append(reqs, scriptRequest{
+			fn:     fn,
+			prefix: request.Prefix,
+			path:   req.HttpReq.URL.Path,
+			query:  query,
+		})
+	}
+	return reqs
+}
+
+// Write requests to script to be run on the APIC, with curl or PowerShell
+// from a workstation or with Ansible, or to a Postman collection.
+// Note, this is a more complicated collection methodology and should rarely
+// be used.
+func writeScript(cmd ICurlCmd, log Logger) error {
+	var script string
+	switch cmd.Format {
+	case "", icurlFormat:
+		cmd.Format = icurlFormat
+		script = icurlScript(cmd.PageSize, "/tmp/aci-vetr-collections", "~/aci-vetr-raw.zip")
+	case curlFormat:
+		script = curlScript(cmd.PageSize)
+	case powershellFormat:
+		script = psScript(cmd.PageSize)
+	case ansibleFormat:
+		script = ansibleScript(cmd.PageSize)
+	case postmanFormat:
+		var err error
+		if script, err = postmanScript(cmd.PageSize); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown script format %q, expected icurl, curl, powershell, ansible or postman", cmd.Format)
+	}
+	name := scriptNames[cmd.Format]
+	os.Remove(name)
+	err := ioutil.WriteFile(name, []byte(script), 0755)
+	if err != nil {
+		return err
+	}
+	switch cmd.Format {
+	case icurlFormat:
+		log.Info().Msgf("Script complete. Run %s on the APIC.", name)
+	case curlFormat:
+		log.Info().Msgf("Script complete. Run ./%s <apic> [username] from a workstation.", name)
+	case powershellFormat:
+		log.Info().Msgf("Script complete. Run .\\%s -Apic <apic> [-Username <username>] from a workstation.", name)
+	case ansibleFormat:
+		log.Info().Msgf("Playbook complete. Run ansible-playbook %s -e apic=<apic>, with the APIC credentials.", name)
+	case postmanFormat:
+		log.Info().Msgf("Requests complete. Import %s into Postman or Insomnia.", name)
+	}
+	return nil
+}
+
+// icurlScript returns a script fetching the requests on the APIC into a
+// temporary folder and zipping the results to final.
+func icurlScript(pageSize int, tmpFolder, final string) string {
+	return bashScript(pageSize, "dir="+tmpFolder, "", `icurl -s -kG "https://localhost$path"`, final)
+}
+
+// curlScript returns a script fetching the requests from a workstation with
+// curl and zipping the results to aci-vetr-raw.zip.
+func curlScript(pageSize int) string {
+	return bashScript(pageSize, curlSetup, `[ $((SECONDS - session)) -lt 300 ] || login`,
+		`curl -s -k -b "$cookies" -G "https://$apic$path"`, "aci-vetr-raw.zip")
+}
+
+// bashScript returns a bash collection script. The setup sets the folder for
+// the results, prepare runs before every request, and request is the curl
+// command for $path.
+func bashScript(pageSize int, setup, prepare, request, final string) string {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	reqs := scriptRequests()
+	replacements := []string{
+		"{setup}", setup,
+		"{request}", request,
+		"{classes}", strconv.Itoa(len(reqs)),
+		"{attempts}", strconv.Itoa(scriptAttempts),
+		"{pageSize}", strconv.Itoa(pageSize),
+	}
+	if prepare == "" {
+		replacements = append(replacements, "    {prepare}\n", "")
+	} else {
+		replacements = append(replacements, "{prepare}", prepare)
+	}
+	script := []string{
+		"#!/bin/bash",
+		"",
+		strings.NewReplacer(replacements...).Replace(scriptFunctions),
+		"",
+		`mkdir -p "$dir" || exit 1`,
+		"",
+		"# Fetch data from API",
+	}
+
+	for _, req := range reqs {
+		var params []string
+		for key, value := range req.query {
+			if len(value) >= 1 {
+				params = append(params, fmt.Sprintf("-d '%s=%s'", key, value[0]))
+			}
+		}
+		sort.Strings(params)
+		cmd := fmt.Sprintf("%s %s %s", req.fn, req.prefix, req.path)
+		if len(params) > 0 {
+			cmd += " " + strings.Join(params, " ")
+		}
+		script = append(script, cmd)
+	}
+
+	script = append(script, []string{
+		"",
+		"# Zip result",
+		"rm -f " + final,
+		fmt.Sprintf(`zip -qmj %s "$dir"/*.json || { echo "Cannot create %s" >&2; exit 1; }`, final, final),
+		"",
+		"# Cleanup",
+		`rm -rf "$dir"`,
+		"",
+		`if [ ${#failed[@]} -gt 0 ]; then`,
+		`  echo "Collection complete; ${#failed[@]} of $classes classes failed: ${failed[*]}"`,
+		fmt.Sprintf(`  echo "Provide Cisco Services the %s file, noting the failed classes."`, final),
+		fmt.Sprintf("  exit %d", scriptPartial),
+		"fi",
+		"echo Collection complete.",
+		fmt.Sprintf("echo Provide Cisco Services the %s file.", final),
+	}...)
+	return strings.Join(script, "\n")
+}
+
+// psScript returns a PowerShell script fetching the requests from a
+// workstation and zipping the results to aci-vetr-raw.zip.
+func psScript(pageSize int) string {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	reqs := scriptRequests()
+	quote := func(s string) string { return "'" + strings.Replace(s, "'", "''", -1) + "'" }
+	var lines []string
+	for _, req := range reqs {
+		name := strings.ToUpper(req.fn[:1]) + req.fn[1:]
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", name, quote(req.prefix), quote(req.path), quote(req.query.Encode())))
+	}
+	return strings.NewReplacer(
+		"{requests}", strings.Join(lines, "\n"),
+		"{classes}", strconv.Itoa(len(reqs)),
+		"{attempts}", strconv.Itoa(scriptAttempts),
+		"{pageSize}", strconv.Itoa(pageSize),
+		"{partial}", strconv.Itoa(scriptPartial),
+		"{final}", "aci-vetr-raw.zip",
+	).Replace(powershellScript)
+}
+
+// ansibleScript returns an Ansible playbook fetching the requests from the
+// control node and zipping the results.
+func ansibleScript(pageSize int) string {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	quote := func(s string) string { return "'" + strings.Replace(s, "'", "''", -1) + "'" }
+	var lines []string
+	for _, req := range scriptRequests() {
+		lines = append(lines, fmt.Sprintf("      - {prefix: %s, path: %s, query: %s, paged: %t}",
+			quote(req.prefix), quote(req.path), quote(req.query.Encode()), req.fn == "fetch"))
+	}
+	return strings.NewReplacer(
+		"{requests}", strings.Join(lines, "\n"),
+		"{login}", ansibleLogin,
+		"{attempts}", strconv.Itoa(scriptAttempts),
+		"{pageSize}", strconv.Itoa(pageSize),
+	).Replace(ansiblePlaybook)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestWriteScriptFormats(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	defer os.Remove(logFile)
+
+	// curl
+	err := writeScript(ICurlCmd{Format: curlFormat, PageSize: 500}, log)
+	a.NoError(err)
+	defer os.Remove(scriptNames[curlFormat])
+	b, err := ioutil.ReadFile(scriptNames[curlFormat])
+	if a.NoError(err) {
+		a.Contains(string(b), "\nlogin\n")
+		a.Contains(string(b), "fetch fvTenant /api/class/fvTenant.json -d 'order-by=fvTenant.dn'")
+		a.Contains(string(b), "-d page-size=500 -d page=$page")
+		a.NotContains(string(b), "icurl")
+	}
+
+	// PowerShell
+	err = writeScript(ICurlCmd{Format: powershellFormat}, log)
+	a.NoError(err)
+	defer os.Remove(scriptNames[powershellFormat])
+	b, err = ioutil.ReadFile(scriptNames[powershellFormat])
+	if a.NoError(err) {
+		a.Contains(string(b), "Fetch 'fvTenant' '/api/class/fvTenant.json' 'order-by=fvTenant.dn'")
+		a.Contains(string(b), "Count 'fvCEp' '/api/class/fvCEp.json' 'rsp-subtree-include=count'")
+		a.Contains(string(b), "page-size=10000&page=$page")
+	}
+
+	// Ansible
+	err = writeScript(ICurlCmd{Format: ansibleFormat}, log)
+	a.NoError(err)
+	defer os.Remove(scriptNames[ansibleFormat])
+	b, err = ioutil.ReadFile(scriptNames[ansibleFormat])
+	if a.NoError(err) {
+		a.Contains(string(b), "      - {prefix: 'fvTenant', path: '/api/class/fvTenant.json', query: 'order-by=fvTenant.dn', paged: true}\n")
+		a.Contains(string(b), "      - {prefix: 'fvCEp', path: '/api/class/fvCEp.json', query: 'rsp-subtree-include=count', paged: false}\n")
+		a.Contains(string(b), "    vetr_page_size: 10000\n")
+		a.Equal(2, strings.Count(string(b), "- name: Log in to the APIC"))
+	}
+
+	// Postman
+	err = writeScript(ICurlCmd{Format: postmanFormat}, log)
+	a.NoError(err)
+	defer os.Remove(scriptNames[postmanFormat])
+	b, err = ioutil.ReadFile(scriptNames[postmanFormat])
+	if a.NoError(err) {
+		items := gjson.GetBytes(b, "item")
+		a.Equal(len(collector.Requests())+1, len(items.Array()))
+		a.Equal("Login", items.Get("0.name").Str)
+		a.Equal("https://{{apic}}/api/class/fvTenant.json?order-by=fvTenant.dn&page-size=10000&page=0",
+			items.Get(`#(name=="fvTenant").request.url.raw`).Str)
+		a.Equal("https://{{apic}}/api/class/fvCEp.json?rsp-subtree-include=count",
+			items.Get(`#(name=="fvCEp").request.url.raw`).Str)
+		a.Equal("APIC-cookie={{token}}", items.Get(`1.request.header.0.value`).Str)
+	}
+
+	// Unknown format
+	err = writeScript(ICurlCmd{Format: "python"}, log)
+	a.Error(err)
+}
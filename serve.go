@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// apiCollect is the body of POST /collect.
+type apiCollect struct {
+	Connection
+	Preset string `json:"preset"`
+}
+
+// apiRun is a collection triggered through the API.
+type apiRun struct {
+	ID      string `json:"id"`
+	APIC    string `json:"apic"`
+	Status  string `json:"status"` // queued, running, success, partial or failed
+	Error   string `json:"error,omitempty"`
+	Queued  string `json:"queued"`
+	Start   string `json:"start,omitempty"`
+	End     string `json:"end,omitempty"`
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	archive string
+	state   *runState
+}
+
+// apiServer runs collections on demand for an internal portal. Collections
+// share the working directory for their intermediate files, so they run one
+// at a time; later requests are queued.
+type apiServer struct {
+	mu      sync.Mutex
+	collect sync.Mutex // Held by the running collection
+	token   string
+	dir     string
+	runs    map[string]*apiRun
+	log     Logger
+}
+
+func newAPIServer(dir, token string, log Logger) (*apiServer, error) {
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("cannot generate token: %v", err)
+		}
+		token = hex.EncodeToString(b)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create %s: %v", dir, err)
+	}
+	return &apiServer{
+		token: token,
+		dir:   dir,
+		runs:  make(map[string]*apiRun),
+		log:   log,
+	}, nil
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "collect":
+		s.handleCollect(w, r)
+	case path == "runs":
+		s.handleRuns(w, r)
+	case len(parts) == 2 && parts[0] == "runs":
+		s.handleRun(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "runs" && parts[2] == "archive":
+		s.handleArchive(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *apiServer) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body apiCollect
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := body.require(); err != nil {
+		http.Error(w, "apic, username and password are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := presetRequests(body.Preset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run := &apiRun{
+		ID:     newRunID(),
+		APIC:   body.APIC,
+		Status: "queued",
+		Queued: time.Now().Format(time.RFC3339),
+		state:  newRunState(),
+	}
+	run.archive = filepath.Join(s.dir, "aci-vetr-data-"+run.ID+".zip")
+	s.mu.Lock()
+	s.runs[run.ID] = run
+	s.mu.Unlock()
+	s.log.Info().Str("run_id", run.ID).Str("apic", run.APIC).Msg("Collection requested")
+
+	go s.run(run, CollectCmd{
+		Connection: body.Connection,
+		Preset:     body.Preset,
+		Output:     run.archive,
+		runID:      run.ID,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/runs/"+run.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(s.view(run))
+}
+
+// run collects once the previous collections are complete.
+func (s *apiServer) run(run *apiRun, args CollectCmd) {
+	s.collect.Lock()
+	defer s.collect.Unlock()
+	s.mu.Lock()
+	run.Status = "running"
+	run.Start = time.Now().Format(time.RFC3339)
+	s.mu.Unlock()
+
+	// Each run has its own log, so that its archive doesn't include the
+	// server's log or other runs
+	log := s.log.With().Str("run_id", run.ID).Logger()
+	args.logPath = filepath.Join(s.dir, "aci-vetr-c-"+run.ID+".log")
+	if f, err := os.OpenFile(args.logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err != nil {
+		// The archive has no log rather than the shared one
+		log.Warn().Err(err).Msgf("cannot create log file %s", args.logPath)
+	} else {
+		defer f.Close()
+		log = logTo(f).With().Str("run_id", run.ID).Logger()
+	}
+	err := fetchHttp(args, run.state, log)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.End = time.Now().Format(time.RFC3339)
+	switch {
+	case err == nil:
+		run.Status = "success"
+	case isPartial(err):
+		run.Status = "partial"
+		run.Error = err.Error()
+	default:
+		log.Error().Err(err).Msg("cannot fetch data from the API")
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+}
+
+// view returns a copy of a run with its progress.
+func (s *apiServer) view(run *apiRun) apiRun {
+	done, total := run.state.progress()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := *run
+	v.Done, v.Total = done, total
+	return v
+}
+
+// lookup returns a run by ID.
+func (s *apiServer) lookup(id string) (*apiRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	return run, ok
+}
+
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	var runs []*apiRun
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+	// Newest first; IDs are random, so ties are broken by ID for a stable order
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].Queued != runs[j].Queued {
+			return runs[i].Queued > runs[j].Queued
+		}
+		return runs[i].ID < runs[j].ID
+	})
+	views := []apiRun{}
+	for _, run := range runs {
+		views = append(views, s.view(run))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (s *apiServer) handleRun(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	run, ok := s.lookup(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.view(run))
+}
+
+func (s *apiServer) handleArchive(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	run, ok := s.lookup(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if status := s.view(run).Status; status != "success" && status != "partial" {
+		http.Error(w, "no archive available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", filepath.Base(run.archive)))
+	http.ServeFile(w, r, run.archive)
+}
+
+// serveAPI runs the API server until interrupted.
+func serveAPI(cmd ServeCmd, log Logger) error {
+	s, err := newAPIServer(cmd.Dir, cmd.Token, log)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", cmd.Addr)
+	if err != nil {
+		return fmt.Errorf("cannot start API server: %v", err)
+	}
+	srv := &http.Server{Handler: s}
+	if cmd.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cmd.TLSCert, cmd.TLSKey)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("cannot load TLS certificate: %v", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		go srv.ServeTLS(ln, "", "")
+		log.Info().Msgf("API server running at https://%s", ln.Addr())
+	} else {
+		go srv.Serve(ln)
+		log.Info().Msgf("API server running at http://%s", ln.Addr())
+		log.Warn().Msg("APIC credentials are sent to the API server unencrypted; use --tls-cert and --tls-key")
+	}
+	if cmd.Token == "" {
+		// Not logged, as the log is included in the archives
+		fmt.Fprintf(os.Stderr, "API token: %s\n", s.token)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	srv.Close()
+	log.Info().Msg("API server stopped.")
+	return nil
+}
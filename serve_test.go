@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIServer(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	s, err := newAPIServer(filepath.Join(dir, "runs"), "secret", zerolog.New(&bytes.Buffer{}))
+	if !a.NoError(err) {
+		return
+	}
+	// Hold the collection so the run stays queued
+	s.collect.Lock()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/runs", nil))
+	a.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = request("GET", "/runs", "")
+	a.Equal(http.StatusOK, rec.Code)
+	a.Equal("[]\n", rec.Body.String())
+
+	rec = request("POST", "/collect", `{"apic": "apic"}`)
+	a.Equal(http.StatusBadRequest, rec.Code)
+	rec = request("POST", "/collect", `{"apic": "apic", "username": "admin", "password": "pwd", "preset": "unknown"}`)
+	a.Equal(http.StatusBadRequest, rec.Code)
+	rec = request("GET", "/collect", "")
+	a.Equal(http.StatusMethodNotAllowed, rec.Code)
+
+	rec = request("POST", "/collect", `{"apic": "apic", "username": "admin", "password": "pwd"}`)
+	a.Equal(http.StatusAccepted, rec.Code)
+	var run apiRun
+	a.NoError(json.Unmarshal(rec.Body.Bytes(), &run))
+	a.Equal("queued", run.Status)
+	a.Equal("apic", run.APIC)
+	a.Equal("/runs/"+run.ID, rec.Header().Get("Location"))
+
+	rec = request("GET", "/runs/"+run.ID, "")
+	a.Equal(http.StatusOK, rec.Code)
+	rec = request("GET", "/runs/unknown", "")
+	a.Equal(http.StatusNotFound, rec.Code)
+
+	var runs []apiRun
+	a.NoError(json.Unmarshal(request("GET", "/runs", "").Body.Bytes(), &runs))
+	a.Len(runs, 1)
+
+	rec = request("GET", "/runs/"+run.ID+"/archive", "")
+	a.Equal(http.StatusNotFound, rec.Code)
+
+	// Once complete, the archive can be downloaded
+	r, _ := s.lookup(run.ID)
+	a.NoError(ioutil.WriteFile(r.archive, []byte("archive"), 0644))
+	s.mu.Lock()
+	r.Status = "success"
+	s.mu.Unlock()
+	rec = request("GET", "/runs/"+run.ID+"/archive", "")
+	a.Equal(http.StatusOK, rec.Code)
+	a.Equal("archive", rec.Body.String())
+	a.Contains(rec.Header().Get("Content-Disposition"), run.ID)
+}
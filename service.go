@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	serviceName        = "aci-vetr-c"
+	serviceDisplayName = "ACI vetR collector"
+)
+
+// serviceArgs are the command line parameters the service is started with.
+// Paths are made absolute, since services don't start in the current
+// working directory.
+func serviceArgs(config, schedule string) ([]string, error) {
+	config, err := filepath.Abs(config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve config file path: %v", err)
+	}
+	return []string{"--config", config, "collect", "--schedule", schedule}, nil
+}
+
+// serviceDir is the working directory for the service. Archives and logs are
+// written alongside the config file.
+func serviceDir(config string) (string, error) {
+	config, err := filepath.Abs(config)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve config file path: %v", err)
+	}
+	return filepath.Dir(config), nil
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const unitPath = "/etc/systemd/system/" + serviceName + ".service"
+
+// systemdUnit creates a systemd unit file for the collector.
+func systemdUnit(exe, dir string, args []string) string {
+	cmd := []string{fmt.Sprintf("%q", exe)}
+	for _, arg := range args {
+		cmd = append(cmd, fmt.Sprintf("%q", arg))
+	}
+	return strings.Join([]string{
+		"[Unit]",
+		"Description=" + serviceDisplayName,
+		"Wants=network-online.target",
+		"After=network-online.target",
+		"",
+		"[Service]",
+		"Type=simple",
+		"WorkingDirectory=" + dir,
+		"ExecStart=" + strings.Join(cmd, " "),
+		"Restart=on-failure",
+		"RestartSec=60",
+		"",
+		"[Install]",
+		"WantedBy=multi-user.target",
+		"",
+	}, "\n")
+}
+
+// installService registers the collector as a systemd service.
+func installService(config, schedule string, log Logger) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("service install is not supported on %s", runtime.GOOS)
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return errors.New("systemd is not running on this host")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find collector executable: %v", err)
+	}
+	sargs, err := serviceArgs(config, schedule)
+	if err != nil {
+		return err
+	}
+	dir, err := serviceDir(config)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(unitPath, []byte(systemdUnit(exe, dir, sargs)), 0644); err != nil {
+		return fmt.Errorf("cannot write unit file: %v", err)
+	}
+	log.Info().Str("path", unitPath).Msg("Unit file written")
+	for _, cmd := range [][]string{
+		{"systemctl", "daemon-reload"},
+		{"systemctl", "enable", "--now", serviceName},
+	} {
+		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(cmd, " "), err, out)
+		}
+	}
+	log.Info().Msgf("Service %s installed and started.", serviceName)
+	return nil
+}
+
+// enterService checks whether the collector was started by the platform
+// service manager. systemd services run as normal processes, in the working
+// directory of the unit.
+func enterService(config string) (bool, error) {
+	return false, nil
+}
+
+// runService runs the collector under the platform service manager.
+func runService(args CollectCmd, log Logger) error {
+	return runSchedule(args, nil, log)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	a := assert.New(t)
+	unit := systemdUnit("/opt/aci-vetr-c", "/etc/aci-vetr",
+		[]string{"--config", "/etc/aci-vetr/config.json", "--schedule", "0 2 * * *"})
+	a.True(strings.Contains(unit, `ExecStart="/opt/aci-vetr-c" "--config" "/etc/aci-vetr/config.json" "--schedule" "0 2 * * *"`))
+	a.True(strings.Contains(unit, "WorkingDirectory=/etc/aci-vetr\n"))
+}
@@ -0,0 +1,107 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers the collector as a Windows service.
+func installService(config, schedule string, log Logger) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find collector executable: %v", err)
+	}
+	sargs, err := serviceArgs(config, schedule)
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: "Scheduled ACI health check data collection",
+		StartType:   mgr.StartAutomatic,
+	}, sargs...)
+	if err != nil {
+		return fmt.Errorf("cannot create service: %v", err)
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("cannot start service: %v", err)
+	}
+	log.Info().Msgf("Service %s installed and started.", serviceName)
+	return nil
+}
+
+// service handles Windows service control requests.
+type service struct {
+	args CollectCmd
+	log  Logger
+}
+
+func (s service) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- runSchedule(s.args, stop, s.log)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				close(stop)
+				<-done
+				return false, 0
+			}
+		case err := <-done:
+			if err != nil {
+				s.log.Error().Err(err).Msg("scheduled collection failed")
+				return false, 1
+			}
+			return false, 0
+		}
+	}
+}
+
+// enterService checks whether the collector was started by the service
+// control manager and, if so, changes to the service directory, so that the
+// log and archives aren't written to the manager's working directory, e.g.
+// System32.
+func enterService(config string) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	dir, err := serviceDir(config)
+	if err != nil {
+		return true, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return true, fmt.Errorf("cannot change to service directory: %v", err)
+	}
+	return true, nil
+}
+
+// runService runs the collector under the service control manager.
+func runService(args CollectCmd, log Logger) error {
+	return svc.Run(serviceName, service{args: args, log: log})
+}
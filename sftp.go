@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Default private keys, in order of preference, relative to the home
+// directory.
+var sshKeys = []string{".ssh/id_ed25519", ".ssh/id_ecdsa", ".ssh/id_rsa"}
+
+// sftpUploader uploads files to a directory on an SFTP server.
+type sftpUploader struct {
+	addr   string
+	dir    string
+	config *ssh.ClientConfig
+}
+
+// sshKeyFile returns the configured private key, or the first default key
+// that exists.
+func sshKeyFile(key string) (string, error) {
+	if key != "" {
+		return key, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sshKeys {
+		if _, err := os.Stat(filepath.Join(home, name)); err == nil {
+			return filepath.Join(home, name), nil
+		}
+	}
+	return "", errors.New("no SSH private key found; set --ssh-key")
+}
+
+// sshSigner reads a private key.
+func sshSigner(keyFile string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SSH key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse SSH key %s: %v", keyFile, err)
+	}
+	return signer, nil
+}
+
+// sshHostKeys verifies host keys against a known hosts file, by default
+// ~/.ssh/known_hosts.
+func sshHostKeys(knownHosts string) (ssh.HostKeyCallback, error) {
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read known hosts: %v", err)
+	}
+	return hostKeys, nil
+}
+
+func newSFTPUploader(u *url.URL, args CollectCmd) (*sftpUploader, error) {
+	if u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, errors.New("SFTP upload destination requires a user and host, e.g. sftp://user@host/path")
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	keyFile, err := sshKeyFile(args.SSHKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := sshSigner(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := sshHostKeys(args.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpUploader{
+		addr: addr,
+		dir:  u.Path,
+		config: &ssh.ClientConfig{
+			User:            u.User.Username(),
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+// upload copies a file to the upload directory.
+func (s *sftpUploader) upload(file string) error {
+	conn, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", s.addr, err)
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("cannot start SFTP session: %v", err)
+	}
+	defer client.Close()
+
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := client.Create(path.Join(s.dir, filepath.Base(file)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// serveSFTP runs an SFTP server accepting a single client key.
+func serveSFTP(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) net.Listener {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					ch, requests, err := newChan.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for req := range requests {
+							req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+						}
+					}()
+					server, err := sftp.NewServer(ch)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					server.Close()
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestSFTPUpload(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	sshClientPub, _ := ssh.NewPublicKey(clientPub)
+	ln := serveSFTP(t, hostKey, sshClientPub)
+	defer ln.Close()
+
+	// Client key and known hosts
+	keyFile := filepath.Join(dir, "id_ed25519")
+	der, err := x509.MarshalPKCS8PrivateKey(clientPriv)
+	if !a.NoError(err) {
+		return
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	a.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{ln.Addr().String()}, hostKey.PublicKey())
+	a.NoError(ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0644))
+
+	drop := filepath.Join(dir, "drop")
+	a.NoError(os.Mkdir(drop, 0755))
+	file := filepath.Join(dir, "data.zip")
+	a.NoError(ioutil.WriteFile(file, []byte("archive"), 0644))
+
+	args := CollectCmd{SSHKey: keyFile, KnownHosts: knownHosts}
+	up, err := newUploader("sftp://collector@"+ln.Addr().String()+drop, args)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(uploadFiles([]uploader{up}, []string{file}, log))
+	b, err := ioutil.ReadFile(filepath.Join(drop, "data.zip"))
+	a.NoError(err)
+	a.Equal("archive", string(b))
+
+	// Unknown host key
+	other := filepath.Join(dir, "other_hosts")
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewSignerFromKey(otherPriv)
+	line = knownhosts.Line([]string{ln.Addr().String()}, otherKey.PublicKey())
+	a.NoError(ioutil.WriteFile(other, []byte(line+"\n"), 0644))
+	args.KnownHosts = other
+	up, err = newUploader("sftp://collector@"+ln.Addr().String()+drop, args)
+	if a.NoError(err) {
+		a.NoError(ioutil.WriteFile(file, []byte("archive"), 0644))
+		a.Error(up.upload(file))
+	}
+
+	_, err = newUploader("sftp://"+ln.Addr().String()+drop, args)
+	a.Error(err)
+}
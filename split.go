@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Suffix of the manifest for joining a split archive.
+const partsSuffix = ".parts.json"
+
+// Size units for --max-archive-size.
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// parseSize parses a size, e.g. 25MB.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 25MB", s)
+	}
+	return n * unit, nil
+}
+
+// partsManifest lists the parts of a split archive and their checksums.
+type partsManifest struct {
+	Archive string         `json:"archive"`
+	Size    int64          `json:"size"`
+	SHA256  string         `json:"sha256"`
+	Parts   []manifestFile `json:"parts"`
+}
+
+// splitArchive splits an archive larger than maxSize into numbered parts,
+// e.g. aci-vetr-data.zip.001, plus a manifest for joining them. It returns
+// the files to provide.
+func splitArchive(path string, maxSize int64, log Logger) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= maxSize {
+		return []string{path}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sum, size, err := checksum(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	m := partsManifest{Archive: filepath.Base(path), Size: size, SHA256: sum}
+	var files []string
+	for i := 1; int64(i-1)*maxSize < size; i++ {
+		part := fmt.Sprintf("%s.%03d", path, i)
+		if err := writePart(part, io.LimitReader(f, maxSize)); err != nil {
+			return nil, err
+		}
+		pf, err := os.Open(part)
+		if err != nil {
+			return nil, err
+		}
+		sum, n, err := checksum(pf)
+		pf.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", part, err)
+		}
+		m.Parts = append(m.Parts, manifestFile{Name: filepath.Base(part), Size: n, SHA256: sum})
+		files = append(files, part)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode parts manifest: %v", err)
+	}
+	manifest := path + partsSuffix
+	if err := ioutil.WriteFile(manifest, b, 0644); err != nil {
+		return nil, fmt.Errorf("cannot write %s: %v", manifest, err)
+	}
+	f.Close()
+	wipe(path)
+	log.Info().Int("parts", len(m.Parts)).Msgf("Split %s into parts", path)
+	return append(files, manifest), nil
+}
+
+func writePart(path string, r io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %v", path, err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("cannot write %s: %v", path, err)
+	}
+	return out.Close()
+}
+
+// isParts reports whether a path is the manifest of a split archive.
+func isParts(path string) bool {
+	return strings.HasSuffix(path, partsSuffix)
+}
+
+// joinArchive reassembles a split archive from its parts manifest, verifying
+// the checksum of each part and of the result. The parts must be in the same
+// directory as the manifest. If out is empty, the archive is written next
+// to the manifest.
+func joinArchive(manifest, out string) (string, error) {
+	b, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return "", fmt.Errorf("cannot read parts manifest: %v", err)
+	}
+	var m partsManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", fmt.Errorf("cannot parse parts manifest %s: %v", manifest, err)
+	}
+	dir := filepath.Dir(manifest)
+	if out == "" {
+		out = filepath.Join(dir, m.Archive)
+	}
+	f, err := os.OpenFile(out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("cannot create %s: %v", out, err)
+	}
+	defer f.Close()
+	for _, part := range m.Parts {
+		pf, err := os.Open(filepath.Join(dir, part.Name))
+		if err != nil {
+			return "", fmt.Errorf("missing part: %v", err)
+		}
+		sum, n, err := checksum(io.TeeReader(pf, f))
+		pf.Close()
+		if err != nil {
+			return "", fmt.Errorf("cannot join %s: %v", part.Name, err)
+		}
+		if sum != part.SHA256 || n != part.Size {
+			return "", fmt.Errorf("%s does not match the parts manifest; the part may be corrupt", part.Name)
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if sum, n, err := checksum(f); err != nil || sum != m.SHA256 || n != m.Size {
+		return "", fmt.Errorf("joined archive %s does not match the parts manifest", out)
+	}
+	return out, f.Close()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	a := assert.New(t)
+	for s, n := range map[string]int64{
+		"100":   100,
+		"25MB":  25 << 20,
+		"25 mb": 25 << 20,
+		"1GB":   1 << 30,
+		"512KB": 512 << 10,
+	} {
+		size, err := parseSize(s)
+		a.NoError(err, s)
+		a.Equal(n, size, s)
+	}
+	for _, s := range []string{"", "MB", "0", "25TB", "-1MB"} {
+		_, err := parseSize(s)
+		a.Error(err, s)
+	}
+}
+
+func TestSplitArchive(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "data.zip")
+	if !a.NoError(readRawFixture(dir, out, log)) {
+		return
+	}
+	original, err := ioutil.ReadFile(out)
+	a.NoError(err)
+
+	// Small archives aren't split
+	files, err := splitArchive(out, int64(len(original)), log)
+	a.NoError(err)
+	a.Equal([]string{out}, files)
+
+	files, err = splitArchive(out, 100, log)
+	if !a.NoError(err) {
+		return
+	}
+	parts := (len(original) + 99) / 100
+	a.Len(files, parts+1)
+	a.Equal(out+".001", files[0])
+	a.Equal(out+partsSuffix, files[parts])
+	a.NoFileExists(out)
+
+	// Split archives can be opened directly
+	db, closeDB, err := openDB(out + partsSuffix)
+	if a.NoError(err) {
+		counts, err := countRecords(db)
+		a.NoError(err)
+		a.Equal(2, counts["fvTenant"])
+		closeDB()
+	}
+
+	joined, err := joinArchive(out+partsSuffix, "")
+	a.NoError(err)
+	a.Equal(out, joined)
+	b, err := ioutil.ReadFile(joined)
+	a.NoError(err)
+	a.Equal(original, b)
+
+	// Corrupt part
+	a.NoError(ioutil.WriteFile(files[0], []byte("corrupt"), 0644))
+	_, err = joinArchive(out+partsSuffix, filepath.Join(dir, "joined.zip"))
+	a.Error(err)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshConfig authenticates to the APIC CLI with the APIC credentials, or the
+// SSH key if given.
+func sshConfig(args CollectCmd) (*ssh.ClientConfig, error) {
+	hostKeys, err := sshHostKeys(args.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	answer := func(_, _ string, questions []string, _ []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = args.Password
+		}
+		return answers, nil
+	}
+	auth := []ssh.AuthMethod{ssh.Password(args.Password), ssh.KeyboardInteractive(answer)}
+	if args.SSHKey != "" {
+		signer, err := sshSigner(args.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+		auth = append([]ssh.AuthMethod{ssh.PublicKeys(signer)}, auth...)
+	}
+	return &ssh.ClientConfig{
+		User:            args.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// logLines logs each line of the script output.
+func logLines(r io.Reader, level func() *zerolog.Event) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		level().Msg(scanner.Text())
+	}
+}
+
+// sshCollect runs the icurl script on the APIC over SSH, downloads its output
+// and builds the archive, for APICs whose API can't be reached.
+func sshCollect(args CollectCmd, log Logger) error {
+	// The first APIC, on the SSH port unless given
+	host := strings.TrimPrefix(strings.TrimPrefix(splitHosts(args.APIC)[0], "https://"), "http://")
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, "22")
+	}
+	config, err := sshConfig(args)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("host", addr).Str("user", args.Username).Msg("Connecting to the APIC over SSH...")
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("cannot start SFTP session: %v", err)
+	}
+	defer client.Close()
+
+	// Unique paths, so concurrent collections don't collide
+	id := newRunID()
+	var (
+		script = "/tmp/vetr-collect-" + id + ".sh"
+		raw    = "/tmp/aci-vetr-raw-" + id + ".zip"
+	)
+	f, err := client.Create(script)
+	if err != nil {
+		return fmt.Errorf("cannot copy script to the APIC: %v", err)
+	}
+	defer client.Remove(script)
+	_, err = f.Write([]byte(icurlScript(0, "/tmp/aci-vetr-"+id, raw)))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot copy script to the APIC: %v", err)
+	}
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("cannot start SSH session: %v", err)
+	}
+	defer session.Close()
+	stdout, _ := session.StdoutPipe()
+	stderr, _ := session.StderrPipe()
+	go logLines(stderr, log.Warn)
+	if err := session.Start("bash " + script); err != nil {
+		return fmt.Errorf("cannot run script on the APIC: %v", err)
+	}
+	logLines(stdout, log.Info)
+	defer client.Remove(raw)
+	err = session.Wait()
+	if exit, ok := err.(*ssh.ExitError); ok && exit.ExitStatus() == scriptPartial {
+		log.Warn().Msg("some classes failed on the APIC; continuing without them")
+	} else if err != nil {
+		return fmt.Errorf("script failed on the APIC: %v", err)
+	}
+
+	// Download the results
+	src, err := client.Open(raw)
+	if err != nil {
+		return fmt.Errorf("cannot download results: %v", err)
+	}
+	defer src.Close()
+	dst, err := ioutil.TempFile("", "aci-vetr-raw-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download results: %v", err)
+	}
+	output := expandOutput(args.Output, host, nil, time.Now())
+	return readRaw(dst.Name(), output, log)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Archive the script zips the results to.
+var scriptArchive = regexp.MustCompile(`zip -qmj (\S+) `)
+
+// serveAPICSSH runs an SSH server standing in for the APIC CLI. Running the
+// script copies the raw archive to where the script would create it, and
+// exits as if some classes failed.
+func serveAPICSSH(t *testing.T, hostKey ssh.Signer, raw string) net.Listener {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pwd []byte) (*ssh.Permissions, error) {
+			if c.User() != "admin" || string(pwd) != "secret" {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(ch ssh.Channel, command string) {
+		defer ch.Close()
+		status := uint32(scriptPartial)
+		b, err := ioutil.ReadFile(strings.TrimPrefix(command, "bash "))
+		m := scriptArchive.FindSubmatch(b)
+		if err != nil || m == nil {
+			status = 1
+		} else {
+			data, _ := ioutil.ReadFile(raw)
+			ioutil.WriteFile(string(m[1]), data, 0600)
+			ch.Write([]byte("[1/1] fvTenant\n"))
+		}
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					ch, requests, err := newChan.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for req := range requests {
+							switch req.Type {
+							case "subsystem":
+								req.Reply(string(req.Payload[4:]) == "sftp", nil)
+								server, err := sftp.NewServer(ch)
+								if err != nil {
+									return
+								}
+								go func() {
+									server.Serve()
+									server.Close()
+								}()
+							case "exec":
+								req.Reply(true, nil)
+								go run(ch, string(req.Payload[4:]))
+							default:
+								req.Reply(false, nil)
+							}
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestSSHCollect(t *testing.T) {
+	a := assert.New(t)
+	log := zerolog.New(&bytes.Buffer{})
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+	raw, err := writeRawFixture(dir)
+	if !a.NoError(err) {
+		return
+	}
+	ln := serveAPICSSH(t, hostKey, raw)
+	defer ln.Close()
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{ln.Addr().String()}, hostKey.PublicKey())
+	a.NoError(ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0644))
+
+	args := CollectCmd{Output: filepath.Join(dir, "aci-vetr-data.zip"), KnownHosts: knownHosts}
+	args.APIC = ln.Addr().String()
+	args.Username = "admin"
+	args.Password = "wrong"
+	a.Error(sshCollect(args, log))
+
+	args.Password = "secret"
+	if !a.NoError(sshCollect(args, log)) {
+		return
+	}
+	c, err := readCollection(args.Output)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal("icurl", c.meta.Get("source").Str)
+	a.Contains(c.records, "fvTenant:uni/tn-common")
+
+	// Unknown host key
+	a.NoError(ioutil.WriteFile(knownHosts, nil, 0644))
+	a.Error(sshCollect(args, log))
+}
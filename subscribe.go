@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// Classes subscribed to by default: faults and the audit log of
+// configuration changes.
+var defaultSubscriptions = []string{"faultInst", "aaaModLR"}
+
+// Subscriptions expire on the APIC unless refreshed within 60 seconds.
+const subscriptionRefresh = 30 * time.Second
+
+// Longest wait before reconnecting after the subscription fails.
+const maxReconnectWait = 5 * time.Minute
+
+// mergeDeltas merges the changes of an APIC event notification, e.g.
+//
+//	{"subscriptionId": ["72..."], "imdata": [{"faultInst": {"attributes": {...}}}]}
+//
+// into a collection db, under the class keys: created records are added,
+// modified records updated with the changed attributes and deleted records
+// removed. It returns the number of changes merged.
+func mergeDeltas(db *buntdb.DB, msg []byte) (int, error) {
+	if !gjson.ValidBytes(msg) {
+		return 0, errors.New("invalid event notification")
+	}
+	n := 0
+	err := db.Update(func(tx *buntdb.Tx) error {
+		var err error
+		gjson.GetBytes(msg, "imdata").ForEach(func(_, mo gjson.Result) bool {
+			mo.ForEach(func(class, body gjson.Result) bool {
+				err = mergeDelta(tx, class.Str, body.Get("attributes"))
+				n++
+				return err == nil
+			})
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// mergeDelta merges a single change into the record of its DN.
+func mergeDelta(tx *buntdb.Tx, class string, attrs gjson.Result) error {
+	key, ok := collector.RecordKey(class, 0, attrs)
+	if !ok {
+		return fmt.Errorf("%s change without a DN", class)
+	}
+	if attrs.Get("status").Str == "deleted" {
+		if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	record := make(map[string]interface{})
+	value, err := tx.Get(key)
+	switch err {
+	case nil:
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			return fmt.Errorf("invalid record %s: %v", key, err)
+		}
+	case buntdb.ErrNotFound:
+	default:
+		return err
+	}
+	// Modified records only have the changed attributes
+	for name, value := range attrs.Map() {
+		record[name] = value.Value()
+	}
+	// The status is that of the change; collected records have none
+	record["status"] = ""
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(record); err != nil {
+		return err
+	}
+	_, _, err = tx.Set(key, strings.TrimSuffix(buf.String(), "\n"), nil)
+	return err
+}
+
+// sessionToken returns the APIC session token of a logged in client.
+func sessionToken(client *goaci.Client) (string, error) {
+	u, err := url.Parse(client.Url)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range client.HttpClient.Jar.Cookies(u) {
+		if c.Name == "APIC-cookie" {
+			return c.Value, nil
+		}
+	}
+	return "", errors.New("no APIC session token")
+}
+
+// subscription is an open event subscription to an APIC.
+type subscription struct {
+	client *goaci.Client
+	ws     *wsConn
+	ids    []string
+}
+
+// openSubscription opens the event WebSocket of the active controller and
+// subscribes to the classes.
+func openSubscription(pool *collector.Pool, classes []string, log Logger) (*subscription, error) {
+	if err := pool.Login(); err != nil {
+		return nil, fmt.Errorf("cannot authenticate to the APIC: %v", err)
+	}
+	client := pool.Client()
+	token, err := sessionToken(client)
+	if err != nil {
+		return nil, err
+	}
+	// The APIC only sends notifications to the WebSocket of the session
+	wsURL := "ws" + strings.TrimPrefix(client.Url, "http") + "/socket" + token
+	ws, err := dialWebSocket(wsURL, &tls.Config{InsecureSkipVerify: true}, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the APIC WebSocket: %v", err)
+	}
+	s := &subscription{client: client, ws: ws}
+	for _, class := range classes {
+		res, err := client.Get("/api/class/"+class, goaci.Query("subscription", "yes"),
+			goaci.Query("page-size", "1"))
+		if err != nil {
+			ws.Close()
+			return nil, fmt.Errorf("cannot subscribe to %s: %v", class, err)
+		}
+		s.ids = append(s.ids, res.Get("subscriptionId").Str)
+		log.Info().Str("class", class).Msg("Subscribed")
+	}
+	return s, nil
+}
+
+// refresh keeps the subscriptions alive until done is closed, closing the
+// WebSocket if a refresh fails.
+func (s *subscription) refresh(done <-chan struct{}, log Logger) {
+	ticker := time.NewTicker(subscriptionRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for _, id := range s.ids {
+			if _, err := s.client.Get("/api/subscriptionRefresh", goaci.Query("id", id)); err != nil {
+				log.Warn().Err(err).Msg("cannot refresh subscription")
+				s.ws.Close()
+				return
+			}
+		}
+	}
+}
+
+// stream merges the changes into db until the WebSocket fails or closes.
+func (s *subscription) stream(db *buntdb.DB, log Logger) error {
+	done := make(chan struct{})
+	defer close(done)
+	go s.refresh(done, log)
+	for {
+		msg, err := s.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		n, err := mergeDeltas(db, msg)
+		if err != nil {
+			return fmt.Errorf("cannot merge changes: %v", err)
+		}
+		log.Debug().Int("changes", n).Msg("event notification")
+	}
+}
+
+// subscribe streams changes to the classes from the APIC, merging them into
+// the collection db between full collections, until interrupted.
+func subscribe(cmd SubscribeCmd, log Logger) error {
+	// buntdb would create an empty db, without the collection to update
+	if _, err := os.Stat(cmd.DB); err != nil {
+		return fmt.Errorf("cannot open %s: %v", cmd.DB, err)
+	}
+	db, err := buntdb.Open(cmd.DB)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", cmd.DB, err)
+	}
+	defer db.Close()
+
+	runID := newRunID()
+	hosts := splitHosts(cmd.APIC)
+	pool := collector.NewPool(hosts, cmd.Username, cmd.Password, log, cmd.Connection.clientMods(runID)...)
+	log.Info().Strs("hosts", hosts).Strs("classes", cmd.Classes).Str("db", cmd.DB).
+		Str("run_id", runID).Msg("Subscribing to changes")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	wait := 10 * time.Second
+	for {
+		s, err := openSubscription(pool, cmd.Classes, log)
+		if err == nil {
+			wait = 10 * time.Second
+			errc := make(chan error, 1)
+			go func() { errc <- s.stream(db, log) }()
+			select {
+			case err = <-errc:
+				s.ws.Close()
+			case <-sig:
+				s.ws.Close()
+				log.Info().Msg("Subscription stopped.")
+				return nil
+			}
+		}
+		log.Warn().Err(err).Msgf("subscription failed; reconnecting in %s", wait)
+		select {
+		case <-time.After(wait):
+		case <-sig:
+			log.Info().Msg("Subscription stopped.")
+			return nil
+		}
+		if wait *= 2; wait > maxReconnectWait {
+			wait = maxReconnectWait
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+)
+
+func TestMergeDeltas(t *testing.T) {
+	a := assert.New(t)
+	db, err := buntdb.Open(":memory:")
+	if !a.NoError(err) {
+		return
+	}
+	defer db.Close()
+	db.Update(func(tx *buntdb.Tx) error {
+		tx.Set("faultInst:topology/pod-1/node-101/fault-F0532", `{"dn":"topology/pod-1/node-101/fault-F0532","severity":"major","status":""}`, nil)
+		tx.Set("faultInst:topology/pod-1/node-102/fault-F0532", `{"dn":"topology/pod-1/node-102/fault-F0532","severity":"major","status":""}`, nil)
+		return nil
+	})
+
+	msg := `{"subscriptionId": ["72"], "imdata": [
+		{"faultInst": {"attributes": {"dn": "topology/pod-1/node-101/fault-F0532", "status": "modified", "severity": "cleared"}}},
+		{"faultInst": {"attributes": {"dn": "topology/pod-1/node-102/fault-F0532", "status": "deleted"}}},
+		{"aaaModLR": {"attributes": {"dn": "subj-[uni/tn-a]/mod-1", "status": "created", "descr": "BD <a> created"}}}
+	]}`
+	n, err := mergeDeltas(db, []byte(msg))
+	a.NoError(err)
+	a.Equal(3, n)
+	records, err := readRecords(db)
+	a.NoError(err)
+	a.Equal(map[string]string{
+		"faultInst:topology/pod-1/node-101/fault-F0532": `{"dn":"topology/pod-1/node-101/fault-F0532","severity":"cleared","status":""}`,
+		"aaaModLR:subj-[uni/tn-a]/mod-1":                `{"descr":"BD <a> created","dn":"subj-[uni/tn-a]/mod-1","status":""}`,
+	}, records)
+
+	_, err = mergeDeltas(db, []byte("{"))
+	a.Error(err)
+	_, err = mergeDeltas(db, []byte(`{"imdata": [{"faultInst": {"attributes": {"status": "created"}}}]}`))
+	a.EqualError(err, "faultInst change without a DN")
+}
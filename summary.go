@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// Policy classes included in the modification time summary.
+var policyClasses = []string{
+	"fvTenant",
+	"fvAEPg",
+	"fvBD",
+	"fvCtx",
+	"fvSubnet",
+	"vzBrCP",
+	"vzFilter",
+	"vzSubj",
+	"l3extOut",
+	"l3extInstP",
+}
+
+// modTsStats aggregates modification times for a set of objects.
+type modTsStats struct {
+	Objects       int       `json:"objects"`
+	FirstModified time.Time `json:"firstModified"`
+	LastModified  time.Time `json:"lastModified"`
+	Changed7d     int       `json:"changed7d"`  // Modified in the last 7 days
+	Changed30d    int       `json:"changed30d"` // Modified in the last 30 days
+}
+
+func (s *modTsStats) add(ts, now time.Time) {
+	s.Objects++
+	if s.FirstModified.IsZero() || ts.Before(s.FirstModified) {
+		s.FirstModified = ts
+	}
+	if ts.After(s.LastModified) {
+		s.LastModified = ts
+	}
+	age := now.Sub(ts)
+	if age <= 7*24*time.Hour {
+		s.Changed7d++
+	}
+	if age <= 30*24*time.Hour {
+		s.Changed30d++
+	}
+}
+
+// tenantModTs is the modification time summary for a single tenant.
+type tenantModTs struct {
+	modTsStats
+	Classes map[string]*modTsStats `json:"classes"`
+}
+
+// tenantName extracts the tenant from a DN, e.g. uni/tn-common/BD-default.
+func tenantName(dn string) string {
+	if !strings.HasPrefix(dn, "uni/tn-") {
+		return ""
+	}
+	name := strings.TrimPrefix(dn, "uni/tn-")
+	if i := strings.Index(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// modTsSummary aggregates the modTs of key policy classes per tenant.
+func modTsSummary(responses map[string]goaci.Res, now time.Time) map[string]*tenantModTs {
+	tenants := make(map[string]*tenantModTs)
+	for _, class := range policyClasses {
+		res, ok := responses[class]
+		if !ok {
+			continue
+		}
+		for _, record := range res.Array() {
+			tenant := tenantName(record.Get("dn").Str)
+			ts, err := time.Parse(time.RFC3339Nano, record.Get("modTs").Str)
+			if tenant == "" || err != nil {
+				continue
+			}
+			summary, ok := tenants[tenant]
+			if !ok {
+				summary = &tenantModTs{Classes: make(map[string]*modTsStats)}
+				tenants[tenant] = summary
+			}
+			stats, ok := summary.Classes[class]
+			if !ok {
+				stats = &modTsStats{}
+				summary.Classes[class] = stats
+			}
+			stats.add(ts, now)
+			summary.add(ts, now)
+		}
+	}
+	return tenants
+}
+
+// buildSummary creates the summary record stored alongside the collection.
+func buildSummary(responses map[string]goaci.Res, preset string) (string, error) {
+	summary := map[string]interface{}{
+		"modTs": modTsSummary(responses, time.Now()),
+	}
+	if preset == upgradeReadiness {
+		summary["upgradeReadiness"] = upgradeReadinessSummary(responses)
+	}
+	b, err := json.Marshal(summary)
+	return string(b), err
+}
+
+// standbySummary lists standby controllers and their state for the metadata.
+func standbySummary(standby goaci.Res) string {
+	nodes := goaci.Body{Str: "[]"}
+	for i, node := range standby.Array() {
+		nodes = nodes.SetRaw(fmt.Sprintf("%d", i), goaci.Body{}.
+			Set("name", node.Get("name").Str).
+			Set("serial", node.Get("mbSn").Str).
+			Set("oobIpAddr", node.Get("oobIpAddr").Str).
+			Set("operSt", node.Get("operSt").Str).
+			Str)
+	}
+	return goaci.Body{}.
+		Set("count", fmt.Sprintf("%d", len(standby.Array()))).
+		SetRaw("nodes", nodes.Str).
+		Str
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestModTsSummary(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	responses := map[string]goaci.Res{
+		"fvBD": gjson.Parse(`[
+			{"dn": "uni/tn-a/BD-one", "modTs": "2019-05-30T10:00:00.000+00:00"},
+			{"dn": "uni/tn-a/BD-two", "modTs": "2017-01-01T10:00:00.000+00:00"},
+			{"dn": "uni/tn-b/BD-one", "modTs": "never"}
+		]`),
+		"fvAEPg": gjson.Parse(`[
+			{"dn": "uni/tn-a/ap-app/epg-web", "modTs": "2019-05-10T10:00:00.000+00:00"}
+		]`),
+	}
+	summary := modTsSummary(responses, now)
+	a.Len(summary, 1)
+	if tenant, ok := summary["a"]; a.True(ok) {
+		a.Equal(3, tenant.Objects)
+		a.Equal(1, tenant.Changed7d)
+		a.Equal(2, tenant.Changed30d)
+		a.Equal(2017, tenant.FirstModified.Year())
+		a.Equal(30, tenant.LastModified.Day())
+		a.Equal(2, tenant.Classes["fvBD"].Objects)
+		a.Equal(1, tenant.Classes["fvAEPg"].Objects)
+	}
+}
+
+func TestTenantName(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("common", tenantName("uni/tn-common/BD-default"))
+	a.Equal("common", tenantName("uni/tn-common"))
+	a.Equal("", tenantName("topology/pod-1/node-101"))
+}
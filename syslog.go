@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Syslog facility for collector events (user-level messages).
+const syslogFacility = 1
+
+// RFC 5424 timestamp with the maximum precision allowed.
+const syslogTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogSeverity maps log levels to syslog severities.
+var syslogSeverity = map[zerolog.Level]int{
+	zerolog.DebugLevel: 7,
+	zerolog.InfoLevel:  6,
+	zerolog.WarnLevel:  4,
+	zerolog.ErrorLevel: 3,
+	zerolog.FatalLevel: 2,
+	zerolog.PanicLevel: 0,
+}
+
+// syslogHook forwards info and higher log messages to a syslog server as
+// RFC 5424 messages over UDP, TCP or TLS.
+type syslogHook struct {
+	mu       sync.Mutex
+	network  string // udp, tcp or tls
+	addr     string
+	hostname string
+	conn     net.Conn
+}
+
+// newSyslogHook connects to a syslog server, e.g. udp://host:514,
+// tcp://host:601 or tls://host:6514.
+func newSyslogHook(rawurl string) (*syslogHook, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	ports := map[string]string{"udp": "514", "tcp": "601", "tls": "6514"}
+	port, ok := ports[u.Scheme]
+	if !ok || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid syslog server %q, expected udp://, tcp:// or tls://host:port", rawurl)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	h := &syslogHook{
+		network:  u.Scheme,
+		addr:     net.JoinHostPort(u.Hostname(), port),
+		hostname: hostname,
+	}
+	if err := h.connect(); err != nil {
+		return nil, fmt.Errorf("cannot connect to syslog server %s: %v", h.addr, err)
+	}
+	return h, nil
+}
+
+func (h *syslogHook) connect() error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if h.network == "tls" {
+		host, _, _ := net.SplitHostPort(h.addr)
+		conn, err := tls.DialWithDialer(dialer, "tcp", h.addr, &tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+		return nil
+	}
+	conn, err := dialer.Dial(h.network, h.addr)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+// format builds an RFC 5424 message. Stream transports use octet-counting
+// framing (RFC 6587 and RFC 5425).
+func (h *syslogHook) format(level zerolog.Level, msg string, t time.Time) []byte {
+	pri := syslogFacility*8 + syslogSeverity[level]
+	line := fmt.Sprintf("<%d>1 %s %s aci-vetr-c %d - - %s",
+		pri, t.Format(syslogTime), h.hostname, os.Getpid(), msg)
+	if h.network != "udp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	return []byte(line)
+}
+
+// Run sends a log message. Errors are ignored, other than reconnecting once,
+// as syslog forwarding must not interrupt the collection.
+func (h *syslogHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.InfoLevel || msg == "" {
+		return
+	}
+	b := h.format(level, msg, time.Now())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		if _, err := h.conn.Write(b); err == nil {
+			return
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+	if err := h.connect(); err == nil {
+		h.conn.Write(b)
+	}
+}
+
+// Close closes the connection to the syslog server.
+func (h *syslogHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	return h.conn.Close()
+}
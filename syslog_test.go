@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	a := assert.New(t)
+	h := &syslogHook{network: "udp", hostname: "collector"}
+	ts := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	msg := fmt.Sprintf("<11>1 2024-05-01T02:00:00.000000Z collector aci-vetr-c %d - - Collection failed.", os.Getpid())
+	a.Equal(msg, string(h.format(zerolog.ErrorLevel, "Collection failed.", ts)))
+
+	h.network = "tcp"
+	a.Equal(fmt.Sprintf("%d %s", len(msg), msg), string(h.format(zerolog.ErrorLevel, "Collection failed.", ts)))
+}
+
+func TestSyslogHook(t *testing.T) {
+	a := assert.New(t)
+	_, err := newSyslogHook("http://localhost")
+	a.Error(err)
+
+	// UDP
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	a.NoError(err)
+	defer pc.Close()
+	h, err := newSyslogHook("udp://" + pc.LocalAddr().String())
+	a.NoError(err)
+	log := zerolog.New(zerolog.Nop()).Hook(h)
+	log.Debug().Msg("debug_test")
+	log.Info().Msg("info_test")
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	a.NoError(err)
+	a.Contains(string(buf[:n]), "- - info_test")
+	h.Close()
+
+	// TCP, with octet-counting framing
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+	defer ln.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var n int
+		if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		io.ReadFull(r, msg)
+		lines <- string(msg)
+	}()
+	h, err = newSyslogHook("tcp://" + ln.Addr().String())
+	a.NoError(err)
+	defer h.Close()
+	log = zerolog.New(zerolog.Nop()).Hook(h)
+	log.Warn().Msg("request failed.")
+	select {
+	case line := <-lines:
+		a.True(strings.HasPrefix(line, "<12>1 "))
+		a.True(strings.HasSuffix(line, "- - request failed."))
+	case <-time.After(5 * time.Second):
+		a.Fail("no message received")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// Prefix for the pre-aggregated per-leaf contract relation counts.
+const contractsPerLeaf = "contractsPerLeaf"
+
+// leafContracts counts the contract relations of EPGs deployed on a leaf.
+type leafContracts struct {
+	dn       string
+	epgs     int
+	provided int
+	consumed int
+}
+
+// parseLocale parses an EPG deployment DN, e.g.
+// uni/epp/fv-[uni/tn-a/ap-b/epg-c]/node-101
+func parseLocale(dn string) (epg, node string, ok bool) {
+	start := strings.Index(dn, "fv-[")
+	end := strings.LastIndex(dn, "]/node-")
+	if start < 0 || end < start {
+		return "", "", false
+	}
+	return dn[start+len("fv-[") : end], dn[end+len("]/node-"):], true
+}
+
+// relationParent returns the DN of the EPG for a relation, e.g.
+// uni/tn-a/ap-b/epg-c/rsprov-ctr
+func relationParent(dn string) string {
+	if i := strings.LastIndex(dn, "/"); i >= 0 {
+		return dn[:i]
+	}
+	return dn
+}
+
+// countRelations counts relations per EPG DN.
+func countRelations(res goaci.Res) map[string]int {
+	counts := make(map[string]int)
+	for _, record := range res.Array() {
+		counts[relationParent(record.Get("dn").Str)]++
+	}
+	return counts
+}
+
+// aggregateContracts combines EPG deployment with the provided and consumed
+// contract relations of each EPG to count relations per leaf.
+func aggregateContracts(locales goaci.Res, responses map[string]goaci.Res) []*leafContracts {
+	provided := countRelations(responses["fvRsProv"])
+	consumed := countRelations(responses["fvRsCons"])
+
+	// Node ID to DN, e.g. 101 -> topology/pod-1/node-101
+	nodes := make(map[string]string)
+	for _, node := range responses["fabricNode"].Array() {
+		nodes[node.Get("id").Str] = node.Get("dn").Str
+	}
+
+	leaves := make(map[string]*leafContracts)
+	for _, locale := range locales.Array() {
+		epg, node, ok := parseLocale(locale.Get("dn").Str)
+		if !ok {
+			continue
+		}
+		leaf, ok := leaves[node]
+		if !ok {
+			dn, ok := nodes[node]
+			if !ok {
+				dn = "node-" + node
+			}
+			leaf = &leafContracts{dn: dn}
+			leaves[node] = leaf
+		}
+		leaf.epgs++
+		leaf.provided += provided[epg]
+		leaf.consumed += consumed[epg]
+	}
+
+	var result []*leafContracts
+	for _, leaf := range leaves {
+		result = append(result, leaf)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].dn < result[j].dn })
+	return result
+}
+
+// contractRecords converts the aggregated counts to records for the DB.
+func contractRecords(leaves []*leafContracts) goaci.Res {
+	body := goaci.Body{Str: "[]"}
+	for i, leaf := range leaves {
+		body = body.SetRaw(fmt.Sprintf("%d", i), goaci.Body{}.
+			Set("dn", leaf.dn).
+			Set("epgs", fmt.Sprintf("%d", leaf.epgs)).
+			Set("provided", fmt.Sprintf("%d", leaf.provided)).
+			Set("consumed", fmt.Sprintf("%d", leaf.consumed)).
+			Str)
+	}
+	return gjson.Parse(body.Str)
+}
+
+// fetchContractCounts queries EPG deployment and stores per-leaf contract
+// relation counts for TCAM growth prediction. Only the aggregate is stored,
+// not the deployment objects, which are very large on big fabrics.
+func fetchContractCounts(client collector.Getter, responses map[string]goaci.Res, log Logger) error {
+	log.Info().Str("resource", contractsPerLeaf).Msg("fetching resource...")
+	res, err := client.Get("/api/class/fvLocale")
+	if err != nil {
+		return fmt.Errorf("cannot query EPG deployment: %v", err)
+	}
+	leaves := aggregateContracts(res.Get("imdata.#.fvLocale.attributes"), responses)
+	responses[contractsPerLeaf] = contractRecords(leaves)
+	return nil
+}
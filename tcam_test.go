@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseLocale(t *testing.T) {
+	a := assert.New(t)
+	epg, node, ok := parseLocale("uni/epp/fv-[uni/tn-a/ap-b/epg-c]/node-101")
+	a.True(ok)
+	a.Equal("uni/tn-a/ap-b/epg-c", epg)
+	a.Equal("101", node)
+	_, _, ok = parseLocale("uni/tn-a")
+	a.False(ok)
+}
+
+func TestAggregateContracts(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fabricNode": gjson.Parse(`[{"id": "101", "dn": "topology/pod-1/node-101"}]`),
+		"fvRsProv": gjson.Parse(`[
+			{"dn": "uni/tn-a/ap-b/epg-web/rsprov-http"},
+			{"dn": "uni/tn-a/ap-b/epg-web/rsprov-https"}
+		]`),
+		"fvRsCons": gjson.Parse(`[
+			{"dn": "uni/tn-a/ap-b/epg-app/rscons-http"}
+		]`),
+	}
+	locales := gjson.Parse(`[
+		{"dn": "uni/epp/fv-[uni/tn-a/ap-b/epg-web]/node-101"},
+		{"dn": "uni/epp/fv-[uni/tn-a/ap-b/epg-app]/node-101"},
+		{"dn": "uni/epp/fv-[uni/tn-a/ap-b/epg-app]/node-102"}
+	]`)
+	records := contractRecords(aggregateContracts(locales, responses))
+	a.Len(records.Array(), 2)
+	a.Equal("node-102", records.Get("0.dn").Str)
+	a.Equal("1", records.Get("0.consumed").Str)
+	a.Equal("topology/pod-1/node-101", records.Get("1.dn").Str)
+	a.Equal("2", records.Get("1.epgs").Str)
+	a.Equal("2", records.Get("1.provided").Str)
+	a.Equal("1", records.Get("1.consumed").Str)
+}
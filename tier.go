@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/brightpuddle/goaci"
+
+	"aci-vetr-c/collector"
+)
+
+// Data sensitivity tiers for split archives.
+const (
+	configTier    = "config"
+	sensitiveTier = "sensitive"
+)
+
+// splitTiers separates potentially sensitive operational data, e.g.
+// endpoints, events and audit logs, from configuration and policy data. The
+// tier of a response is that of the requests that produced it; if any of them
+// is sensitive, e.g. a sensitive follow-up query sharing a prefix, the
+// response is.
+func splitTiers(responses map[string]goaci.Res, reqs []*collector.Request) (config, sensitive map[string]goaci.Res) {
+	isSensitive := make(map[string]bool)
+	for _, req := range reqs {
+		isSensitive[req.Prefix] = isSensitive[req.Prefix] || req.Sensitive
+	}
+	config = make(map[string]goaci.Res)
+	sensitive = make(map[string]goaci.Res)
+	for prefix, res := range responses {
+		if isSensitive[prefix] {
+			sensitive[prefix] = res
+		} else {
+			config[prefix] = res
+		}
+	}
+	return config, sensitive
+}
+
+// derivedRequests registers responses that aren't the records of a catalog
+// request, e.g. the contracts per leaf or the NDO objects, so that they're
+// split by their own tier.
+func derivedRequests(responses map[string]goaci.Res, sensitive bool) []*collector.Request {
+	var reqs []*collector.Request
+	for prefix := range responses {
+		reqs = append(reqs, &collector.Request{Prefix: prefix, Sensitive: sensitive})
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Prefix < reqs[j].Prefix })
+	return reqs
+}
+
+// sensitiveOutput is the archive name for the sensitive tier, e.g.
+// aci-vetr-data-sensitive.zip
+func sensitiveOutput(path string) string {
+	base, ext := splitExt(path)
+	return base + "-" + sensitiveTier + ext
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+func TestSplitTiers(t *testing.T) {
+	a := assert.New(t)
+	responses := map[string]goaci.Res{
+		"fvTenant":         gjson.Parse(`[{"dn": "uni/tn-common"}]`),
+		"epMove":           gjson.Parse(`[{"dn": "subj-[uni/tn-a]/rec-1"}]`),
+		"fvCEpFollowUp":    gjson.Parse(`[{"dn": "uni/tn-a/ap-a/epg-a/cep-00:00:00:00:00:01"}]`),
+		"contractsPerLeaf": gjson.Parse(`[{"dn": "topology/pod-1/node-101"}]`),
+	}
+	reqs := []*collector.Request{
+		{Prefix: "fvTenant"},
+		{Prefix: "epMove", Sensitive: true},
+		{Prefix: "fvCEpFollowUp", Sensitive: true},
+	}
+	reqs = append(reqs, derivedRequests(map[string]goaci.Res{"contractsPerLeaf": responses["contractsPerLeaf"]}, false)...)
+	config, sensitive := splitTiers(responses, reqs)
+	a.Contains(config, "fvTenant")
+	a.Contains(config, "contractsPerLeaf")
+	a.NotContains(config, "epMove")
+	a.Contains(sensitive, "epMove")
+	a.Contains(sensitive, "fvCEpFollowUp")
+	a.NotContains(sensitive, "fvTenant")
+
+	// A response is sensitive if any of its requests is
+	reqs = append(reqs, &collector.Request{Prefix: "fvTenant", Sensitive: true})
+	_, sensitive = splitTiers(responses, reqs)
+	a.Contains(sensitive, "fvTenant")
+	a.Equal("out/aci-vetr-data-sensitive.zip", sensitiveOutput("out/aci-vetr-data.zip"))
+	a.Equal("aci-vetr-data-sensitive.tar.gz", sensitiveOutput("aci-vetr-data.tar.gz"))
+}
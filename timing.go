@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"aci-vetr-c/collector"
+)
+
+// classTiming is the total request time and response size of a class.
+type classTiming struct {
+	prefix  string
+	elapsed time.Duration
+	size    int
+}
+
+// classTimings sums the request times and response sizes per class, slowest
+// first. Classes may have several requests, e.g. follow-up queries.
+func classTimings(reqs []*collector.Request) []classTiming {
+	byPrefix := make(map[string]*classTiming)
+	var timings []*classTiming
+	for _, req := range reqs {
+		t, ok := byPrefix[req.Prefix]
+		if !ok {
+			t = &classTiming{prefix: req.Prefix}
+			byPrefix[req.Prefix] = t
+			timings = append(timings, t)
+		}
+		t.elapsed += req.Elapsed
+		t.size += req.Size
+	}
+	sort.SliceStable(timings, func(i, j int) bool { return timings[i].elapsed > timings[j].elapsed })
+	result := make([]classTiming, len(timings))
+	for i, t := range timings {
+		result[i] = *t
+	}
+	return result
+}
+
+// printTimings writes the class timings as a table.
+func printTimings(w io.Writer, timings []classTiming) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tELAPSED\tSIZE")
+	for _, t := range timings {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", t.prefix, t.elapsed.Round(time.Millisecond), t.size)
+	}
+	tw.Flush()
+}
+
+// reportTimings logs the class timings and prints them to the console, so
+// the queries stressing the APIC can be identified and timeouts tuned.
+func reportTimings(timings []classTiming, log Logger) {
+	for _, t := range timings {
+		log.Debug().
+			Str("resource", t.prefix).
+			Dur("elapsed_time", t.elapsed).
+			Int("size", t.size).
+			Msg("request timing")
+	}
+	if textConsole() {
+		printTimings(os.Stdout, timings)
+		separator()
+	}
+}
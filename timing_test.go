@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aci-vetr-c/collector"
+)
+
+func TestClassTimings(t *testing.T) {
+	a := assert.New(t)
+	timings := classTimings([]*collector.Request{
+		{Prefix: "fvTenant", Elapsed: time.Second, Size: 100},
+		{Prefix: "faultInst", Elapsed: 3 * time.Second, Size: 5000},
+		{Prefix: "fvTenant", Elapsed: 3 * time.Second, Size: 50},
+		{Prefix: "topSystem", Elapsed: 500 * time.Millisecond, Size: 10},
+	})
+	a.Equal([]classTiming{
+		{prefix: "fvTenant", elapsed: 4 * time.Second, size: 150},
+		{prefix: "faultInst", elapsed: 3 * time.Second, size: 5000},
+		{prefix: "topSystem", elapsed: 500 * time.Millisecond, size: 10},
+	}, timings)
+
+	var buf bytes.Buffer
+	printTimings(&buf, timings)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	a.Len(lines, 4)
+	a.Equal([]string{"RESOURCE", "ELAPSED", "SIZE"}, strings.Fields(lines[0]))
+	a.Equal([]string{"fvTenant", "4s", "150"}, strings.Fields(lines[1]))
+	a.Equal([]string{"topSystem", "500ms", "10"}, strings.Fields(lines[3]))
+}
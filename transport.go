@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+)
+
+// Default number of idle connections kept open to the APIC. Requests run
+// concurrently and net/http only keeps two per host by default, so most
+// requests would otherwise need a new TCP and TLS handshake.
+const defaultIdleConns = 32
+
+// transport returns a client modifier applying the HTTP transport options.
+func (c Connection) transport() func(*goaci.Client) {
+	return func(client *goaci.Client) {
+		tr, ok := client.HttpClient.Transport.(*http.Transport)
+		if !ok {
+			return
+		}
+		idle := c.MaxIdleConns
+		if idle <= 0 {
+			idle = defaultIdleConns
+		}
+		tr.MaxIdleConns = idle
+		tr.MaxIdleConnsPerHost = idle
+		tr.IdleConnTimeout = 90 * time.Second
+		tr.DisableKeepAlives = c.NoReuse
+		tr.TLSHandshakeTimeout = 10 * time.Second
+		tr.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: c.TCPKeepAlive,
+		}).DialContext
+		// Custom TLS settings disable HTTP/2 unless forced
+		tr.ForceAttemptHTTP2 = c.HTTP2
+	}
+}
+
+// Header identifying the collection run on every request.
+const runIDHeader = "X-Correlation-ID"
+
+// userAgent identifies the collector in APIC access logs.
+func userAgent() string {
+	return "aci-vetr-collector/" + version
+}
+
+// newRunID returns a random ID for a collection run.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// headerTransport adds headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key := range t.headers {
+		req.Header.Set(key, t.headers.Get(key))
+	}
+	return t.base.RoundTrip(req)
+}
+
+// clientMods returns the client modifiers for the connection options. Every
+// request carries the user agent and run ID, so APIC audit and access logs
+// can be matched to a collection run.
+func (c Connection) clientMods(runID string) []func(*goaci.Client) {
+	identify := func(client *goaci.Client) {
+		base := client.HttpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		headers := http.Header{}
+		headers.Set("User-Agent", userAgent())
+		headers.Set(runIDHeader, runID)
+		client.HttpClient.Transport = headerTransport{base: base, headers: headers}
+	}
+	return []func(*goaci.Client){c.transport(), identify, c.ndGateway()}
+}
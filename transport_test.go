@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/brightpuddle/goaci"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestTransport(t *testing.T) {
+	a := assert.New(t)
+	client, _ := goaci.NewClient("apic", "usr", "pwd", Connection{}.transport())
+	tr := client.HttpClient.Transport.(*http.Transport)
+	a.Equal(defaultIdleConns, tr.MaxIdleConnsPerHost)
+	a.False(tr.DisableKeepAlives)
+	a.False(tr.ForceAttemptHTTP2)
+	a.True(tr.TLSClientConfig.InsecureSkipVerify)
+
+	conn := Connection{MaxIdleConns: 4, NoReuse: true, HTTP2: true}
+	client, _ = goaci.NewClient("apic", "usr", "pwd", conn.transport())
+	tr = client.HttpClient.Transport.(*http.Transport)
+	a.Equal(4, tr.MaxIdleConns)
+	a.Equal(4, tr.MaxIdleConnsPerHost)
+	a.True(tr.DisableKeepAlives)
+	a.True(tr.ForceAttemptHTTP2)
+}
+
+func TestClientModsHeaders(t *testing.T) {
+	a := assert.New(t)
+	defer gock.Off()
+
+	gock.New("https://apic").
+		Get("/api/class/fvTenant.json").
+		MatchHeader("User-Agent", "^aci-vetr-collector/"+version+"$").
+		MatchHeader(runIDHeader, "^0123abcd$").
+		Reply(200).
+		BodyString(`{"imdata":[]}`)
+	intercept := func(c *goaci.Client) { gock.InterceptClient(c.HttpClient) }
+	mods := append([]func(*goaci.Client){intercept}, Connection{}.clientMods("0123abcd")...)
+	client, _ := goaci.NewClient("apic", "usr", "pwd", mods...)
+	client.LastRefresh = time.Now()
+	_, err := client.Get("/api/class/fvTenant")
+	a.NoError(err)
+	a.True(gock.IsDone())
+	a.Len(newRunID(), 16)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// uploader copies a finished file to remote storage.
+type uploader interface {
+	upload(path string) error
+}
+
+// newUploader returns the uploader for a destination URL, e.g.
+// s3://bucket/prefix or sftp://user@host/path
+func newUploader(dest string, args CollectCmd) (uploader, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload destination %q: %v", dest, err)
+	}
+	switch u.Scheme {
+	case "s3":
+		return newS3Uploader(u, args)
+	case "sftp":
+		return newSFTPUploader(u, args)
+	default:
+		return nil, fmt.Errorf("unsupported upload destination %q, expected s3:// or sftp://", dest)
+	}
+}
+
+// uploaders returns the uploaders for the configured destinations.
+func uploaders(args CollectCmd) ([]uploader, error) {
+	var ups []uploader
+	if args.Upload != "" {
+		up, err := newUploader(args.Upload, args)
+		if err != nil {
+			return nil, err
+		}
+		ups = append(ups, up)
+	}
+	if args.UploadURL != "" {
+		up, err := newHTTPUploader(args.UploadURL, args.UploadToken)
+		if err != nil {
+			return nil, err
+		}
+		ups = append(ups, up)
+	}
+	return ups, nil
+}
+
+// uploadFiles uploads the files to each destination and removes the local
+// copies, so scheduled collections don't accumulate on the collection host.
+func uploadFiles(ups []uploader, files []string, log Logger) error {
+	for _, up := range ups {
+		for _, file := range files {
+			log.Info().Str("file", file).Msg("Uploading")
+			if err := up.upload(file); err != nil {
+				return fmt.Errorf("cannot upload %s: %v", file, err)
+			}
+		}
+	}
+	for _, file := range files {
+		os.Remove(file)
+	}
+	return nil
+}
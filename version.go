@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"aci-vetr-c/collector"
+)
+
+// APIC release format, e.g. 5.2(7f) or 3.2
+var versionRe = regexp.MustCompile(`^(\d+)\.(\d+)(?:\((\d+)[a-z]*\))?`)
+
+// apicVersion is an APIC release, e.g. 5.2(7f) is {5, 2, 7}.
+type apicVersion struct {
+	major, minor, maint int
+}
+
+func parseVersion(s string) (apicVersion, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return apicVersion{}, fmt.Errorf("invalid APIC version %q", s)
+	}
+	var v apicVersion
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.maint, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// less checks whether the version is older than another.
+func (v apicVersion) less(o apicVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	return v.maint < o.maint
+}
+
+// controllerVersion returns the oldest firmware version running on the
+// controllers, e.g. during an upgrade.
+func controllerVersion(client collector.Getter) (string, apicVersion, error) {
+	res, err := client.Get("/api/class/firmwareCtrlrRunning")
+	if err != nil {
+		return "", apicVersion{}, fmt.Errorf("cannot query controller firmware: %v", err)
+	}
+	var (
+		name   string
+		oldest apicVersion
+	)
+	for _, record := range res.Get("imdata.#.firmwareCtrlrRunning.attributes").Array() {
+		s := record.Get("version").Str
+		v, err := parseVersion(s)
+		if err != nil {
+			return "", apicVersion{}, err
+		}
+		if name == "" || v.less(oldest) {
+			name, oldest = s, v
+		}
+	}
+	if name == "" {
+		return "", apicVersion{}, errors.New("no controller firmware found")
+	}
+	return name, oldest, nil
+}
+
+// forVersion removes the requests for classes the APIC version doesn't
+// support, returning the remaining requests and the excluded classes.
+func forVersion(reqs []*collector.Request, running apicVersion) ([]*collector.Request, []string) {
+	var (
+		supported []*collector.Request
+		excluded  []string
+	)
+	for _, req := range reqs {
+		if req.MinVersion != "" {
+			if min, err := parseVersion(req.MinVersion); err == nil && running.less(min) {
+				excluded = append(excluded, req.Prefix)
+				continue
+			}
+		}
+		supported = append(supported, req)
+	}
+	return supported, excluded
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"aci-vetr-c/collector"
+)
+
+// versionGetter returns the firmware of the controllers.
+type versionGetter []string
+
+func (g versionGetter) Get(path string, mods ...collector.Mod) (gjson.Result, error) {
+	body := `{"imdata": [`
+	for i, v := range g {
+		if i > 0 {
+			body += ","
+		}
+		body += `{"firmwareCtrlrRunning": {"attributes": {"version": "` + v + `"}}}`
+	}
+	return gjson.Parse(body + "]}"), nil
+}
+
+func TestParseVersion(t *testing.T) {
+	a := assert.New(t)
+	v, err := parseVersion("5.2(7f)")
+	a.NoError(err)
+	a.Equal(apicVersion{5, 2, 7}, v)
+	v, err = parseVersion("3.2")
+	a.NoError(err)
+	a.Equal(apicVersion{3, 2, 0}, v)
+	_, err = parseVersion("n9000-14.2(7f)x")
+	a.Error(err)
+
+	a.True(apicVersion{3, 1, 2}.less(apicVersion{3, 2, 0}))
+	a.True(apicVersion{4, 2, 7}.less(apicVersion{5, 0, 1}))
+	a.False(apicVersion{5, 2, 7}.less(apicVersion{5, 2, 7}))
+}
+
+func TestControllerVersion(t *testing.T) {
+	a := assert.New(t)
+	name, v, err := controllerVersion(versionGetter{"5.2(7f)", "4.2(7w)", "5.2(7f)"})
+	a.NoError(err)
+	a.Equal("4.2(7w)", name)
+	a.Equal(apicVersion{4, 2, 7}, v)
+
+	_, _, err = controllerVersion(versionGetter{})
+	a.Error(err)
+}
+
+func TestForVersion(t *testing.T) {
+	a := assert.New(t)
+	reqs := collector.WithDefaults([]*collector.Request{
+		{Class: "eqptcapacityL3Usage5min"},
+		{Class: "eqptcapacityL3TotalUsage5min", MinVersion: "3.2"},
+	})
+	supported, excluded := forVersion(reqs, apicVersion{3, 1, 2})
+	a.Len(supported, 1)
+	a.Equal([]string{"eqptcapacityL3TotalUsage5min"}, excluded)
+
+	supported, excluded = forVersion(reqs, apicVersion{5, 2, 7})
+	a.Len(supported, 2)
+	a.Empty(excluded)
+}
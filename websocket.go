@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455 section 5.2).
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// Appended to the handshake key to compute the accept header.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Largest message accepted from the server.
+const wsMaxMessage = 64 << 20
+
+// Longest wait for the server's close frame once the client sent its own.
+const wsCloseTimeout = 5 * time.Second
+
+// Status code of the client's close frame: normal closure.
+var wsNormalClosure = []byte{0x03, 0xe8}
+
+// wsConn is a minimal WebSocket client connection, for APIC event
+// subscriptions. It doesn't support extensions, e.g. compression.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu        sync.Mutex // Serializes writes, as pings are answered while reading
+	closeSent bool       // No frames may follow the close frame
+
+	readMu   sync.Mutex // Serializes reads, as Close reads the server's close frame
+	closed   bool       // The server's close frame was received
+	close    sync.Once
+	closeErr error
+}
+
+// wsAccept returns the Sec-WebSocket-Accept header for a handshake key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// dialWebSocket opens a WebSocket connection to a ws:// or wss:// URL.
+func dialWebSocket(rawurl string, config *tls.Config, timeout time.Duration) (*wsConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", hostPort(u, "80"))
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u, "443"), config)
+	default:
+		return nil, fmt.Errorf("invalid WebSocket URL %q", rawurl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	key := base64.StdEncoding.EncodeToString(b)
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+			"User-Agent":            {userAgent()},
+		},
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("received HTTP status %d", res.StatusCode)
+	}
+	if res.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, errors.New("invalid WebSocket handshake")
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, br: br}, nil
+}
+
+// hostPort returns the host and port of a URL, with a default port.
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// ReadMessage returns the next text or binary message, joining fragmented
+// messages and answering pings. It returns io.EOF once the server closes the
+// connection, after answering its close frame.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	return c.readMessage()
+}
+
+// readMessage is ReadMessage, with readMu held.
+func (c *wsConn) readMessage() ([]byte, error) {
+	if c.closed {
+		return nil, io.EOF
+	}
+	var msg []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		// Control frames may come between the fragments of a message
+		if opcode >= wsClose && (!fin || len(payload) > 125) {
+			return nil, errors.New("invalid WebSocket control frame")
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.closed = true
+			// Echo the status code, unless the client sent its close frame first
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if fragmented {
+				return nil, errors.New("WebSocket message within a fragmented message")
+			}
+		case wsContinuation:
+			if !fragmented {
+				return nil, errors.New("WebSocket continuation frame without a message")
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %d", opcode)
+		}
+		msg = append(msg, payload...)
+		if len(msg) > wsMaxMessage {
+			return nil, errors.New("WebSocket message too large")
+		}
+		if fin {
+			return msg, nil
+		}
+		fragmented = true
+	}
+}
+
+// readFrame reads a single frame.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	// The reserved bits are for extensions, and server frames aren't masked
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("WebSocket frame with reserved bits set")
+	}
+	if header[1]&0x80 != 0 {
+		return false, 0, nil, errors.New("masked WebSocket frame from the server")
+	}
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return false, 0, nil, errors.New("WebSocket message too large")
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single frame. Client frames are always masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 0x80|127), ext[:]...)
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeSent {
+		return errors.New("WebSocket is closing")
+	}
+	c.closeSent = opcode == wsClose
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close closes the connection with the close handshake: unless the server
+// closed it, it sends a close frame and waits for the server's, discarding
+// any messages in between, for up to wsCloseTimeout. A pending ReadMessage
+// returns io.EOF once the handshake completes, or an error if it times out.
+func (c *wsConn) Close() error {
+	c.close.Do(func() {
+		c.writeFrame(wsClose, wsNormalClosure)
+		c.conn.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+		c.readMu.Lock()
+		for !c.closed {
+			if _, err := c.readMessage(); err != nil && err != io.EOF {
+				break
+			}
+		}
+		c.readMu.Unlock()
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wsServerFrame encodes an unmasked server frame.
+func wsServerFrame(fin bool, opcode byte, payload []byte) []byte {
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+	frame := []byte{b}
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else {
+		var ext [2]byte
+		binary.BigEndian.PutUint16(ext[:], uint16(len(payload)))
+		frame = append(append(frame, 126), ext[:]...)
+	}
+	return append(frame, payload...)
+}
+
+// wsClientFrame reads a masked client frame of less than 126 bytes,
+// returning the first header byte and the unmasked payload.
+func wsClientFrame(br *bufio.Reader) (byte, []byte, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= header[2+i%4]
+	}
+	return header[0], payload, nil
+}
+
+// wsServer accepts WebSocket connections to /socket123 and hands them to
+// serve once the handshake is sent.
+func wsServer(serve func(conn net.Conn, rw *bufio.ReadWriter)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/socket123" || r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		conn, rw, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		serve(conn, rw)
+	}))
+}
+
+// wsURL returns the WebSocket URL of a test server.
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket123"
+}
+
+func TestWebSocket(t *testing.T) {
+	a := assert.New(t)
+	pong := make(chan []byte, 1)
+	srv := wsServer(func(conn net.Conn, rw *bufio.ReadWriter) {
+		rw.Write(wsServerFrame(true, wsPing, []byte("hi")))
+		rw.Write(wsServerFrame(false, wsText, []byte(`{"imdata":`)))
+		rw.Write(wsServerFrame(true, wsContinuation, []byte(`[]}`)))
+		rw.Write(wsServerFrame(true, wsText, []byte(strings.Repeat("x", 300))))
+		rw.Write(wsServerFrame(true, wsClose, nil))
+		rw.Flush()
+		// The client's pong is masked
+		b, payload, err := wsClientFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		pong <- append([]byte{b}, payload...)
+	})
+	defer srv.Close()
+
+	_, err := dialWebSocket(strings.TrimSuffix(wsURL(srv), "/socket123")+"/other", nil, time.Second)
+	a.EqualError(err, "received HTTP status 400")
+
+	ws, err := dialWebSocket(wsURL(srv), nil, time.Second)
+	if !a.NoError(err) {
+		return
+	}
+	defer ws.Close()
+	msg, err := ws.ReadMessage()
+	a.NoError(err)
+	a.Equal(`{"imdata":[]}`, string(msg))
+	msg, err = ws.ReadMessage()
+	a.NoError(err)
+	a.Len(msg, 300)
+	_, err = ws.ReadMessage()
+	a.Equal(io.EOF, err)
+	select {
+	case b := <-pong:
+		a.Equal([]byte{0x80 | wsPong, 'h', 'i'}, b)
+	case <-time.After(time.Second):
+		a.Fail("no pong")
+	}
+}
+
+func TestWebSocketFragmentation(t *testing.T) {
+	a := assert.New(t)
+	frames := make(chan [][]byte, 1)
+	srv := wsServer(func(conn net.Conn, rw *bufio.ReadWriter) {
+		for _, frame := range <-frames {
+			rw.Write(frame)
+		}
+		rw.Flush()
+		// Wait for the client to close the connection
+		io.Copy(ioutil.Discard, rw)
+	})
+	defer srv.Close()
+	read := func(f ...[]byte) ([]byte, error) {
+		frames <- f
+		ws, err := dialWebSocket(wsURL(srv), nil, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		defer ws.conn.Close()
+		return ws.ReadMessage()
+	}
+
+	// Fragments are joined, with control frames in between
+	msg, err := read(
+		wsServerFrame(false, wsBinary, []byte("a")),
+		wsServerFrame(false, wsContinuation, nil),
+		wsServerFrame(true, wsPing, nil),
+		wsServerFrame(false, wsContinuation, []byte("b")),
+		wsServerFrame(true, wsPong, nil),
+		wsServerFrame(true, wsContinuation, []byte(strings.Repeat("c", 200))),
+	)
+	a.NoError(err)
+	a.Equal("ab"+strings.Repeat("c", 200), string(msg))
+
+	_, err = read(wsServerFrame(true, wsContinuation, []byte("a")))
+	a.EqualError(err, "WebSocket continuation frame without a message")
+	_, err = read(wsServerFrame(false, wsText, []byte("a")), wsServerFrame(true, wsText, []byte("b")))
+	a.EqualError(err, "WebSocket message within a fragmented message")
+	_, err = read(wsServerFrame(false, wsPing, nil))
+	a.EqualError(err, "invalid WebSocket control frame")
+	_, err = read(wsServerFrame(true, wsClose, []byte(strings.Repeat("x", 126))))
+	a.EqualError(err, "invalid WebSocket control frame")
+	_, err = read([]byte{0x80 | 0x40 | wsText, 0})
+	a.EqualError(err, "WebSocket frame with reserved bits set")
+	_, err = read([]byte{0x80 | wsText, 0x80 | 1, 0, 0, 0, 0, 'a'})
+	a.EqualError(err, "masked WebSocket frame from the server")
+	_, err = read(wsServerFrame(true, 0x3, nil))
+	a.EqualError(err, "unknown WebSocket opcode 3")
+}
+
+func TestWebSocketClose(t *testing.T) {
+	a := assert.New(t)
+	received := make(chan []byte, 1)
+	rest := make(chan error, 1)
+
+	// The server closes: the client echoes the status code
+	srv := wsServer(func(conn net.Conn, rw *bufio.ReadWriter) {
+		rw.Write(wsServerFrame(true, wsClose, []byte{0x03, 0xe9, 'b', 'y', 'e'}))
+		rw.Flush()
+		b, payload, err := wsClientFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		received <- append([]byte{b}, payload...)
+		// The client doesn't send another close frame
+		_, _, err = wsClientFrame(rw.Reader)
+		rest <- err
+	})
+	ws, err := dialWebSocket(wsURL(srv), nil, time.Second)
+	if a.NoError(err) {
+		_, err = ws.ReadMessage()
+		a.Equal(io.EOF, err)
+		_, err = ws.ReadMessage()
+		a.Equal(io.EOF, err)
+		a.Equal([]byte{0x80 | wsClose, 0x03, 0xe9}, <-received)
+		a.NoError(ws.Close())
+		a.Equal(io.EOF, <-rest)
+	}
+	srv.Close()
+
+	// The client closes: it waits for the server's close frame, discarding
+	// messages, and a pending read returns once the handshake completes
+	srv = wsServer(func(conn net.Conn, rw *bufio.ReadWriter) {
+		b, payload, err := wsClientFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		received <- append([]byte{b}, payload...)
+		rw.Write(wsServerFrame(true, wsText, []byte("late")))
+		rw.Write(wsServerFrame(true, wsClose, payload))
+		rw.Flush()
+		io.Copy(ioutil.Discard, rw)
+	})
+	defer srv.Close()
+	ws, err = dialWebSocket(wsURL(srv), nil, time.Second)
+	if !a.NoError(err) {
+		return
+	}
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := ws.ReadMessage(); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	a.NoError(ws.Close())
+	a.Equal([]byte{0x80 | wsClose, 0x03, 0xe8}, <-received)
+	a.Equal(io.EOF, <-errc)
+	a.NoError(ws.Close())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+)
+
+// wipe overwrites a file with zeros before removing it, so the raw records
+// can't be recovered from the freed blocks. Missing files are ignored. This
+// is best effort: copy-on-write filesystems and SSDs may keep the old blocks.
+func wipe(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	zeros := make([]byte, 32*1024)
+	for n := info.Size(); n > 0; n -= int64(len(zeros)) {
+		if n < int64(len(zeros)) {
+			zeros = zeros[:n]
+		}
+		if _, err := f.Write(zeros); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWipe(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "aci-vetr-test")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, dbName)
+	a.NoError(ioutil.WriteFile(path, []byte(strings.Repeat("secret", 10000)), 0644))
+	// A second link to the same file shows the contents were overwritten
+	link := filepath.Join(dir, "link.db")
+	if !a.NoError(os.Link(path, link)) {
+		return
+	}
+	a.NoError(wipe(path))
+	_, err = os.Stat(path)
+	a.True(os.IsNotExist(err))
+	b, err := ioutil.ReadFile(link)
+	a.NoError(err)
+	a.Len(b, 60000)
+	a.NotContains(string(b), "secret")
+
+	a.NoError(wipe(filepath.Join(dir, "missing.db")))
+}